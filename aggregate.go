@@ -0,0 +1,276 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LabelTotal is the amount of money spent on a label
+type LabelTotal struct {
+	Label  string `json:"label"`
+	Amount int64  `json:"amount"`
+}
+
+// MonthTotal is the balance of a month (formatted as YYYY-MM), i.e. the
+// sum of incomes (positive) and expenses (negative)
+type MonthTotal struct {
+	Month  string `json:"month"`
+	Amount int64  `json:"amount"`
+}
+
+// SumByDetailLabel returns the total amount of details per label of the
+// transactions within the window of dates (if any), ordered by label.
+// Amounts are added up as they are, so transactions in more currencies must
+// be narrowed down to one of them (see Currencies)
+func (t *Transactions) SumByDetailLabel(ctx PullContext) ([]LabelTotal, error) {
+	var err error
+	if ctx.Storage, err = withTableSuffix(ctx.reader(), ctx.TableSuffix); err != nil {
+		return nil, err
+	}
+
+	uuids := ctx.expenses(ctx.Storage.Model(&Transaction{})).Select("uuid")
+
+	var totals []LabelTotal
+	err = ctx.Storage.Model(&Details{}).
+		Select("label_name AS label, SUM(amount) AS amount").
+		Where("transaction_uuid IN (?)", uuids).
+		Group("label_name").Order("label_name").Scan(&totals).Error
+
+	return totals, err
+}
+
+// AveragesByLabel returns the average size of transactions (regardless of
+// their sign) per label, as minor units, for the transactions within the
+// window of dates (if any). Just like SumByDetailLabel, it doesn't tell
+// currencies apart (see Currencies)
+func (t *Transactions) AveragesByLabel(ctx PullContext) (map[string]float64, error) {
+	var err error
+	if ctx.Storage, err = withTableSuffix(ctx.reader(), ctx.TableSuffix); err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Label   string
+		Average float64
+	}
+
+	err = ctx.expenses(ctx.Storage.Model(&Transaction{})).
+		Select("label_name AS label, AVG(ABS(amount)) AS average").
+		Group("label_name").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	averages := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		averages[row.Label] = row.Average
+	}
+
+	return averages, nil
+}
+
+// MonthlyTotals returns the balance of each month with transactions within
+// the window of dates (if any), in chronological order. Just like
+// SumByDetailLabel, it doesn't tell currencies apart (see Currencies)
+func (t *Transactions) MonthlyTotals(ctx PullContext) ([]MonthTotal, error) {
+	var err error
+	if ctx.Storage, err = withTableSuffix(ctx.reader(), ctx.TableSuffix); err != nil {
+		return nil, err
+	}
+
+	var trxs []Transaction
+	if err := ctx.expenses(ctx.Storage.Model(&Transaction{})).Select("date", "amount").Find(&trxs).Error; err != nil {
+		return nil, err
+	}
+
+	sums := make(map[string]int64)
+	for _, trx := range trxs {
+		sums[trx.Date.Format("2006-01")] += trx.Amount
+	}
+
+	totals := make([]MonthTotal, 0, len(sums))
+	for month, amount := range sums {
+		totals = append(totals, MonthTotal{Month: month, Amount: amount})
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Month < totals[j].Month })
+
+	return totals, nil
+}
+
+// IncomeExpense returns the total of incomes (positive) and the total of
+// expenses (negative, as amounts are) of transactions within the window of
+// dates (if any), both computed by a single query. Just like
+// SumByDetailLabel, it doesn't tell currencies apart (see Currencies)
+func (t *Transactions) IncomeExpense(ctx PullContext) (income int64, expense int64, err error) {
+	if ctx.Storage, err = withTableSuffix(ctx.reader(), ctx.TableSuffix); err != nil {
+		return 0, 0, err
+	}
+
+	var totals struct {
+		Income  int64
+		Expense int64
+	}
+
+	err = ctx.expenses(ctx.Storage.Model(&Transaction{})).
+		Select("COALESCE(SUM(CASE WHEN amount > 0 THEN amount ELSE 0 END), 0) AS income, " +
+			"COALESCE(SUM(CASE WHEN amount < 0 THEN amount ELSE 0 END), 0) AS expense").
+		Scan(&totals).Error
+
+	return totals.Income, totals.Expense, err
+}
+
+// TotalsInCurrency returns the balance of transactions within the window
+// of dates (if any) in the target currency, as minor units of it (see
+// CurrencyScale). Amounts are summed per currency by the database and then
+// converted by the rates, which are target units per unit of each currency
+// keyed by its ISO 4217 code (e.g. {"EUR": 4.92} for a RON target).
+// Transactions without a currency are taken to be in the target currency
+// already, while a missing rate for any other currency makes it fail with
+// ErrMissingRate
+func (t *Transactions) TotalsInCurrency(ctx PullContext, target string, rates map[string]float64) (int64, error) {
+	var err error
+	if ctx.Storage, err = withTableSuffix(ctx.reader(), ctx.TableSuffix); err != nil {
+		return 0, err
+	}
+
+	var sums []struct {
+		Currency string
+		Amount   int64
+	}
+
+	err = ctx.expenses(ctx.Storage.Model(&Transaction{})).
+		Select("currency, SUM(amount) AS amount").
+		Group("currency").Order("currency").Scan(&sums).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, sum := range sums {
+		currency := strings.ToUpper(sum.Currency)
+		if currency == "" || currency == strings.ToUpper(target) {
+			total += sum.Amount
+			continue
+		}
+
+		rate, ok := rates[currency]
+		if !ok {
+			return 0, fmt.Errorf("%w from %s to %s", ErrMissingRate, currency, target)
+		}
+
+		units := float64(sum.Amount) / math.Pow10(scaleOf(currency))
+		total += int64(math.Round(units * rate * math.Pow10(scaleOf(target))))
+	}
+
+	return total, nil
+}
+
+// TransactionSummary is a transaction annotated with the number of details
+// it has, without the details themselves
+type TransactionSummary struct {
+	Transaction
+	DetailCount int `json:"detail_count"`
+}
+
+// PullWithDetailCounts reads transactions just like Pull does, except the
+// details are counted by the database instead of being read
+func (t *Transactions) PullWithDetailCounts(ctx PullContext) ([]TransactionSummary, error) {
+	db, err := withTableSuffix(ctx.reader(), ctx.TableSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, details := tableOf(db, &Transaction{}), tableOf(db, &Details{})
+	count := db.Model(&Details{}).Select("COUNT(*)").
+		Where("? = ?", clause.Column{Table: details, Name: "transaction_uuid"}, clause.Column{Table: transactions, Name: "uuid"})
+
+	var summaries []TransactionSummary
+	err = ctx.filtered(db.Model(&Transaction{})).
+		Select("?, (?) AS detail_count", clause.Column{Table: transactions, Name: "*", Raw: true}, count).
+		Limit(ctx.Limit).Offset(ctx.Offset).Order(transactionsOrder).
+		Find(&summaries).Error
+
+	return summaries, err
+}
+
+// PullGrouped reads transactions just like Pull does and groups them by the
+// name of their label. Each group keeps the order they were read in
+func (t *Transactions) PullGrouped(ctx PullContext) (map[string]Transactions, error) {
+	if err := t.Pull(ctx); err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]Transactions)
+	for _, trx := range *t {
+		groups[trx.LabelName] = append(groups[trx.LabelName], trx)
+	}
+
+	return groups, nil
+}
+
+// ActorSummary is an actor annotated with the number of transactions it
+// sent and received
+type ActorSummary struct {
+	Actor
+	SentCount     int `json:"sent_count"`
+	ReceivedCount int `json:"received_count"`
+}
+
+// PullWithCounts reads actors just like Pull does, except each of them is
+// annotated with its number of transactions, counted by the database
+func (a *Actors) PullWithCounts(ctx PullContext) ([]ActorSummary, error) {
+	db, err := withTableSuffix(ctx.reader(), ctx.TableSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	actors, transactions := tableOf(db, &Actor{}), tableOf(db, &Transaction{})
+	name := clause.Column{Table: actors, Name: "name"}
+	sent := db.Model(&Transaction{}).Select("COUNT(*)").
+		Where("? = ?", clause.Column{Table: transactions, Name: "sender_name"}, name)
+	received := db.Model(&Transaction{}).Select("COUNT(*)").
+		Where("? = ?", clause.Column{Table: transactions, Name: "receiver_name"}, name)
+
+	var summaries []ActorSummary
+	err = ctx.prefixed(ctx.flagged(ctx.changed(db.Model(&Actor{})))).
+		Select("?, (?) AS sent_count, (?) AS received_count", clause.Column{Table: actors, Name: "*", Raw: true}, sent, received).
+		Order(clause.OrderByColumn{Column: name}).Limit(ctx.Limit).Offset(ctx.Offset).
+		Find(&summaries).Error
+
+	return summaries, err
+}
+
+// tableOf returns the table name of a model, as named by the database
+// handle (e.g. with a prefix or a suffix)
+func tableOf(db *gorm.DB, model interface{}) string {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return ""
+	}
+
+	return stmt.Table
+}
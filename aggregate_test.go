@@ -0,0 +1,441 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// seedAggregates pushes a couple of expenses and an internal transfer whose
+// label is flagged as non-expense
+func seedAggregates(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+
+	transfer := NewLabel("Transfer intern", nil)
+	transfer.Flags = FlagNonExpense
+	if err := (&Labels{transfer}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	trxs := Transactions{
+		NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"),
+			map[Label]int64{NewLabel("Pâine", nil): 1000, NewLabel("Apă", nil): 2000}, ""),
+		NewTransaction(date.AddDate(0, 1, 0), -1500, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"),
+			map[Label]int64{NewLabel("Pâine", nil): 1500}, ""),
+		NewTransaction(date.AddDate(0, 1, 1), -10000, transfer, NewActor("Alexandru"), NewActor("Alexandru"),
+			map[Label]int64{NewLabel("Economii", nil): 10000}, ""),
+	}
+
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testSumByDetailLabel(t *testing.T, db *gorm.DB) {
+	seedAggregates(t, db)
+
+	totals, err := (&Transactions{}).SumByDetailLabel(PullContext{Storage: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[{Apă 2000} {Economii 10000} {Pâine 2500}]"
+	if fmt.Sprint(totals) != expected {
+		t.Fatalf("Expected totals %s but got %v instead", expected, totals)
+	}
+
+	totals, err = (&Transactions{}).SumByDetailLabel(PullContext{Storage: db, ExcludeNonExpenseLabels: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = "[{Apă 2000} {Pâine 2500}]"
+	if fmt.Sprint(totals) != expected {
+		t.Fatalf("Expected totals without transfers %s but got %v instead", expected, totals)
+	}
+}
+
+func testAveragesByLabel(t *testing.T, db *gorm.DB) {
+	seedAggregates(t, db)
+
+	averages, err := (&Transactions{}).AveragesByLabel(PullContext{Storage: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]float64{"Alimente": 2250, "Transfer intern": 10000}
+	if fmt.Sprint(averages) != fmt.Sprint(expected) {
+		t.Fatalf("Expected averages %v but got %v instead", expected, averages)
+	}
+
+	from, _ := time.Parse("2006-01-02", "2021-06-01")
+	averages, err = (&Transactions{}).AveragesByLabel(PullContext{Storage: db, From: from})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = map[string]float64{"Alimente": 1500, "Transfer intern": 10000}
+	if fmt.Sprint(averages) != fmt.Sprint(expected) {
+		t.Fatalf("Expected averages since June %v but got %v instead", expected, averages)
+	}
+}
+
+func testMonthlyTotals(t *testing.T, db *gorm.DB) {
+	seedAggregates(t, db)
+
+	totals, err := (&Transactions{}).MonthlyTotals(PullContext{Storage: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[{2021-05 -3000} {2021-06 -11500}]"
+	if fmt.Sprint(totals) != expected {
+		t.Fatalf("Expected totals %s but got %v instead", expected, totals)
+	}
+
+	totals, err = (&Transactions{}).MonthlyTotals(PullContext{Storage: db, ExcludeNonExpenseLabels: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = "[{2021-05 -3000} {2021-06 -1500}]"
+	if fmt.Sprint(totals) != expected {
+		t.Fatalf("Expected totals without transfers %s but got %v instead", expected, totals)
+	}
+}
+
+func testPullWithDetailCounts(t *testing.T, db *gorm.DB) {
+	seedAggregates(t, db)
+
+	summaries, err := (&Transactions{}).PullWithDetailCounts(PullContext{Storage: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[int64]int)
+	for _, s := range summaries {
+		if s.Details != nil {
+			t.Fatalf("Expected details not to be read, got %v", s.Details)
+		} else if s.UUID == nil || s.LabelName == "" {
+			t.Fatalf("Expected transaction columns to be read, got %v", s.Transaction)
+		}
+		counts[s.Amount] = s.DetailCount
+	}
+
+	expected := map[int64]int{-3000: 2, -1500: 1, -10000: 1}
+	if fmt.Sprint(counts) != fmt.Sprint(expected) {
+		t.Fatalf("Expected details counts %v but got %v instead", expected, counts)
+	}
+}
+
+func testIncomeExpense(t *testing.T, db *gorm.DB) {
+	if income, expense, err := (&Transactions{}).IncomeExpense(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if income != 0 || expense != 0 {
+		t.Fatalf("Expected no totals without transactions, got %d and %d", income, expense)
+	}
+
+	seedAggregates(t, db)
+
+	date, _ := time.Parse("2006-01-02", "2021-06-15")
+	salary := Transactions{NewTransaction(date, 500000, NewLabel("Salariu", nil), NewActor("Angajator"), NewActor("Alexandru"), nil, "")}
+	if err := salary.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if income, expense, err := (&Transactions{}).IncomeExpense(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if income != 500000 || expense != -14500 {
+		t.Fatalf("Expected income 500000 and expense -14500, got %d and %d", income, expense)
+	}
+
+	from, _ := time.Parse("2006-01-02", "2021-06-01")
+	if income, expense, err := (&Transactions{}).IncomeExpense(PullContext{Storage: db, From: from, ExcludeNonExpenseLabels: true}); err != nil {
+		t.Fatal(err)
+	} else if income != 500000 || expense != -1500 {
+		t.Fatalf("Expected income 500000 and expense -1500 since %s, got %d and %d", from.Format(DateFormat), income, expense)
+	}
+}
+
+func testActorsPullWithCounts(t *testing.T, db *gorm.DB) {
+	seedAggregates(t, db)
+
+	summaries, err := (&Actors{}).PullWithCounts(PullContext{Storage: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var counts []string
+	for _, s := range summaries {
+		counts = append(counts, fmt.Sprintf("%s:%d/%d", s.Name, s.SentCount, s.ReceivedCount))
+	}
+
+	expected := "[Alexandru:3/1 Magazin:0/1 Piață:0/1]"
+	if fmt.Sprint(counts) != expected {
+		t.Fatalf("Expected actors counts %s but got %v instead", expected, counts)
+	}
+}
+
+func testTotalsInCurrency(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	inCurrency := func(amount int64, currency string) Transaction {
+		trx := NewTransaction(date, amount, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")
+		trx.Currency = currency
+		return trx
+	}
+
+	trxs := Transactions{inCurrency(-3000, ""), inCurrency(-1000, "EUR"), inCurrency(-500, "JPY"), inCurrency(2000, "RON")}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	rates := map[string]float64{"EUR": 4.92, "JPY": 0.042}
+	if total, err := trxs.TotalsInCurrency(PullContext{Storage: db}, "RON", rates); err != nil {
+		t.Fatal(err)
+	} else if expected := int64(-3000 - 4920 - 2100 + 2000); total != expected {
+		t.Fatalf("Expected total of %d in RON but got %d instead", expected, total)
+	}
+
+	delete(rates, "JPY")
+	if _, err := trxs.TotalsInCurrency(PullContext{Storage: db}, "RON", rates); !errors.Is(err, ErrMissingRate) {
+		t.Fatalf("Expected a missing rate to fail but got %v", err)
+	}
+
+	if _, expense, err := trxs.IncomeExpense(PullContext{Storage: db, Currencies: []string{"EUR"}}); err != nil {
+		t.Fatal(err)
+	} else if expense != -1000 {
+		t.Fatalf("Expected expenses of -1000 in EUR but got %d instead", expense)
+	}
+
+	// the currency is updated on conflict, just like the rest of columns
+	trxs[0].Currency = "EUR"
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, expense, err := trxs.IncomeExpense(PullContext{Storage: db, Currencies: []string{"EUR"}}); err != nil {
+		t.Fatal(err)
+	} else if expense != -4000 {
+		t.Fatalf("Expected expenses of -4000 in EUR but got %d instead", expense)
+	}
+}
+
+func testPullGrouped(t *testing.T, db *gorm.DB) {
+	seedAggregates(t, db)
+
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trx := NewTransaction(date.AddDate(0, 0, 10), -500, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")
+	if err := (&Transactions{trx}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := (&Transactions{}).PullGrouped(PullContext{Storage: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amounts := make(map[string][]int64)
+	for name, trxs := range groups {
+		for _, trx := range trxs {
+			if trx.LabelName != name {
+				t.Fatalf("Expected transaction in group %s, got it labelled %s", name, trx.LabelName)
+			}
+			amounts[name] = append(amounts[name], trx.Amount)
+		}
+	}
+
+	expected := map[string][]int64{"Alimente": {-1500, -500, -3000}, "Transfer intern": {-10000}}
+	if fmt.Sprint(amounts) != fmt.Sprint(expected) {
+		t.Fatalf("Expected groups %v but got %v instead", expected, amounts)
+	}
+}
+
+func TestSumByDetailLabel_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testSumByDetailLabel(t, db)
+}
+
+func TestMonthlyTotals_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testMonthlyTotals(t, db)
+}
+
+func TestPullWithDetailCounts_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testPullWithDetailCounts(t, db)
+}
+
+func TestIncomeExpense_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testIncomeExpense(t, db)
+}
+
+func TestActorsPullWithCounts_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testActorsPullWithCounts(t, db)
+}
+
+func TestTotalsInCurrency_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testTotalsInCurrency(t, db)
+}
+
+func TestPullGrouped_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testPullGrouped(t, db)
+}
+
+func TestAveragesByLabel_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testAveragesByLabel(t, db)
+}
+
+func TestSumByDetailLabel_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testSumByDetailLabel(t, db)
+}
+
+func TestMonthlyTotals_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testMonthlyTotals(t, db)
+}
+
+func TestPullWithDetailCounts_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testPullWithDetailCounts(t, db)
+}
+
+func TestIncomeExpense_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testIncomeExpense(t, db)
+}
+
+func TestActorsPullWithCounts_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testActorsPullWithCounts(t, db)
+}
+
+func TestTotalsInCurrency_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testTotalsInCurrency(t, db)
+}
+
+func TestPullGrouped_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testPullGrouped(t, db)
+}
+
+func TestAveragesByLabel_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testAveragesByLabel(t, db)
+}
+
+func TestSumByDetailLabel_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testSumByDetailLabel(t, db)
+}
+
+func TestMonthlyTotals_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testMonthlyTotals(t, db)
+}
+
+func TestPullWithDetailCounts_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testPullWithDetailCounts(t, db)
+}
+
+func TestIncomeExpense_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testIncomeExpense(t, db)
+}
+
+func TestActorsPullWithCounts_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testActorsPullWithCounts(t, db)
+}
+
+func TestTotalsInCurrency_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testTotalsInCurrency(t, db)
+}
+
+func TestPullGrouped_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testPullGrouped(t, db)
+}
+
+func TestAveragesByLabel_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testAveragesByLabel(t, db)
+}
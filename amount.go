@@ -0,0 +1,285 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// AmountDecimals is the number of fractional digits amounts are written
+// with, since amounts are stored in minor units (e.g. -3000 is -30.00).
+// Change it for currencies without minor units (e.g. 0 for JPY)
+var AmountDecimals = 2
+
+// CurrencyScale is the number of fractional digits used by currencies that
+// don't have exactly AmountDecimals, keyed by their ISO 4217 code. Any
+// currency missing from here falls back to AmountDecimals
+var CurrencyScale = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLP": 0, "ISK": 0, "JPY": 0, "KRW": 0, "PYG": 0, "UGX": 0, "VND": 0,
+}
+
+// scaleOf returns the number of fractional digits of a currency
+func scaleOf(currency string) int {
+	if scale, ok := CurrencyScale[strings.ToUpper(currency)]; ok {
+		return scale
+	}
+
+	return AmountDecimals
+}
+
+// ParseAmount converts a decimal string (e.g. "-30.00" or "30.5") into an
+// amount in minor units (e.g. -3000 or 3050). Amounts with more fractional
+// digits than AmountDecimals are rejected rather than rounded
+func ParseAmount(s string) (int64, error) {
+	return parseAmount(s, AmountDecimals)
+}
+
+// FormatAmount is the inverse of ParseAmount, converting an amount in minor
+// units into a decimal string with exactly AmountDecimals fractional digits
+func FormatAmount(a int64) string {
+	return formatAmount(a, AmountDecimals)
+}
+
+// ParseAmountIn works just like ParseAmount except the number of fractional
+// digits depends on the currency (see CurrencyScale)
+func ParseAmountIn(s, currency string) (int64, error) {
+	return parseAmount(s, scaleOf(currency))
+}
+
+// FormatAmountIn works just like FormatAmount except the number of
+// fractional digits depends on the currency (see CurrencyScale)
+func FormatAmountIn(a int64, currency string) string {
+	return formatAmount(a, scaleOf(currency))
+}
+
+// parseAmount converts a decimal string into minor units of a given scale
+func parseAmount(s string, scale int) (int64, error) {
+	str := strings.TrimSpace(s)
+
+	neg := strings.HasPrefix(str, "-")
+	if neg || strings.HasPrefix(str, "+") {
+		str = str[1:]
+	}
+
+	whole, frac, hasDot := strings.Cut(str, ".")
+	if whole == "" || (hasDot && frac == "") {
+		return 0, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	} else if len(frac) > scale {
+		return 0, fmt.Errorf("%w %q, expected at most %d decimals", ErrInvalidAmount, s, scale)
+	}
+
+	digits := whole + frac + strings.Repeat("0", scale-len(frac))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+		}
+	}
+
+	n, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil || (!neg && n > math.MaxInt64) || (neg && n > -math.MinInt64) {
+		return 0, fmt.Errorf("%w %q, out of range", ErrInvalidAmount, s)
+	}
+
+	if neg {
+		return -int64(n), nil
+	}
+
+	return int64(n), nil
+}
+
+// formatAmount converts minor units of a given scale into a decimal string
+func formatAmount(a int64, scale int) string {
+	sign, u := "", uint64(a)
+	if a < 0 {
+		sign, u = "-", -u
+	}
+
+	digits := strconv.FormatUint(u, 10)
+	if scale <= 0 {
+		return sign + digits
+	} else if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+// jsonAmount is an amount as written in JSON, either as minor units or as a
+// decimal in major units. The rule is the form of the number: an integer is
+// minor units (e.g. -3000), while a number with a fraction or an exponent
+// (e.g. -30.00 or -30.5) and a string (e.g. "-30.00" or "-30") are decimals.
+// Note -30 and -30.0 are different amounts then, so payloads written by
+// JavaScript (where -30.00 becomes -30) should rather use strings. A decimal
+// is converted once the currency is known (see minor)
+type jsonAmount struct {
+	units   *int64
+	decimal *string
+}
+
+// maxAmountExponent bounds the exponent of amounts written as numbers, since
+// no larger one can fit into minor units anyway
+const maxAmountExponent = 20
+
+// UnmarshalJSON reads either of the accepted forms, as they are
+func (a *jsonAmount) UnmarshalJSON(b []byte) error {
+	raw := string(b)
+	if raw == "null" {
+		return nil
+	}
+
+	var decimal string
+	if err := json.Unmarshal(b, &decimal); err == nil {
+		a.decimal = &decimal
+		return nil
+	}
+
+	if strings.ContainsAny(raw, ".eE") {
+		decimal, err := decimalOf(raw)
+		if err != nil {
+			return err
+		}
+		a.decimal = &decimal
+		return nil
+	}
+
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return fmt.Errorf("amount %s is out of range", raw)
+	}
+	a.units = &n
+
+	return nil
+}
+
+// decimalOf writes a JSON number with a fraction or an exponent (e.g. -30.50
+// or -3.05e1) as a decimal string without an exponent, with no more
+// fractional digits than needed (e.g. -30.5)
+func decimalOf(raw string) (string, error) {
+	if i := strings.IndexAny(raw, "eE"); i >= 0 {
+		if exp, err := strconv.Atoi(raw[i+1:]); err != nil || exp < -maxAmountExponent || exp > maxAmountExponent {
+			return "", fmt.Errorf("amount %s is out of range", raw)
+		}
+	}
+
+	r, ok := new(big.Rat).SetString(raw)
+	if !ok {
+		return "", fmt.Errorf("amount %s is not a number", raw)
+	}
+
+	scaled, ten := new(big.Rat).Set(r), big.NewRat(10, 1)
+	for digits := 0; ; digits++ {
+		if scaled.IsInt() {
+			return r.FloatString(digits), nil
+		}
+		scaled.Mul(scaled, ten)
+	}
+}
+
+// minor returns the amount in minor units, where a decimal string has at
+// most as many fractional digits as the currency (see CurrencyScale). An
+// amount which wasn't written at all is left as it was
+func (a jsonAmount) minor(was int64, currency string) (int64, error) {
+	if a.units != nil {
+		return *a.units, nil
+	} else if a.decimal == nil {
+		return was, nil
+	}
+
+	n, err := ParseAmountIn(*a.decimal, currency)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q is not valid: %w", *a.decimal, err)
+	}
+
+	return n, nil
+}
+
+// UnmarshalJSON accepts the amount of a transaction, and of its details, as
+// minor units or as a decimal string in its currency (see jsonAmount), while
+// the rest is decoded as usual
+func (t *Transaction) UnmarshalJSON(b []byte) error {
+	type transaction Transaction // without methods, to avoid recursion
+	aux := struct {
+		*transaction
+		Amount  jsonAmount        `json:"amount"`
+		Details []json.RawMessage `json:"details"`
+	}{transaction: (*transaction)(t)}
+
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	amount, err := aux.Amount.minor(t.Amount, t.Currency)
+	if err != nil {
+		return err
+	}
+	t.Amount = amount
+
+	// details are decoded once the currency is known, whatever the order
+	if aux.Details != nil {
+		t.Details = make([]*Details, len(aux.Details))
+		for i, raw := range aux.Details {
+			if string(raw) == "null" {
+				continue
+			}
+
+			t.Details[i] = &Details{}
+			if err := t.Details[i].unmarshal(raw, t.Currency); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalJSON accepts the amount of details as minor units or as a decimal
+// string (see jsonAmount), in the default currency (see AmountDecimals)
+// since details on their own have no currency, while the rest is decoded as
+// usual
+func (d *Details) UnmarshalJSON(b []byte) error {
+	return d.unmarshal(b, "")
+}
+
+// unmarshal decodes details whose decimal amount is in the given currency
+func (d *Details) unmarshal(b []byte, currency string) error {
+	type details Details // without methods, to avoid recursion
+	aux := struct {
+		*details
+		Amount jsonAmount `json:"amount"`
+	}{details: (*details)(d)}
+
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	amount, err := aux.Amount.minor(d.Amount, currency)
+	if err != nil {
+		return err
+	}
+	d.Amount = amount
+
+	return nil
+}
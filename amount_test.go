@@ -0,0 +1,118 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	valid := map[string]int64{
+		"30.00":                 3000,
+		"-30.00":                -3000,
+		"+30.5":                 3050,
+		"0.07":                  7,
+		"-0.07":                 -7,
+		"1234":                  123400,
+		"92233720368547758.07":  math.MaxInt64,
+		"-92233720368547758.08": math.MinInt64,
+	}
+
+	for s, expected := range valid {
+		if a, err := ParseAmount(s); err != nil {
+			t.Fatalf("Expected %s to be parsed but got %v", s, err)
+		} else if a != expected {
+			t.Fatalf("Expected %s to be parsed as %d but got %d", s, expected, a)
+		}
+	}
+
+	invalid := []string{"", "-", ".50", "30.", "30.005", "3o.00", "1,00", "92233720368547758.08"}
+	for _, s := range invalid {
+		if _, err := ParseAmount(s); !errors.Is(err, ErrInvalidAmount) {
+			t.Fatalf("Expected %q to be rejected but got %v", s, err)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	expected := map[int64]string{
+		3000:          "30.00",
+		-3000:         "-30.00",
+		7:             "0.07",
+		-7:            "-0.07",
+		0:             "0.00",
+		math.MinInt64: "-92233720368547758.08",
+	}
+
+	for a, s := range expected {
+		if got := FormatAmount(a); got != s {
+			t.Fatalf("Expected %d to be formatted as %s but got %s", a, s, got)
+		}
+
+		if back, err := ParseAmount(FormatAmount(a)); err != nil || back != a {
+			t.Fatalf("Expected %d to round-trip but got %d (%v)", a, back, err)
+		}
+	}
+}
+
+func TestAmountDecimals(t *testing.T) {
+	defer func(decimals int) { AmountDecimals = decimals }(AmountDecimals)
+	AmountDecimals = 0
+
+	if a, err := ParseAmount("1500"); err != nil || a != 1500 {
+		t.Fatalf("Expected zero decimals amount to be parsed as 1500 but got %d (%v)", a, err)
+	}
+
+	if _, err := ParseAmount("1500.5"); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("Expected fractional amount to be rejected but got %v", err)
+	}
+
+	if s := FormatAmount(-1500); s != "-1500" {
+		t.Fatalf("Expected zero decimals amount to be formatted as -1500 but got %s", s)
+	}
+}
+
+func TestCurrencyScale(t *testing.T) {
+	if a, err := ParseAmountIn("1500", "JPY"); err != nil || a != 1500 {
+		t.Fatalf("Expected JPY amount to be parsed as 1500 but got %d (%v)", a, err)
+	}
+
+	if _, err := ParseAmountIn("1500.50", "JPY"); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("Expected fractional JPY amount to be rejected but got %v", err)
+	}
+
+	if s := FormatAmountIn(1500, "jpy"); s != "1500" {
+		t.Fatalf("Expected JPY amount to be formatted as 1500 but got %s", s)
+	}
+
+	if a, err := ParseAmountIn("-1.250", "BHD"); err != nil || a != -1250 {
+		t.Fatalf("Expected BHD amount to be parsed as -1250 but got %d (%v)", a, err)
+	}
+
+	if s := FormatAmountIn(-1250, "BHD"); s != "-1.250" {
+		t.Fatalf("Expected BHD amount to be formatted as -1.250 but got %s", s)
+	}
+
+	if s := FormatAmountIn(-1250, "RON"); s != "-12.50" {
+		t.Fatalf("Expected unlisted currency to fall back to AmountDecimals but got %s", s)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Attachment is a file attached to a transaction (e.g. the receipt) which is
+// either stored as it is or referenced by its URI
+type Attachment struct {
+	UUID            *string   `json:"uuid,omitempty" gorm:"type: varchar(36); primaryKey"`
+	TransactionUUID string    `json:"-" gorm:"type: varchar(36); index; not null"`
+	Filename        string    `json:"filename" gorm:"type: varchar(255); not null"`
+	Mime            string    `json:"mime" gorm:"type: varchar(100); not null"`
+	Data            []byte    `json:"data,omitempty"`
+	URI             string    `json:"uri,omitempty" gorm:"type: text; not null"`
+	CreatedAt       time.Time `json:"-" gorm:"autoCreateTime"`
+}
+
+// BeforeCreate hook from GORM to generate an UUID just before creating the
+// new entry for the attachment, and to check it has a filename
+func (a *Attachment) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.UUID == nil || *a.UUID == "" {
+		pk := UUIDFunc()
+		a.UUID = &pk
+	}
+
+	if a.Filename == "" {
+		return fmt.Errorf("attachment filename %w", ErrEmptyName)
+	}
+
+	return nil
+}
+
+// Attachments is a collection of files attached to transactions
+type Attachments []Attachment
+
+// Attach stores the attachments for the transaction with the given UUID.
+// If there's no such transaction, ErrNotFound is returned instead
+func (a *Attachments) Attach(ctx PushContext, uuid string) error {
+	db, err := withTableSuffix(ctx.Storage, ctx.TableSuffix)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var trx Transaction
+		if err := tx.Select("uuid").Where("uuid = ?", uuid).First(&trx).Error; err != nil {
+			return notFound(err, "transaction", uuid)
+		}
+
+		for i := range *a {
+			(*a)[i].TransactionUUID = uuid
+		}
+
+		return tx.CreateInBatches(a, ctx.BatchSize).Error
+	})
+}
+
+// List reads the attachments of the transaction with the given UUID, in
+// the order they were attached
+func (a *Attachments) List(ctx PullContext, uuid string) error {
+	return ctx.reader().Where("transaction_uuid = ?", uuid).Order("created_at, filename").Find(a).Error
+}
+
+// Detach removes an attachment by its UUID. If there's no such attachment,
+// ErrNotFound is returned instead
+func (a *Attachments) Detach(ctx PushContext, uuid string) error {
+	q := ctx.Storage.Where("uuid = ?", uuid).Delete(&Attachment{})
+	if q.Error != nil {
+		return q.Error
+	} else if q.RowsAffected == 0 {
+		return notFound(gorm.ErrRecordNotFound, "attachment", uuid)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testAttachments(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trxs := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	receipts := Attachments{
+		{Filename: "bon-1.jpg", Mime: "image/jpeg", Data: []byte{0xff, 0xd8, 0xff}},
+		{Filename: "bon-2.pdf", Mime: "application/pdf", URI: "s3://receipts/bon-2.pdf"},
+	}
+	if err := receipts.Attach(PushContext{Storage: db, BatchSize: 10}, *trxs[0].UUID); err != nil {
+		t.Fatal(err)
+	}
+
+	var listed Attachments
+	if err := listed.List(PullContext{Storage: db}, *trxs[0].UUID); err != nil {
+		t.Fatal(err)
+	} else if len(listed) != 2 {
+		t.Fatalf("Expected 2 attachments but got %d", len(listed))
+	} else if listed[0].Filename != "bon-1.jpg" || string(listed[0].Data) != "\xff\xd8\xff" {
+		t.Fatalf("Expected the stored receipt but got %v", listed[0])
+	} else if listed[1].Filename != "bon-2.pdf" || listed[1].URI != "s3://receipts/bon-2.pdf" {
+		t.Fatalf("Expected the referenced receipt but got %v", listed[1])
+	}
+
+	if err := (&Attachments{}).Detach(PushContext{Storage: db}, *listed[0].UUID); err != nil {
+		t.Fatal(err)
+	} else if err := (&Attachments{}).Detach(PushContext{Storage: db}, *listed[0].UUID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected a detached attachment to be gone but got %v", err)
+	}
+
+	// listing is a read, so it goes to the replica (if any)
+	var left Attachments
+	if err := left.List(PullContext{ReadStorage: db}, *trxs[0].UUID); err != nil {
+		t.Fatal(err)
+	} else if len(left) != 1 || left[0].Filename != "bon-2.pdf" {
+		t.Fatalf("Expected only the second receipt to be left but got %v", left)
+	}
+
+	orphans := Attachments{{Filename: "bon-3.jpg", Mime: "image/jpeg"}}
+	if err := orphans.Attach(PushContext{Storage: db, BatchSize: 10}, "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected attaching to an unknown transaction to fail but got %v", err)
+	}
+}
+
+func TestAttachments_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testAttachments(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestAttachments_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testAttachments(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestAttachments_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testAttachments(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
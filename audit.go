@@ -0,0 +1,58 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import "gorm.io/gorm/clause"
+
+// IntegrityIssue is a transaction whose stored details don't add up to its
+// (absolute) amount, e.g. because of manual edits of the database
+type IntegrityIssue struct {
+	UUID       string `json:"uuid"`
+	Amount     int64  `json:"amount"`
+	DetailsSum int64  `json:"details_sum"`
+}
+
+// AuditDetails checks every transaction with details within the window of
+// dates (if any) and returns the ones whose details don't add up, ordered
+// by UUID. Transactions without details are never reported
+func (t *Transactions) AuditDetails(ctx PullContext) ([]IntegrityIssue, error) {
+	db, err := withTableSuffix(ctx.reader(), ctx.TableSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, details := tableOf(db, &Transaction{}), tableOf(db, &Details{})
+	column := func(table, name string) clause.Column {
+		return clause.Column{Table: table, Name: name}
+	}
+
+	var issues []IntegrityIssue
+	err = ctx.transactions(db.Model(&Transaction{})).
+		Select("?, ?, SUM(?) AS details_sum",
+			column(transactions, "uuid"), column(transactions, "amount"), column(details, "amount")).
+		Joins("JOIN ? ON ? = ?", clause.Table{Name: details},
+			column(details, "transaction_uuid"), column(transactions, "uuid")).
+		Group(db.Statement.Quote(column(transactions, "uuid"))).
+		Having("SUM(?) <> ABS(?)", column(details, "amount"), column(transactions, "amount")).
+		Order(clause.OrderByColumn{Column: column(transactions, "uuid")}).
+		Scan(&issues).Error
+
+	return issues, err
+}
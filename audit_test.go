@@ -0,0 +1,94 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func testAuditDetails(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trxs := Transactions{
+		NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"),
+			map[Label]int64{NewLabel("Pâine", nil): 1000, NewLabel("Apă", nil): 2000}, ""),
+		NewTransaction(date, 1500, NewLabel("Rambursare", nil), NewActor("Magazin"), NewActor("Alexandru"),
+			map[Label]int64{NewLabel("Pâine", nil): 1500}, ""),
+		NewTransaction(date, -700, NewLabel("Transport", nil), NewActor("Alexandru"), NewActor("Autobuz"), nil, ""),
+	}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if issues, err := trxs.AuditDetails(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(issues) != 0 {
+		t.Fatalf("Expected no integrity issues, got %v", issues)
+	}
+
+	// a manual edit of the database bypasses the hooks
+	bad := Details{UUID: new(string), TransactionUUID: *trxs[0].UUID, LabelName: "Pâine", Amount: 999}
+	*bad.UUID = UUIDFunc()
+	if err := db.Session(&gorm.Session{SkipHooks: true}).Create(&bad).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := trxs.AuditDetails(PullContext{Storage: db})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(issues) != 1 {
+		t.Fatalf("Expected one integrity issue, got %v", issues)
+	}
+
+	expected := IntegrityIssue{UUID: *trxs[0].UUID, Amount: -3000, DetailsSum: 3999}
+	if issues[0] != expected {
+		t.Fatalf("Expected integrity issue %+v but got %+v instead", expected, issues[0])
+	}
+
+	// an audit is a read, so it goes to the replica (if any)
+	if issues, err := trxs.AuditDetails(PullContext{ReadStorage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(issues) != 1 || issues[0] != expected {
+		t.Fatalf("Expected integrity issue %+v on the replica, got %v", expected, issues)
+	}
+}
+
+func TestAuditDetails_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testAuditDetails(t, db)
+}
+
+func TestAuditDetails_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testAuditDetails(t, db)
+}
+
+func TestAuditDetails_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testAuditDetails(t, db)
+}
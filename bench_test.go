@@ -0,0 +1,156 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// benchmarks run against their own in-memory SQLite database, which is
+// reinstalled between iterations, so every push starts from the same state
+func beginBench(b *testing.B) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:bench?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	Install(db)
+	b.Cleanup(func() { end(db) })
+
+	return db
+}
+
+// benchTransactions makes n transactions between a handful of actors, each
+// with two details labelled within a small tree of labels
+func benchTransactions(n int) Transactions {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+
+	root := NewLabel("Cheltuieli", nil)
+	groups := make([]Label, 10)
+	for i := range groups {
+		groups[i] = NewLabel(fmt.Sprintf("Grupa %02d", i), &root)
+	}
+
+	trxs := make(Transactions, n)
+	for i := range trxs {
+		group := groups[i%len(groups)]
+		details := map[Label]int64{
+			NewLabel(fmt.Sprintf("%s/Eticheta %03d", group.Name, i%100), &group):   1000,
+			NewLabel(fmt.Sprintf("%s/Eticheta %03d", group.Name, i%100+1), &group): 2000,
+		}
+		trxs[i] = NewTransaction(date.AddDate(0, 0, i%365), -3000, group,
+			NewActor("Alexandru"), NewActor(fmt.Sprintf("Magazin %02d", i%50)), details, "")
+	}
+
+	return trxs
+}
+
+func benchmarkTransactionsPush(b *testing.B, n, batchSize int) {
+	db := beginBench(b)
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		Uninstall(db)
+		Install(db)
+		trxs := benchTransactions(n)
+		b.StartTimer()
+
+		if err := trxs.Push(PushContext{Storage: db, BatchSize: batchSize}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTransactionsPush(b *testing.B) {
+	for _, n := range []int{100, 1000} {
+		for _, batchSize := range []int{1, 10, 100, 500} {
+			b.Run(fmt.Sprintf("n=%d/batch=%d", n, batchSize), func(b *testing.B) {
+				benchmarkTransactionsPush(b, n, batchSize)
+			})
+		}
+	}
+}
+
+func BenchmarkTransactionsPull(b *testing.B) {
+	db := beginBench(b)
+
+	trxs := benchTransactions(1000)
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 100}); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, limit := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("limit=%d", limit), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var pulled Transactions
+				if err := pulled.Pull(PullContext{Storage: db, Limit: limit}); err != nil {
+					b.Fatal(err)
+				} else if len(pulled) != limit {
+					b.Fatalf("Expected %d transactions, got %d", limit, len(pulled))
+				}
+			}
+		})
+	}
+}
+
+// benchDeepTree makes a chain of depth labels with a few leaves under each
+// of them, so most labels share the same long list of ancestors
+func benchDeepTree(depth int) []Label {
+	parents := make([]*Label, depth)
+	for i := range parents {
+		lb := NewLabel(fmt.Sprintf("Nivel %03d", i), nil)
+		if i > 0 {
+			lb.Parent = parents[i-1]
+		}
+		parents[i] = &lb
+	}
+
+	var leaves []Label
+	for i, parent := range parents {
+		for j := 0; j < 5; j++ {
+			leaves = append(leaves, NewLabel(fmt.Sprintf("Nivel %03d/Frunza %d", i, j), parent))
+		}
+	}
+
+	return leaves
+}
+
+func BenchmarkLabelSetCatch(b *testing.B) {
+	leaves := benchDeepTree(100)
+
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				labels := newLabelSet()
+				for j := 0; j < n; j++ {
+					labels.catch(leaves[j%len(leaves)])
+				}
+			}
+		})
+	}
+}
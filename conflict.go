@@ -0,0 +1,121 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConflictMode is how a push treats the records already in registry, i.e.
+// the ones with the same key (name or UUID) as the pushed ones
+type ConflictMode int
+
+const (
+	ConflictUpdateAll     ConflictMode = iota // update them, which is the default
+	ConflictDoNothing                         // keep them as they are (see JustAppend)
+	ConflictUpdateIfNewer                     // update them unless they were updated after the pushed ones
+	ConflictError                             // fail the push with ErrConflict
+)
+
+// conflictMode returns the mode of a push, where JustAppend is an alias of
+// ConflictDoNothing
+func (ctx PushContext) conflictMode() ConflictMode {
+	if ctx.JustAppend {
+		return ConflictDoNothing
+	}
+
+	return ctx.OnConflict
+}
+
+// onConflict builds the clause of a push updating the columns of records
+// already in registry, along with the extra assignments (if any). When only
+// newer records update, every assignment keeps its old value otherwise and
+// updated_at is always the last one, since MySQL sees the values assigned
+// before it instead of the old ones
+func (ctx PushContext) onConflict(model interface{}, key string, cols []string, extra ...clause.Assignment) clause.OnConflict {
+	updates := append(clause.AssignmentColumns(cols), extra...)
+	for i := range updates {
+		if col, ok := updates[i].Value.(clause.Column); ok && col.Table == "excluded" {
+			updates[i].Value = excluded(ctx.Storage, col.Name)
+		}
+	}
+
+	if ctx.conflictMode() == ConflictUpdateIfNewer {
+		table := tableOf(ctx.Storage, model)
+		newer := func(value interface{}, col string) clause.Expression {
+			return gorm.Expr("CASE WHEN ? < ? THEN ? ELSE ? END",
+				clause.Column{Table: table, Name: "updated_at"}, excluded(ctx.Storage, "updated_at"),
+				value, clause.Column{Table: table, Name: col})
+		}
+
+		conditional := make([]clause.Assignment, 0, len(updates)+1)
+		for _, u := range updates {
+			if u.Column.Name != "updated_at" {
+				conditional = append(conditional, clause.Assignment{Column: u.Column, Value: newer(u.Value, u.Column.Name)})
+			}
+		}
+		updates = append(conditional, clause.Assignment{
+			Column: clause.Column{Name: "updated_at"},
+			Value:  newer(excluded(ctx.Storage, "updated_at"), "updated_at"),
+		})
+	}
+
+	return clause.OnConflict{Columns: []clause.Column{{Name: key}}, DoUpdates: updates}
+}
+
+// excluded refers to the pushed value of a column on conflict, which MySQL
+// spells differently
+func excluded(db *gorm.DB, column string) interface{} {
+	if db.Dialector.Name() == "mysql" {
+		return gorm.Expr("VALUES(?)", clause.Column{Name: column})
+	}
+
+	return clause.Column{Table: "excluded", Name: column}
+}
+
+// conflicting fails with ErrConflict if any of the names is already in the
+// registry (see ConflictError)
+func conflicting(db *gorm.DB, model interface{}, entity string, names []string) error {
+	missing, err := missingNames(db, model, names)
+	if err != nil {
+		return err
+	}
+
+	absent := make(map[string]bool, len(missing))
+	for _, name := range missing {
+		absent[name] = true
+	}
+
+	var found []string
+	for _, name := range names {
+		if !absent[name] {
+			found = append(found, name)
+		}
+	}
+
+	if len(found) > 0 {
+		return fmt.Errorf("%s %v: %w", entity, found, ErrConflict)
+	}
+
+	return nil
+}
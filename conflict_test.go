@@ -0,0 +1,236 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testActorsConflictModes(t *testing.T, db *gorm.DB) {
+	if err := (&Actors{NewActor("Magazin")}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := (&Actors{}).Get(PullContext{Storage: db}, "Magazin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, step := range []struct {
+		mode    ConflictMode
+		updated time.Time
+		flags   uint16
+	}{
+		{ConflictDoNothing, time.Time{}, 0},
+		{ConflictUpdateIfNewer, stored.UpdatedAt.Add(-time.Hour), 0},
+		{ConflictUpdateIfNewer, stored.UpdatedAt.Add(time.Hour), 3},
+		{ConflictUpdateAll, time.Time{}, 4},
+	} {
+		actor := NewActor("Magazin")
+		actor.Flags, actor.UpdatedAt = uint16(i+1), step.updated
+		if err := (&Actors{actor}).Push(PushContext{Storage: db, BatchSize: 10, OnConflict: step.mode}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, err := (&Actors{}).Get(PullContext{Storage: db}, "Magazin"); err != nil {
+			t.Fatal(err)
+		} else if got.Flags != step.flags {
+			t.Fatalf("Expected flags %d after push #%d, got %d", step.flags, i, got.Flags)
+		}
+	}
+
+	strict := PushContext{Storage: db, BatchSize: 10, OnConflict: ConflictError}
+	if err := (&Actors{NewActor("Piață"), NewActor("Magazin")}).Push(strict); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected push of an existing actor to fail with ErrConflict, got %v", err)
+	} else if ok, _ := (&Actors{}).Exists(PullContext{Storage: db}, "Piață"); ok {
+		t.Fatal("Expected failed push not to create any actor")
+	}
+
+	if err := (&Actors{NewActor("Piață")}).Push(strict); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testLabelsConflictModes(t *testing.T, db *gorm.DB) {
+	root := NewLabel("Cheltuieli", nil)
+	if err := (&Labels{NewLabel("Alimente", &root)}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := (&Labels{}).Get(PullContext{Storage: db}, "Alimente")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	older := NewLabel("Alimente", nil)
+	older.Flags, older.UpdatedAt = 1, stored.UpdatedAt.Add(-time.Hour)
+	if err := (&Labels{older}).Push(PushContext{Storage: db, BatchSize: 10, OnConflict: ConflictUpdateIfNewer}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := (&Labels{}).Get(PullContext{Storage: db}, "Alimente"); err != nil {
+		t.Fatal(err)
+	} else if got.Flags != 0 || got.ParentName.String != "Cheltuieli" {
+		t.Fatalf("Expected label not to be updated by an older one, got %v", got)
+	}
+
+	newer := NewLabel("Alimente", nil)
+	newer.Flags, newer.UpdatedAt = 1, stored.UpdatedAt.Add(time.Hour)
+	if err := (&Labels{newer}).Push(PushContext{Storage: db, BatchSize: 10, OnConflict: ConflictUpdateIfNewer}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := (&Labels{}).Get(PullContext{Storage: db}, "Alimente"); err != nil {
+		t.Fatal(err)
+	} else if got.Flags != 1 || got.ParentName.Valid {
+		t.Fatalf("Expected label to be updated by a newer one, got %v", got)
+	}
+
+	// the parents of pushed labels may be in registry already
+	strict := PushContext{Storage: db, BatchSize: 10, OnConflict: ConflictError}
+	if err := (&Labels{NewLabel("Alimente", nil)}).Push(strict); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected push of an existing label to fail with ErrConflict, got %v", err)
+	} else if err := (&Labels{NewLabel("Transport", &root)}).Push(strict); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testTransactionsConflictModes(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trxs := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := (&Transactions{}).Get(PullContext{Storage: db}, *trxs[0].UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, step := range []struct {
+		updated time.Time
+		flags   uint16
+		version uint
+	}{
+		{stored.UpdatedAt.Add(-time.Hour), 0, 0},
+		{stored.UpdatedAt.Add(time.Hour), 2, 1},
+	} {
+		trx := *stored
+		trx.Flags, trx.UpdatedAt, trx.Details = uint16(i+1), step.updated, nil
+		pushed := Transactions{trx}
+		if err := pushed.Push(PushContext{Storage: db, BatchSize: 10, OnConflict: ConflictUpdateIfNewer}); err != nil {
+			t.Fatal(err)
+		} else if pushed[0].Version != step.version {
+			t.Fatalf("Expected version %d after push #%d, got %d", step.version, i, pushed[0].Version)
+		}
+
+		if got, err := (&Transactions{}).Get(PullContext{Storage: db}, *trx.UUID); err != nil {
+			t.Fatal(err)
+		} else if got.Flags != step.flags || got.Version != step.version {
+			t.Fatalf("Expected flags %d and version %d after push #%d, got %d and %d",
+				step.flags, step.version, i, got.Flags, got.Version)
+		}
+	}
+
+	strict := PushContext{Storage: db, BatchSize: 10, OnConflict: ConflictError}
+	if err := (&Transactions{*stored}).Push(strict); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected push of an existing transaction to fail with ErrConflict, got %v", err)
+	}
+
+	fresh := Transactions{NewTransaction(date, -1500, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"), nil, "")}
+	if err := fresh.Push(strict); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestActorsConflictModes_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testActorsConflictModes(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestLabelsConflictModes_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testLabelsConflictModes(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestTransactionsConflictModes_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testTransactionsConflictModes(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestActorsConflictModes_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testActorsConflictModes(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestLabelsConflictModes_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testLabelsConflictModes(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestTransactionsConflictModes_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testTransactionsConflictModes(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestActorsConflictModes_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testActorsConflictModes(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestLabelsConflictModes_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testLabelsConflictModes(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestTransactionsConflictModes_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testTransactionsConflictModes(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// dialectors returns a throwaway dialector for each supported database,
+// none of which needs an actual server to build statements
+var dialectors = map[string]func() gorm.Dialector{
+	"sqlite": func() gorm.Dialector {
+		return sqlite.Open("file::memory:")
+	},
+	"postgres": func() gorm.Dialector {
+		return postgres.New(postgres.Config{DSN: "host=localhost"})
+	},
+	"mysql": func() gorm.Dialector {
+		return mysql.New(mysql.Config{DSN: "tcp(localhost)/expenses", SkipInitializeWithVersion: true})
+	},
+}
+
+// SchemaDDL returns the statements Install would run on an empty database
+// of the given dialect (sqlite, postgres or mysql), keyed by table name, so
+// schema changes can be reviewed and kept under version control. Nothing is
+// run, as the statements are captured from a dry run of the migrator
+func SchemaDDL(dialect string) (map[string]string, error) {
+	open, ok := dialectors[dialect]
+	if !ok {
+		return nil, fmt.Errorf("unsupported dialect %q", dialect)
+	}
+
+	db, err := gorm.Open(open(), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		return nil, err
+	}
+	defer Close(db)
+
+	ddl := make(map[string]string, len(tables))
+	for _, table := range tables {
+		capture := &queryCapture{Interface: db.Logger}
+		if err := db.Session(&gorm.Session{Logger: capture}).Migrator().CreateTable(table); err != nil {
+			return nil, err
+		}
+
+		// indexes are created in no particular order, so they're sorted to
+		// keep the statements stable (e.g. for diffs)
+		if len(capture.sqls) > 1 {
+			sort.Strings(capture.sqls[1:])
+		}
+		ddl[tableOf(db, table)] = strings.Join(capture.sqls, ";\n")
+	}
+
+	return ddl, nil
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaDDL(t *testing.T) {
+	ddl, err := SchemaDDL("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"actors", "labels", "transactions", "details"} {
+		stmt, ok := ddl[table]
+		if !ok || !strings.Contains(stmt, "CREATE TABLE `"+table+"`") {
+			t.Fatalf("Expected CREATE TABLE statement for %s, got %q", table, stmt)
+		}
+	}
+
+	for _, table := range []string{"transactions", "details"} {
+		if !strings.Contains(ddl[table], "PRIMARY KEY (`uuid`)") {
+			t.Fatalf("Expected UUID primary key for %s, got %q", table, ddl[table])
+		}
+	}
+
+	if _, err := SchemaDDL("oracle"); err == nil {
+		t.Fatal("Expected unsupported dialect to fail")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import "bytes"
+
+// DiffTransactions compares two snapshots of transactions keyed by their
+// UUID (e.g. local and remote, before a selective push). Transactions only
+// in b are added, the ones only in a are removed, while changed are the ones
+// of b whose mutable fields (i.e. the ones a push updates) differ from a.
+// Transactions without an UUID can't be matched, so they're ignored
+func DiffTransactions(a, b Transactions) (added, removed, changed Transactions) {
+	before := make(map[string]*Transaction, len(a))
+	for i := range a {
+		if a[i].UUID != nil {
+			before[*a[i].UUID] = &a[i]
+		}
+	}
+
+	after := make(map[string]bool, len(b))
+	for _, trx := range b {
+		if trx.UUID == nil {
+			continue
+		}
+		after[*trx.UUID] = true
+
+		if old, ok := before[*trx.UUID]; !ok {
+			added = append(added, trx)
+		} else if !sameMutableFields(old, &trx) {
+			changed = append(changed, trx)
+		}
+	}
+
+	for _, trx := range a {
+		if trx.UUID != nil && !after[*trx.UUID] {
+			removed = append(removed, trx)
+		}
+	}
+
+	return added, removed, changed
+}
+
+// sameMutableFields checks whether two versions of a transaction have the
+// same fields that a push updates (see Transactions.Push)
+func sameMutableFields(x, y *Transaction) bool {
+	return labelName(x.LabelName, x.Label) == labelName(y.LabelName, y.Label) &&
+		actorName(x.SenderName, x.Sender) == actorName(y.SenderName, y.Sender) &&
+		actorName(x.ReceiverName, x.Receiver) == actorName(y.ReceiverName, y.Receiver) &&
+		x.Currency == y.Currency && x.Flags == y.Flags && x.Headers == y.Headers && bytes.Equal(x.Meta, y.Meta)
+}
+
+// labelName returns the name of a label referenced either by name or by the
+// associated struct
+func labelName(name string, label *Label) string {
+	if name == "" && label != nil {
+		return label.Name
+	}
+
+	return name
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDiffTransactions(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	withUUID := func(uuid string, amount int64, label string) Transaction {
+		trx := NewTransaction(date, amount, NewLabel(label, nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")
+		trx.UUID = &uuid
+		return trx
+	}
+
+	local := Transactions{
+		withUUID("1", -1000, "Alimente"),
+		withUUID("2", -2000, "Alimente"),
+		withUUID("3", -3000, "Alimente"),
+	}
+
+	modified := withUUID("2", -2000, "Transport")
+	modified.Flags = FlagOutflow
+	remote := Transactions{
+		withUUID("1", -1000, "Alimente"),
+		modified,
+		withUUID("4", -4000, "Alimente"),
+	}
+
+	added, removed, changed := DiffTransactions(local, remote)
+
+	uuids := func(trxs Transactions) string {
+		var out []string
+		for _, trx := range trxs {
+			out = append(out, *trx.UUID)
+		}
+		return fmt.Sprint(out)
+	}
+
+	if uuids(added) != "[4]" {
+		t.Fatalf("Expected transaction 4 to be added but got %s", uuids(added))
+	} else if uuids(removed) != "[3]" {
+		t.Fatalf("Expected transaction 3 to be removed but got %s", uuids(removed))
+	} else if uuids(changed) != "[2]" {
+		t.Fatalf("Expected transaction 2 to be changed but got %s", uuids(changed))
+	} else if changed[0].Label.Name != "Transport" {
+		t.Fatalf("Expected the changed transaction to be the remote one but got %v", changed[0])
+	}
+
+	// the same label referenced by name is no change
+	byName := withUUID("1", -1000, "")
+	byName.Label, byName.LabelName = nil, "Alimente"
+	if _, _, changed := DiffTransactions(local[:1], Transactions{byName}); len(changed) != 0 {
+		t.Fatalf("Expected no change for a label referenced by name but got %v", changed)
+	}
+}
@@ -20,15 +20,25 @@
 package expenses
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 const (
@@ -36,6 +46,83 @@ const (
 	DateFormat = "Mon 02 Jan 2006" // Layout used instead of "d m Y" abbr
 )
 
+// FlagNonExpense is a conventional label flag for non-expense movements of
+// money (e.g. internal transfers) which don't count toward spending. It's
+// the highest bit of Flags, so it's unlikely to clash with other flags
+const FlagNonExpense uint16 = 1 << 15
+
+// FlagOutflow is a conventional transaction flag hinting that the amount is
+// an expense regardless of its sign, e.g. for imports which write outflows
+// as positive amounts with a separate direction (see ForceExpensesNegative)
+const FlagOutflow uint16 = 1 << 14
+
+var (
+	// ErrNotFound is returned when a single record lookup has no match
+	ErrNotFound = errors.New("record not found")
+
+	// ErrEmptyName is returned when an actor or a label has no name
+	ErrEmptyName = errors.New("cannot have an empty name")
+
+	// ErrDetailsMismatch is returned when the details of a transaction
+	// don't add up to its (absolute) amount
+	ErrDetailsMismatch = errors.New("transaction details don't add up")
+
+	// ErrNegativeDetail is returned when details have a negative amount
+	ErrNegativeDetail = errors.New("details amount cannot be negative")
+
+	// ErrLabelCycle is returned when a label is its own ancestor
+	ErrLabelCycle = errors.New("label has a cycle")
+
+	// ErrMissingDetails is returned when a transaction has no details but
+	// they are required (see PushContext.RequireDetails)
+	ErrMissingDetails = errors.New("requires details")
+
+	// ErrTooManyDetails is returned when a transaction has more details than
+	// allowed (see PushContext.MaxDetails)
+	ErrTooManyDetails = errors.New("has too many details")
+
+	// ErrDuplicateDetailLabel is returned when a transaction has more
+	// details with the same label but they are disallowed (see PushContext)
+	ErrDuplicateDetailLabel = errors.New("have duplicate label")
+
+	// ErrDetailLabelOutsideTree is returned when a detail label isn't under
+	// the transaction's label but it's required (see PushContext)
+	ErrDetailLabelOutsideTree = errors.New("not under the transaction label")
+
+	// ErrInvalidStatus is returned when a status of reconciliation isn't
+	// any of the known ones (see Status)
+	ErrInvalidStatus = errors.New("invalid status")
+
+	// ErrMissingRate is returned when there's no exchange rate for the
+	// currency of some transactions (see TotalsInCurrency)
+	ErrMissingRate = errors.New("missing exchange rate")
+
+	// ErrStaleVersion is returned when a transaction was changed by someone
+	// else since it was read, so pushing it would overwrite that change
+	ErrStaleVersion = errors.New("is stale")
+
+	// ErrConflict is returned when pushed records are already in registry
+	// but the push must not touch them (see ConflictError)
+	ErrConflict = errors.New("already exists")
+
+	// ErrMalformedHeader is returned when headers don't parse into key=value
+	// pairs but they are validated (see ParseHeaders)
+	ErrMalformedHeader = errors.New("malformed header")
+
+	// ErrUnknownLabel is returned when a referenced label cannot be resolved
+	ErrUnknownLabel = errors.New("unknown label")
+
+	// ErrUnknownActor is returned when a referenced actor doesn't exist
+	ErrUnknownActor = errors.New("unknown actor")
+
+	// ErrInvalidAmount is returned when an amount cannot be parsed
+	ErrInvalidAmount = errors.New("invalid amount")
+
+	// ErrAmountOverflow is returned when an amount (or the sum of details)
+	// doesn't fit into the 64 bits amounts are stored on
+	ErrAmountOverflow = errors.New("amount overflows int64")
+)
+
 // Registry is defined as an unified simplistic API developed to interact
 // with an underlaying persistence layer via only two routes. The concept
 // of the expenses module is visualy defined by its component parts below
@@ -75,8 +162,171 @@ type PushContext struct {
 	BatchSize int
 
 	// JustAppend is mostly used internally to upsert only and don't
-	// propage updates to all fields
+	// propage updates to all fields. It's an alias of ConflictDoNothing
 	JustAppend bool
+
+	// OnConflict is how records already in registry are treated, i.e. the
+	// ones with the same key as pushed ones. By default they're updated
+	// (see ConflictMode)
+	OnConflict ConflictMode
+
+	// UpdateColumns overrides the default columns updated on conflict
+	// (e.g. only "flags"). It's ignored when nothing is updated on conflict
+	// and each column must be known by the entity, otherwise push fails
+	UpdateColumns []string
+
+	// AutoCreateLabels enables the creation of labels referenced only by
+	// name in transaction details. When not set, such labels must either
+	// exist already or be part of the same push, otherwise push fails
+	AutoCreateLabels bool
+
+	// RequireExistingActors makes a transactions push fail if any of the
+	// referenced actors doesn't exist already, instead of creating it
+	RequireExistingActors bool
+
+	// RequireExistingLabels makes a transactions push fail if any of the
+	// referenced labels doesn't exist already, instead of creating it
+	RequireExistingLabels bool
+
+	// SkipInvalid makes a transactions push validate each transaction (and
+	// check it against the other options, e.g. MaxDetails) and push only
+	// the valid ones, instead of failing the whole push. Skipped
+	// transactions are left as they are and reported by PushWithResult
+	SkipInvalid bool
+
+	// RequireDetails makes a transactions push fail if any transaction
+	// has no details, for workflows where every amount must be itemized
+	RequireDetails bool
+
+	// DisallowDuplicateDetailLabels makes a transactions push fail if any
+	// transaction has more details with the same label (which is usually
+	// a mistake, as they should be merged)
+	DisallowDuplicateDetailLabels bool
+
+	// RequireDetailLabelsUnderTransactionLabel makes a transactions push
+	// fail if the label of any detail isn't the transaction's label or one
+	// of its descendants in the tree of labels
+	RequireDetailLabelsUnderTransactionLabel bool
+
+	// ValidateHeaders makes a transactions push fail if the headers of any
+	// transaction (or its details) don't parse into key=value pairs
+	ValidateHeaders bool
+
+	// MaxDetails makes a transactions push fail if any transaction has more
+	// details than this (e.g. untrusted payloads). Zero means no limit
+	MaxDetails int
+
+	// SkipDedupe makes a labels push write the collection as it is, without
+	// deduplicating it (and its parents) first. It saves time and memory on
+	// large batches, but the caller is then responsible for uniqueness
+	SkipDedupe bool
+
+	// Location is the time zone of the caller, if set. Since dates are
+	// stored without the time of day (and without any zone), each date is
+	// truncated to its calendar day in this zone instead of the zone it
+	// has (e.g. 01:30 at UTC+3 is stored as that day, not the day before
+	// as it would be after a conversion to UTC)
+	Location *time.Location
+
+	// ForceExpensesNegative makes the amount of transactions flagged with
+	// FlagOutflow negative before insert, since the sign of amounts tells
+	// incomes (positive) from expenses (negative)
+	ForceExpensesNegative bool
+
+	// IdempotencyKey identifies a batch of records (e.g. a message in an
+	// at-least-once delivery system). The key of a successful push is kept
+	// in the push log, so any later push with the same key does nothing
+	IdempotencyKey string
+
+	// PreserveTime keeps the time of day of transactions, which is dropped
+	// by default since dates are stored without it. Transactions pushed
+	// with it are pulled back with their full date and time
+	PreserveTime bool
+
+	// TableSuffix writes transactions (and their details) into a suffixed
+	// set of tables, e.g. "_2021" (see InstallWithSuffix)
+	TableSuffix string
+
+	// Observer is notified after each push, if set (see Observer)
+	Observer Observer
+
+	// Logger writes a structured record after each push, if set. Every
+	// push is logged at debug level, while failures at error level
+	Logger *slog.Logger
+}
+
+// observe reports a finished push of a registry to the observer and to
+// the logger, if any
+func (ctx PushContext) observe(entity string, reg Registry, start time.Time, err *error) {
+	n, d := count(reg), time.Since(start)
+	if ctx.Observer != nil {
+		ctx.Observer.ObservePush(entity, n, d, *err)
+	}
+
+	if ctx.Logger != nil {
+		attrs := []any{"entity", entity, "batch_size", ctx.BatchSize, "rows", n, "duration", d}
+		if *err != nil {
+			ctx.Logger.Error("push failed", append(attrs, "error", *err)...)
+		} else {
+			ctx.Logger.Debug("push", attrs...)
+		}
+	}
+}
+
+// UUIDFunc generates the primary keys of transactions and details. It
+// defaults to random (v4) UUIDs for compatibility, but it can be set to
+// NewUUIDv7 for time-sortable keys which keep the inserts index friendly
+var UUIDFunc = NewUUIDv4
+
+// NewUUIDv4 returns a random UUID
+func NewUUIDv4() string {
+	return uuid.New().String()
+}
+
+// NewUUIDv7 returns a time-ordered UUID (it falls back to a random one
+// in the unlikely case the clock sequence cannot be generated)
+func NewUUIDv7() string {
+	if id, err := uuid.NewV7(); err == nil {
+		return id.String()
+	}
+
+	return NewUUIDv4()
+}
+
+// pushContextKey is used to pass the PushContext down to the GORM hooks
+const pushContextKey = "expenses:push_context"
+
+// pushContextOf returns the PushContext of the push triggering a GORM hook
+// or the zero value if the hook wasn't triggered by a push
+func pushContextOf(tx *gorm.DB) PushContext {
+	if v, ok := tx.Get(pushContextKey); ok {
+		if ctx, ok := v.(PushContext); ok {
+			return ctx
+		}
+	}
+
+	return PushContext{}
+}
+
+// conflictColumns returns the columns to be updated on conflict, which are
+// either the entity's defaults or the ones explicitly requested by caller
+func (ctx PushContext) conflictColumns(model interface{}, defaults ...string) ([]string, error) {
+	if len(ctx.UpdateColumns) == 0 {
+		return defaults, nil
+	}
+
+	stmt := &gorm.Statement{DB: ctx.Storage}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+
+	for _, col := range ctx.UpdateColumns {
+		if _, ok := stmt.Schema.FieldsByDBName[col]; !ok {
+			return nil, fmt.Errorf("cannot update unknown column %s on conflict", col)
+		}
+	}
+
+	return ctx.UpdateColumns, nil
 }
 
 // PullContext is complement with PushContext (see above)
@@ -87,6 +337,11 @@ type PullContext struct {
 	// Storage is mainly Maria/MySQL with little support for SQLite
 	Storage *gorm.DB
 
+	// ReadStorage is a read replica of Storage, if set. The pulls of actors,
+	// labels and transactions go to it instead, while pushes always go to
+	// the primary (see PushContext.Storage)
+	ReadStorage *gorm.DB
+
 	// Limit is the equivalent of SQL LIMIT statement. By default it
 	// isn't set on query because of the default zero value
 	Limit int
@@ -94,6 +349,317 @@ type PullContext struct {
 	// Offset is the equivalent of SQL OFFSET statement on query. It
 	// is similar to Limit, by default it isn't set
 	Offset int
+
+	// From and To limit transactions to a window of dates (both ends
+	// inclusive). Either of them is ignored when it's the zero value
+	From, To time.Time
+
+	// LabelNames, SenderNames and ReceiverNames limit transactions to the
+	// ones with any of these labels, senders and receivers respectively.
+	// Each of them is ignored when it's empty (see also Query)
+	LabelNames, SenderNames, ReceiverNames []string
+
+	// Currencies limits transactions to the ones in any of these currencies
+	// (where "" is the one of transactions without a currency), e.g. for
+	// aggregations which add up amounts. It's ignored when it's empty
+	Currencies []string
+
+	// Observer is notified after each pull, if set (see Observer)
+	Observer Observer
+
+	// Logger writes a structured record after each pull, if set. Every
+	// pull is logged at debug level, while failures at error level
+	Logger *slog.Logger
+
+	// TableSuffix reads transactions (and their details) from a suffixed
+	// set of tables, e.g. "_2021" (see InstallWithSuffix)
+	TableSuffix string
+
+	// ExcludeNonExpenseLabels makes aggregations (e.g. MonthlyTotals) skip
+	// transactions whose label carries the FlagNonExpense flag
+	ExcludeNonExpenseLabels bool
+
+	// Preload selects the associations read along with transactions. By
+	// default only the details are read (see Preload)
+	Preload Preload
+
+	// PreloadLabelAncestors additionally reads the whole parent chain of
+	// the labels of transactions (and of their details), so each Label has
+	// its Parent pointers populated up to the root
+	PreloadLabelAncestors bool
+
+	// ChangedSince limits actors, labels and transactions to the ones
+	// updated after it (e.g. delta sync). It's ignored when it's zero
+	ChangedSince time.Time
+
+	// NamePrefix limits actors to the ones whose name starts with it (e.g.
+	// autocomplete). It's ignored when it's empty
+	NamePrefix string
+
+	// ExcludeFlags skips actors, labels and transactions which have any of
+	// these flags set (e.g. archived records)
+	ExcludeFlags uint16
+
+	// DetailFlags limits details to the ones which have all of these flags
+	// set, e.g. the reimbursable ones (see Transactions.PullDetails)
+	DetailFlags uint16
+
+	// OnlyWithoutDetails limits transactions to the ones which aren't
+	// itemized at all (e.g. data-quality checks), while OnlyWithDetails to
+	// the ones which are. Setting both of them matches nothing
+	OnlyWithoutDetails, OnlyWithDetails bool
+
+	// Statuses limits transactions to the ones in any of these statuses
+	// of reconciliation (see Status). It's ignored when it's empty
+	Statuses []Status
+
+	// HasTags limits transactions to the ones tagged with all of these tags
+	// (i.e. their intersection). It's ignored when it's empty
+	HasTags []string
+
+	// HasHeaderKey limits transactions to the ones with this key among
+	// their headers (e.g. "image" for the ones with a receipt attached),
+	// whatever its value. It's ignored when it's empty
+	HasHeaderKey string
+
+	// Location is the time zone of the caller, if set. The window of dates
+	// is applied on the calendar days of From and To in this zone, while
+	// the dates of transactions are pulled as midnight in this zone (see
+	// PushContext.Location)
+	Location *time.Location
+}
+
+// reader returns the database handle pulls go to (see ReadStorage)
+func (ctx PullContext) reader() *gorm.DB {
+	if ctx.ReadStorage != nil {
+		return ctx.ReadStorage
+	}
+
+	return ctx.Storage
+}
+
+// transactionsOrder sorts transactions by their descending date (and time
+// of day, if preserved) and amount, while the UUID makes it a total order
+// so pages (see Offset) neither repeat nor skip transactions
+const transactionsOrder = "date DESC, occurred_at DESC, amount DESC, uuid"
+
+// Preload selects the associations read along with transactions on pull
+type Preload int
+
+const (
+	PreloadDetails Preload = iota // details only, which is the default
+	PreloadNone                   // just the flat transactions, e.g. lists
+	PreloadAll                    // details with their labels and all actors
+)
+
+// preload applies the selected associations on the transactions query
+func (ctx PullContext) preload(q *gorm.DB) *gorm.DB {
+	switch ctx.Preload {
+	case PreloadNone:
+		return q
+	case PreloadAll:
+		return q.Preload("Label").Preload("Sender").Preload("Receiver").Preload("Details.Label")
+	default:
+		return q.Preload("Details")
+	}
+}
+
+// labelAncestors resolves the labels of transactions and of their details,
+// along with their parent chains, reading one level of the tree at a time
+func labelAncestors(db *gorm.DB, trxs Transactions) error {
+	labels := make(map[string]*Label)
+	var pending []string
+	want := func(name string) {
+		if _, ok := labels[name]; !ok && name != "" {
+			labels[name] = nil
+			pending = append(pending, name)
+		}
+	}
+
+	for _, trx := range trxs {
+		want(trx.LabelName)
+		for _, d := range trx.Details {
+			want(d.LabelName)
+		}
+	}
+
+	for len(pending) > 0 {
+		var level Labels
+		if err := db.Where("name IN ?", pending).Find(&level).Error; err != nil {
+			return err
+		}
+
+		pending = nil
+		for i := range level {
+			labels[level[i].Name] = &level[i]
+			if level[i].ParentName.Valid {
+				want(level[i].ParentName.String)
+			}
+		}
+	}
+
+	for _, lb := range labels {
+		if lb != nil && lb.ParentName.Valid {
+			lb.Parent = labels[lb.ParentName.String]
+		}
+	}
+
+	for i := range trxs {
+		if lb := labels[trxs[i].LabelName]; lb != nil {
+			trxs[i].Label = lb
+		}
+		for _, d := range trxs[i].Details {
+			if lb := labels[d.LabelName]; lb != nil {
+				d.Label = lb
+			}
+		}
+	}
+
+	return nil
+}
+
+// observe reports a finished pull of a registry to the observer and to
+// the logger, if any
+func (ctx PullContext) observe(entity string, reg Registry, start time.Time, err *error) {
+	n, d := count(reg), time.Since(start)
+	if ctx.Observer != nil {
+		ctx.Observer.ObservePull(entity, n, d, *err)
+	}
+
+	if ctx.Logger != nil {
+		attrs := []any{"entity", entity, "limit", ctx.Limit, "offset", ctx.Offset, "rows", n, "duration", d}
+		if *err != nil {
+			ctx.Logger.Error("pull failed", append(attrs, "error", *err)...)
+		} else {
+			ctx.Logger.Debug("pull", attrs...)
+		}
+	}
+}
+
+// transactions applies the window of dates, the names of labels and actors
+// and the currencies (if any) to a query on the transactions table
+func (ctx PullContext) transactions(q *gorm.DB) *gorm.DB {
+	if !ctx.From.IsZero() {
+		q = q.Where("date >= ?", dayIn(ctx.From, ctx.Location))
+	}
+
+	if !ctx.To.IsZero() {
+		q = q.Where("date <= ?", dayIn(ctx.To, ctx.Location))
+	}
+
+	// qualified, since details have labels as well when joined
+	table := tableOf(q, &Transaction{})
+	for _, filter := range []struct {
+		column string
+		names  []string
+	}{
+		{"label_name", ctx.LabelNames},
+		{"sender_name", ctx.SenderNames},
+		{"receiver_name", ctx.ReceiverNames},
+		{"currency", ctx.Currencies},
+	} {
+		if len(filter.names) > 0 {
+			q = q.Where("? IN ?", clause.Column{Table: table, Name: filter.column}, filter.names)
+		}
+	}
+
+	return q
+}
+
+// filtered applies every filter of transactions to a query on the
+// transactions table, so pulls and aggregations read the same transactions
+func (ctx PullContext) filtered(q *gorm.DB) *gorm.DB {
+	return ctx.headered(ctx.tagged(ctx.statused(ctx.itemized(ctx.flagged(ctx.changed(ctx.transactions(q)))))))
+}
+
+// dayIn returns the calendar day of a time in the given zone as midnight
+// UTC, which is how dates are stored. Without a zone the time is unchanged
+func dayIn(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		return t
+	}
+
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// itemized narrows down transactions to the ones with or without details
+func (ctx PullContext) itemized(q *gorm.DB) *gorm.DB {
+	if !ctx.OnlyWithoutDetails && !ctx.OnlyWithDetails {
+		return q
+	}
+
+	db := q.Session(&gorm.Session{NewDB: true})
+	transactions, details := tableOf(db, &Transaction{}), tableOf(db, &Details{})
+	exists := db.Model(&Details{}).Select("1").
+		Where("? = ?", clause.Column{Table: details, Name: "transaction_uuid"}, clause.Column{Table: transactions, Name: "uuid"})
+
+	if ctx.OnlyWithoutDetails {
+		q = q.Where("NOT EXISTS (?)", exists)
+	}
+
+	if ctx.OnlyWithDetails {
+		q = q.Where("EXISTS (?)", exists)
+	}
+
+	return q
+}
+
+// flagged skips records which have any of the excluded flags set
+func (ctx PullContext) flagged(q *gorm.DB) *gorm.DB {
+	if ctx.ExcludeFlags != 0 {
+		q = q.Where("flags & ? = 0", ctx.ExcludeFlags)
+	}
+
+	return q
+}
+
+// prefixed narrows down records to the ones whose name starts with the
+// prefix, where any wildcard of LIKE is matched literally
+func (ctx PullContext) prefixed(q *gorm.DB) *gorm.DB {
+	if ctx.NamePrefix != "" {
+		escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(ctx.NamePrefix)
+		q = q.Where("name LIKE ? ESCAPE '!'", escaped+"%")
+	}
+
+	return q
+}
+
+// changed narrows down records to the ones updated since the given time
+func (ctx PullContext) changed(q *gorm.DB) *gorm.DB {
+	if !ctx.ChangedSince.IsZero() {
+		q = q.Where("updated_at > ?", ctx.ChangedSince)
+	}
+
+	return q
+}
+
+// expenses narrows down the transactions to the ones which count toward
+// spending, i.e. the filtered ones (see filtered) without the ones with
+// non-expense labels, if so
+func (ctx PullContext) expenses(q *gorm.DB) *gorm.DB {
+	q = ctx.filtered(q)
+
+	if ctx.ExcludeNonExpenseLabels {
+		flagged := ctx.Storage.Model(&Label{}).Select("name").Where("flags & ? <> 0", FlagNonExpense)
+		q = q.Where("label_name NOT IN (?)", flagged)
+	}
+
+	return q
+}
+
+// Observer enables instrumentation (e.g. Prometheus counters and latencies)
+// of registry operations without the package depending on any such tool.
+// Each method is called once an operation is finished with the entity name
+// (actors, labels, transactions), the number of records and the duration
+type Observer interface {
+	ObservePush(entity string, n int, d time.Duration, err error)
+	ObservePull(entity string, n int, d time.Duration, err error)
+}
+
+// count returns the number of records in a registry collection
+func count(reg Registry) int {
+	return reflect.Indirect(reflect.ValueOf(reg)).Len()
 }
 
 // NullString is a compatible SQL and JSON structure, mostly added
@@ -125,13 +691,35 @@ type Actors []Actor
 
 // Push enables to write new actors into registry or updates the
 // fields of the existing ones if a *name* conflict occurs
-func (a *Actors) Push(ctx PushContext) error {
+func (a *Actors) Push(ctx PushContext) (err error) {
+	if ctx.IdempotencyKey != "" {
+		return ctx.once("actors", nil, a.Push)
+	}
+
+	defer ctx.observe("actors", a, time.Now(), &err)
+
 	q := ctx.Storage
 
-	if ctx.JustAppend {
+	switch mode := ctx.conflictMode(); {
+	case mode == ConflictError:
+		return q.Transaction(func(tx *gorm.DB) error {
+			if err := conflicting(tx, &Actor{}, "actors", a.names()); err != nil {
+				return err
+			}
+
+			return tx.CreateInBatches(a, ctx.BatchSize).Error
+		})
+	case mode == ConflictDoNothing:
 		q = q.Clauses(clause.OnConflict{DoNothing: true})
-	} else {
+	case mode == ConflictUpdateAll && len(ctx.UpdateColumns) == 0:
 		q = q.Clauses(clause.OnConflict{UpdateAll: true})
+	default:
+		cols, err := ctx.conflictColumns(&Actor{}, "flags", "headers", "updated_at")
+		if err != nil {
+			return err
+		}
+
+		q = q.Clauses(ctx.onConflict(&Actor{}, "name", cols))
 	}
 
 	return q.CreateInBatches(a, ctx.BatchSize).Error
@@ -139,12 +727,54 @@ func (a *Actors) Push(ctx PushContext) error {
 
 // Pull enables to read actors from registry. The results are
 // always sorted by their name
-func (a *Actors) Pull(ctx PullContext) error {
-	q := ctx.Storage.Order("name").Limit(ctx.Limit).Offset(ctx.Offset)
+func (a *Actors) Pull(ctx PullContext) (err error) {
+	defer ctx.observe("actors", a, time.Now(), &err)
+
+	q := ctx.prefixed(ctx.flagged(ctx.changed(ctx.reader())))
+
+	q = q.Order("name").Limit(ctx.Limit).Offset(ctx.Offset)
 
 	return q.Find(a).Error
 }
 
+// Exists checks whether an actor with the given name is already in the
+// registry without reading the actual record
+func (a *Actors) Exists(ctx PullContext, name string) (bool, error) {
+	return exists(ctx, &Actor{}, "name = ?", name)
+}
+
+// Get reads a single actor from registry by its name. If there's no such
+// actor, ErrNotFound is returned instead
+func (a *Actors) Get(ctx PullContext, name string) (*Actor, error) {
+	var actor Actor
+	if err := ctx.reader().Where("name = ?", name).First(&actor).Error; err != nil {
+		return nil, notFound(err, "actor", name)
+	}
+
+	return &actor, nil
+}
+
+// GetOrCreate ensures an actor with the given name is in the registry and
+// returns it as persisted, leaving an existing actor untouched
+func (a *Actors) GetOrCreate(ctx PushContext, name string) (*Actor, error) {
+	ctx.JustAppend = true
+	if err := (&Actors{NewActor(name)}).Push(ctx); err != nil {
+		return nil, err
+	}
+
+	return a.Get(PullContext{Storage: ctx.Storage}, name)
+}
+
+// names of the actors in the collection, in the same order
+func (a *Actors) names() []string {
+	names := make([]string, 0, len(*a))
+	for _, actor := range *a {
+		names = append(names, actor.Name)
+	}
+
+	return names
+}
+
 // Actor is one of the key components of the expenses module. An actor
 // is an abstraction of any participant in a transaction. Currenly its
 // use is to differenciate between *senders* and *receivers*
@@ -165,11 +795,16 @@ func (a *Actor) String() string {
 
 // BeforeCreate hook from GORM to check if actors has valid name
 func (a *Actor) BeforeCreate(tx *gorm.DB) (err error) {
+	return a.validate()
+}
+
+// validate the actor's fields regardless of the persistence layer
+func (a *Actor) validate() error {
 	if a.Name == "" {
-		return fmt.Errorf("Actor cannot have have an empty name")
+		return fmt.Errorf("Actor %w", ErrEmptyName)
 	}
 
-	return
+	return nil
 }
 
 // Labels is a registry-type that represents a collection of its
@@ -179,43 +814,75 @@ type Labels []Label
 // Push enables to write new labels into registry or updates the
 // fields of the existing ones if a *name* conflict occurs. Each
 // label can have a parent label to link with
-func (l *Labels) Push(ctx PushContext) error {
-	distincts := make(map[string]Label)
-	for i, lb := range *l {
-		var parent *Label
-		for parent = lb.Parent; parent != nil; parent = parent.Parent {
-			if _, ok := distincts[parent.Name]; !ok {
-				distincts[parent.Name] = *parent
-			}
-		}
+func (l *Labels) Push(ctx PushContext) (err error) {
+	if ctx.IdempotencyKey != "" {
+		return ctx.once("labels", nil, l.Push)
+	}
 
-		if _, ok := distincts[lb.Name]; !ok {
-			distincts[lb.Name] = lb
-		}
+	defer ctx.observe("labels", l, time.Now(), &err)
 
+	// labels are deduplicated in the order they are first seen (parents
+	// before children), so the same collection is always pushed the same
+	seen := make(map[string]bool)
+	list := make([]Label, 0, len(*l))
+	for i, lb := range *l {
 		// sync pointer to Labels with ParentName attached by gorm
 		if lb.Parent != nil {
 			(*l)[i].ParentName = NullString{
 				sql.NullString{String: lb.Parent.Name, Valid: true},
 			}
 		}
+
+		if ctx.SkipDedupe {
+			continue
+		}
+
+		var chain []Label
+		for parent := lb.Parent; parent != nil; parent = parent.Parent {
+			chain = append(chain, *parent)
+		}
+
+		for j := len(chain) - 1; j >= 0; j-- {
+			if !seen[chain[j].Name] {
+				seen[chain[j].Name] = true
+				list = append(list, chain[j])
+			}
+		}
+
+		if !seen[lb.Name] {
+			seen[lb.Name] = true
+			list = append(list, (*l)[i])
+		}
 	}
 
-	list := make([]Label, 0, len(distincts))
-	for _, lb := range distincts {
-		list = append(list, lb)
+	// parents are still upserted by gorm as associations of the labels
+	if ctx.SkipDedupe {
+		list = *l
 	}
 
 	q := ctx.Storage
-	if ctx.JustAppend {
-		q = q.Clauses(clause.OnConflict{DoNothing: true})
-	} else {
-		q = q.Clauses(clause.OnConflict{
-			Columns: []clause.Column{{Name: "name"}},
-			DoUpdates: clause.AssignmentColumns([]string{
-				"parent_name", "flags", "headers", "updated_at",
-			}),
+	switch ctx.conflictMode() {
+	case ConflictError:
+		// only the labels of the collection conflict, while their parents
+		// may be in registry already
+		return q.Transaction(func(tx *gorm.DB) error {
+			if err := conflicting(tx, &Label{}, "labels", l.names()); err != nil {
+				return err
+			}
+
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&list, ctx.BatchSize).Error
 		})
+	case ConflictDoNothing:
+		q = q.Clauses(clause.OnConflict{DoNothing: true})
+	default:
+		cols, err := ctx.conflictColumns(&Label{},
+			"parent_name", "flags", "headers", "updated_at",
+		)
+		if err != nil {
+			return err
+		}
+
+		q = q.Clauses(ctx.onConflict(&Label{}, "name", cols))
 	}
 
 	return q.CreateInBatches(&list, ctx.BatchSize).Error
@@ -224,12 +891,58 @@ func (l *Labels) Push(ctx PushContext) error {
 // Pull enables to read labels from registry. The results are
 // always sorted by their name and contain the parents of the
 // already retrieved labels as well
-func (l *Labels) Pull(ctx PullContext) error {
-	q := ctx.Storage.Preload("Parent")
+func (l *Labels) Pull(ctx PullContext) (err error) {
+	defer ctx.observe("labels", l, time.Now(), &err)
+
+	q := ctx.flagged(ctx.changed(ctx.reader().Preload("Parent")))
 
 	return q.Limit(ctx.Limit).Offset(ctx.Offset).Order("name").Find(l).Error
 }
 
+// Exists checks whether a label with the given name is already in the
+// registry without reading the actual record
+func (l *Labels) Exists(ctx PullContext, name string) (bool, error) {
+	return exists(ctx, &Label{}, "name = ?", name)
+}
+
+// Get reads a single label from registry by its name, together with its
+// parent. If there's no such label, ErrNotFound is returned instead
+func (l *Labels) Get(ctx PullContext, name string) (*Label, error) {
+	var label Label
+	if err := ctx.reader().Preload("Parent").Where("name = ?", name).First(&label).Error; err != nil {
+		return nil, notFound(err, "label", name)
+	}
+
+	return &label, nil
+}
+
+// GetOrCreate ensures a label with the given name, along with its chain of
+// parents, is in the registry and returns it as persisted with its parent.
+// Labels already in the registry are left untouched
+func (l *Labels) GetOrCreate(ctx PushContext, name string, parent *Label) (*Label, error) {
+	ctx.JustAppend = true
+	if err := (&Labels{NewLabel(name, parent)}).Push(ctx); err != nil {
+		return nil, err
+	}
+
+	return l.Get(PullContext{Storage: ctx.Storage}, name)
+}
+
+// names of the labels in the collection, in the same order and without
+// duplicates (the same label may appear more than once, e.g. as parent)
+func (l *Labels) names() []string {
+	seen := make(map[string]bool, len(*l))
+	names := make([]string, 0, len(*l))
+	for _, lb := range *l {
+		if !seen[lb.Name] {
+			seen[lb.Name] = true
+			names = append(names, lb.Name)
+		}
+	}
+
+	return names
+}
+
 // Label is another key component of the expenses module. A label is
 // an user-defined entity used to classify transactions through meta
 // information. The label has a tree-like structure where any entity
@@ -254,8 +967,8 @@ func (lb *Label) String() string {
 // BeforeCreate hook from GORM to correctly attach the parent name from
 // the relationship, if any; and validate provided name
 func (lb *Label) BeforeCreate(tx *gorm.DB) (err error) {
-	if lb.Name == "" {
-		return fmt.Errorf("Label cannot have an empty name")
+	if err = lb.validate(); err != nil {
+		return
 	}
 
 	if lb.Parent != nil {
@@ -267,6 +980,15 @@ func (lb *Label) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// validate the label's fields regardless of the persistence layer
+func (lb *Label) validate() error {
+	if lb.Name == "" {
+		return fmt.Errorf("Label %w", ErrEmptyName)
+	}
+
+	return nil
+}
+
 // Transactions is a registry-type that represents a collection of its
 // appropriate *Transaction* entities. This is the primary registry of
 // the expenses module
@@ -276,47 +998,235 @@ type Transactions []Transaction
 // in the persistent layer, whether it requires additional Actors/Labels to
 // be written before the actual commit or to add details after the commit
 func (t *Transactions) Push(ctx PushContext) error {
-	seenActors := make(map[string]bool)
-	everyActor := Actors{}
-	catchActor := func(a Actor) {
-		if _, ok := seenActors[a.Name]; !ok && a.Name != "" {
-			seenActors[a.Name] = true
-			everyActor = append(everyActor, a)
+	_, err := t.PushWithResult(ctx)
+	return err
+}
+
+// PushWithResult pushes transactions just like Push does and reports the
+// number of transactions pushed along with the ones skipped (see
+// SkipInvalid). Skipped transactions don't make the push fail, so it can be
+// part of a larger database transaction
+func (t *Transactions) PushWithResult(ctx PushContext) (result PushResult, err error) {
+	if ctx.IdempotencyKey != "" {
+		var keys []pushedKey
+		replayed := true
+		err = ctx.once("transactions", &keys, func(subctx PushContext) error {
+			if result, err = t.PushWithResult(subctx); err == nil {
+				replayed, keys = false, t.keys()
+			}
+			return err
+		})
+		if err != nil || !replayed {
+			return result, err
 		}
+
+		return t.replay(ctx, keys), nil
+	}
+
+	defer ctx.observe("transactions", t, time.Now(), &err)
+
+	if ctx.Storage, err = withTableSuffix(ctx.Storage, ctx.TableSuffix); err != nil {
+		return result, err
+	}
+
+	pushed := *t
+	var indexes []int
+	if ctx.SkipInvalid {
+		pushed, indexes, result.Skipped = t.partition(ctx)
+	}
+
+	if err = pushed.push(ctx); err != nil {
+		return PushResult{}, err
+	}
+
+	// the valid ones are copies, which now have their keys and versions
+	for k, i := range indexes {
+		(*t)[i] = pushed[k]
 	}
+	result.Pushed = len(pushed)
 
-	seenLabels := make(map[string]bool)
-	everyLabel := Labels{}
-	catchLabel := func(l Label) {
-		if _, ok := seenLabels[l.Name]; !ok && l.Name != "" {
-			seenLabels[l.Name] = true
-			everyLabel = append(everyLabel, l)
+	return result, nil
+}
 
-			var parent *Label
-			parent = l.Parent
+// push writes the transactions along with the actors and labels they
+// reference, all of them assumed to be valid
+func (t *Transactions) push(ctx PushContext) error {
+	// the limit is checked before anything else (again by BeforeCreate), so
+	// untrusted payloads don't get their references collected at all. The
+	// transaction is named by its UUID, given one just like BeforeCreate does
+	if ctx.MaxDetails > 0 {
+		for i := range *t {
+			trx := &(*t)[i]
+			if len(trx.Details) <= ctx.MaxDetails {
+				continue
+			}
 
-			for parent != nil {
-				everyLabel = append(everyLabel, *parent)
-				parent = parent.Parent
+			if trx.UUID == nil || *trx.UUID == "" {
+				pk := UUIDFunc()
+				trx.UUID = &pk
 			}
+
+			return fmt.Errorf("transaction %s %w, expected at most %d but got %d",
+				*trx.UUID, ErrTooManyDetails, ctx.MaxDetails, len(trx.Details))
 		}
 	}
 
-	for _, trx := range *t {
-		if trx.Receiver != nil {
-			catchActor(*trx.Receiver)
-		} else if trx.ReceiverName != "" {
-			catchActor(Actor{Name: trx.ReceiverName})
-		}
+	everyActor, labels, detailLabels, err := t.references(ctx.AutoCreateLabels)
+	if err != nil {
+		return err
+	}
 
-		if trx.Sender != nil {
-			catchActor(*trx.Sender)
-		} else if trx.SenderName != "" {
-			catchActor(Actor{Name: trx.SenderName})
+	var unresolved []string
+	for _, name := range detailLabels {
+		if !labels.seen[name] {
+			unresolved = append(unresolved, name)
 		}
+	}
 
-		if trx.Label != nil {
-			catchLabel(*trx.Label)
+	if missing, err := missingNames(ctx.Storage, &Label{}, unresolved); err != nil {
+		return err
+	} else if len(missing) > 0 {
+		return fmt.Errorf("details labels %v: %w", missing, ErrUnknownLabel)
+	}
+
+	if ctx.RequireExistingActors {
+		if missing, err := missingNames(ctx.Storage, &Actor{}, everyActor.names()); err != nil {
+			return err
+		} else if len(missing) > 0 {
+			return fmt.Errorf("actors %v: %w", missing, ErrUnknownActor)
+		}
+	}
+
+	if ctx.RequireExistingLabels {
+		if missing, err := missingNames(ctx.Storage, &Label{}, labels.list.names()); err != nil {
+			return err
+		} else if len(missing) > 0 {
+			return fmt.Errorf("labels %v: %w", missing, ErrUnknownLabel)
+		}
+	}
+
+	subctx := ctx
+	subctx.JustAppend = true
+
+	if !ctx.RequireExistingActors {
+		if err := everyActor.Push(subctx); err != nil {
+			return err
+		}
+	}
+
+	if !ctx.RequireExistingLabels {
+		if err := labels.list.Push(subctx); err != nil {
+			return err
+		}
+	}
+
+	mode := ctx.conflictMode()
+	onConflict := clause.OnConflict{DoNothing: true}
+	if mode == ConflictUpdateAll || mode == ConflictUpdateIfNewer {
+		cols, err := ctx.conflictColumns(&Transaction{},
+			"label_name", "sender_name", "receiver_name", "currency",
+			"flags", "headers", "meta", "updated_at",
+		)
+		if err != nil {
+			return err
+		}
+
+		// optimistic locking: each record must have the version it was read
+		// with and every update makes a new version of it. Versions are
+		// checked upfront with the rows locked (see versioned) and again on
+		// conflict, except on MySQL which has no such clause
+		version := clause.Column{Table: tableOf(ctx.Storage, &Transaction{}), Name: "version"}
+		onConflict = ctx.onConflict(&Transaction{}, "uuid", cols,
+			clause.Assignment{Column: clause.Column{Name: "version"}, Value: gorm.Expr("? + 1", version)})
+		onConflict.Where = clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: version, Value: clause.Column{Table: "excluded", Name: "version"}},
+		}}
+	}
+
+	return ctx.Storage.Transaction(func(tx *gorm.DB) (err error) {
+		var updated map[string]bool
+		if mode != ConflictDoNothing {
+			if updated, err = t.versioned(tx, mode); err != nil {
+				return err
+			}
+		}
+
+		q := tx.Set(pushContextKey, ctx)
+		if mode != ConflictError {
+			q = q.Clauses(onConflict)
+		}
+
+		if err := q.CreateInBatches(t, ctx.BatchSize).Error; err != nil {
+			return err
+		}
+
+		for i := range *t {
+			if trx := &(*t)[i]; trx.UUID != nil && updated[*trx.UUID] {
+				trx.Version++
+			}
+		}
+
+		return nil
+	})
+}
+
+// PreloadReferences pushes the actors and labels referenced by transactions
+// (along with the parents of labels) ahead of a large import, so the import
+// itself can be pushed with RequireExistingActors and RequireExistingLabels
+// set, without upserting them on each batch. Labels of details referenced by
+// name only are pushed only if AutoCreateLabels is set, just like on push
+func PreloadReferences(ctx PushContext, trxs Transactions) error {
+	actors, labels, _, err := trxs.references(ctx.AutoCreateLabels)
+	if err != nil {
+		return err
+	}
+
+	// references are already distinct, in the order they're first seen
+	ctx.JustAppend, ctx.SkipDedupe = true, true
+
+	if err := actors.Push(ctx); err != nil {
+		return err
+	}
+
+	return labels.list.Push(ctx)
+}
+
+// references collects the actors and labels referenced by transactions (see
+// labelSet), along with the labels of details referenced by name only when
+// they're not meant to be created (see AutoCreateLabels)
+func (t *Transactions) references(autoCreateLabels bool) (everyActor Actors, labels *labelSet, detailLabels []string, err error) {
+	seenActors := make(map[string]bool)
+	everyActor = Actors{}
+	catchActor := func(a Actor) {
+		if _, ok := seenActors[a.Name]; !ok && a.Name != "" {
+			seenActors[a.Name] = true
+			everyActor = append(everyActor, a)
+		}
+	}
+
+	knownLabels := make(map[string]bool)
+	detailLabels = []string{} // labels of details referenced by name only
+
+	// actors and labels are caught in the order they are first encountered,
+	// so the same transactions always push the same collections
+	labels = newLabelSet()
+	catchLabel := labels.catch
+
+	for i, trx := range *t {
+		if trx.Receiver != nil {
+			catchActor(*trx.Receiver)
+		} else if trx.ReceiverName != "" {
+			catchActor(Actor{Name: trx.ReceiverName})
+		}
+
+		if trx.Sender != nil {
+			catchActor(*trx.Sender)
+		} else if trx.SenderName != "" {
+			catchActor(Actor{Name: trx.SenderName})
+		}
+
+		if trx.Label != nil {
+			catchLabel(*trx.Label)
 		} else if trx.LabelName != "" {
 			catchLabel(Label{Name: trx.LabelName})
 		}
@@ -324,46 +1234,355 @@ func (t *Transactions) Push(ctx PushContext) error {
 		for _, ls := range trx.Details {
 			if ls.Label != nil {
 				catchLabel(*ls.Label)
-			} else if ls.LabelName != "" {
+			} else if ls.LabelName == "" {
+				return nil, nil, nil, fmt.Errorf("details of transaction #%d: %w", i, ErrUnknownLabel)
+			} else if autoCreateLabels {
 				catchLabel(Label{Name: ls.LabelName})
+			} else if !knownLabels[ls.LabelName] {
+				knownLabels[ls.LabelName] = true
+				detailLabels = append(detailLabels, ls.LabelName)
 			}
 		}
 	}
 
-	subctx := ctx
-	subctx.JustAppend = true
+	return everyActor, labels, detailLabels, nil
+}
 
-	if err := everyActor.Push(subctx); err != nil {
-		return err
+// labelSet collects labels with their parents, in the order they are first
+// seen. The parents of a label are walked only once, no matter how many
+// other labels share them, so large imports with deep trees stay linear
+type labelSet struct {
+	seen   map[string]bool
+	walked map[*Label]bool
+	list   Labels
+}
+
+func newLabelSet() *labelSet {
+	return &labelSet{seen: make(map[string]bool), walked: make(map[*Label]bool)}
+}
+
+func (s *labelSet) add(lb Label) {
+	if !s.seen[lb.Name] && lb.Name != "" {
+		s.seen[lb.Name] = true
+		s.list = append(s.list, lb)
 	}
+}
 
-	if err := everyLabel.Push(subctx); err != nil {
-		return err
+// catch adds the label and its parents not already seen. Parents are shared
+// by pointer, so once one is walked its own parents are walked as well
+func (s *labelSet) catch(l Label) {
+	s.add(l)
+	for lb := l.Parent; lb != nil && !s.walked[lb]; lb = lb.Parent {
+		s.walked[lb] = true
+		s.add(*lb)
 	}
+}
 
-	q := ctx.Storage
-	if ctx.JustAppend {
-		q = q.Clauses(clause.OnConflict{DoNothing: true})
-	} else {
-		q = q.Clauses(clause.OnConflict{
-			Columns: []clause.Column{{Name: "uuid"}},
-			DoUpdates: clause.AssignmentColumns([]string{
-				"label_name", "sender_name", "receiver_name",
-				"flags", "headers", "updated_at",
-			}),
-		})
+// versioned checks the version of each transaction already in registry is
+// the one it was read with, otherwise ErrStaleVersion is returned. The rows
+// are locked until the end of the database transaction, so no concurrent
+// update can slip in between. Upon success it returns the UUIDs of these
+// transactions, which are about to be updated (unless the mode is
+// ConflictUpdateIfNewer and they're not newer). If the mode is ConflictError,
+// any of them makes it fail with ErrConflict instead
+func (t *Transactions) versioned(tx *gorm.DB, mode ConflictMode) (map[string]bool, error) {
+	pushed := make(map[string]*Transaction, len(*t))
+	for i := range *t {
+		if trx := &(*t)[i]; trx.UUID != nil && *trx.UUID != "" {
+			pushed[*trx.UUID] = trx
+		}
+	}
+
+	updated := make(map[string]bool, len(pushed))
+	if len(pushed) == 0 {
+		return updated, nil
+	}
+
+	uuids := make([]string, 0, len(pushed))
+	for uuid := range pushed {
+		uuids = append(uuids, uuid)
+	}
+
+	var stored []Transaction
+	q := tx.Model(&Transaction{}).Select("uuid", "version", "updated_at").Where("uuid IN ?", uuids)
+	if err := q.Clauses(clause.Locking{Strength: "UPDATE"}).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	if mode == ConflictError && len(stored) > 0 {
+		conflicts := make([]string, 0, len(stored))
+		for _, trx := range stored {
+			conflicts = append(conflicts, *trx.UUID)
+		}
+		sort.Strings(conflicts)
+
+		return nil, fmt.Errorf("transactions %v: %w", conflicts, ErrConflict)
+	}
+
+	for _, trx := range stored {
+		next := pushed[*trx.UUID]
+		if next.Version != trx.Version {
+			return nil, fmt.Errorf("transaction %s %w, expected version %d but got %d",
+				*trx.UUID, ErrStaleVersion, trx.Version, next.Version)
+		}
+
+		// the pushed ones without a time of update are updated just now
+		if mode != ConflictUpdateIfNewer || next.UpdatedAt.IsZero() || trx.UpdatedAt.Before(next.UpdatedAt) {
+			updated[*trx.UUID] = true
+		}
 	}
 
-	return q.CreateInBatches(t, ctx.BatchSize).Error
+	return updated, nil
 }
 
 // Pull from registry automatically resolves the relationship between these
 // three components (Actors, Labels, Details) and the results are sorted by
 // the descending date & amount of the real-world transaction authorization
-func (t *Transactions) Pull(ctx PullContext) error {
-	q := ctx.Storage.Preload("Details")
+func (t *Transactions) Pull(ctx PullContext) (err error) {
+	defer ctx.observe("transactions", t, time.Now(), &err)
+
+	if ctx.Storage, err = withTableSuffix(ctx.reader(), ctx.TableSuffix); err != nil {
+		return err
+	}
+
+	q := ctx.filtered(ctx.preload(ctx.Storage))
+	if err = q.Limit(ctx.Limit).Offset(ctx.Offset).Order(transactionsOrder).Find(t).Error; err != nil {
+		return err
+	}
+
+	if err = tagsOf(ctx.Storage, *t); err != nil {
+		return err
+	}
+
+	if ctx.PreloadLabelAncestors {
+		if err = labelAncestors(ctx.Storage, *t); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Location != nil {
+		for i := range *t {
+			if trx := &(*t)[i]; trx.OccurredAt == nil {
+				y, m, d := trx.Date.UTC().Date()
+				trx.Date = time.Date(y, m, d, 0, 0, 0, 0, ctx.Location)
+			}
+		}
+	}
+
+	return nil
+}
+
+// PullDetails reads the details of transactions within the window of dates
+// (if any) on their own, along with their labels, sorted by the date of
+// their transactions just like Pull. Details are filtered by their own flags
+// (see ExcludeFlags and DetailFlags) rather than the flags of transactions
+func (t *Transactions) PullDetails(ctx PullContext) (details []Details, err error) {
+	db, err := withTableSuffix(ctx.reader(), ctx.TableSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, table := tableOf(db, &Transaction{}), tableOf(db, &Details{})
+	flags := clause.Column{Table: table, Name: "flags"}
+
+	q := db.Model(&Details{}).Preload("Label").
+		Select("?", clause.Column{Table: table, Name: "*", Raw: true}).
+		Joins("JOIN ? ON ? = ?", clause.Table{Name: transactions},
+			clause.Column{Table: transactions, Name: "uuid"}, clause.Column{Table: table, Name: "transaction_uuid"})
+
+	if ctx.ExcludeFlags != 0 {
+		q = q.Where("? & ? = 0", flags, ctx.ExcludeFlags)
+	}
+
+	if ctx.DetailFlags != 0 {
+		q = q.Where("? & ? = ?", flags, ctx.DetailFlags, ctx.DetailFlags)
+	}
+
+	err = ctx.transactions(q).
+		Order(clause.OrderByColumn{Column: clause.Column{Table: transactions, Name: "date"}, Desc: true}).
+		Order(clause.OrderByColumn{Column: clause.Column{Table: table, Name: "amount"}, Desc: true}).
+		Limit(ctx.Limit).Offset(ctx.Offset).Find(&details).Error
+
+	return details, err
+}
 
-	return q.Limit(ctx.Limit).Offset(ctx.Offset).Order("date DESC, amount DESC").Find(t).Error
+// Exists checks whether a transaction with the given UUID is already in
+// the registry without reading the actual record or its details
+func (t *Transactions) Exists(ctx PullContext, uuid string) (bool, error) {
+	db, err := withTableSuffix(ctx.reader(), ctx.TableSuffix)
+	if err != nil {
+		return false, err
+	}
+	ctx.Storage, ctx.ReadStorage = db, nil
+
+	return exists(ctx, &Transaction{}, "uuid = ?", uuid)
+}
+
+// Get reads a single transaction from registry by its UUID and resolves
+// its relationship with the other components (Actors, Labels, Details).
+// If there's no such transaction, ErrNotFound is returned instead
+func (t *Transactions) Get(ctx PullContext, uuid string) (*Transaction, error) {
+	db, err := withTableSuffix(ctx.reader(), ctx.TableSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	q := db.Preload("Label").Preload("Sender").Preload("Receiver").Preload("Details.Label")
+
+	var trx Transaction
+	if err := q.Where("uuid = ?", uuid).First(&trx).Error; err != nil {
+		return nil, notFound(err, "transaction", uuid)
+	}
+
+	trxs := Transactions{trx}
+	if err := tagsOf(db, trxs); err != nil {
+		return nil, err
+	}
+
+	return &trxs[0], nil
+}
+
+// PullByUUIDs reads exactly the transactions with the given UUIDs in a
+// single query, resolving their relationship with the other components
+// (see Get). The results are sorted just like Pull, while any unknown
+// UUID is ignored
+func (t *Transactions) PullByUUIDs(ctx PullContext, uuids []string) (err error) {
+	defer ctx.observe("transactions", t, time.Now(), &err)
+
+	if ctx.Storage, err = withTableSuffix(ctx.reader(), ctx.TableSuffix); err != nil {
+		return err
+	}
+
+	q := ctx.Storage.Preload("Label").Preload("Sender").Preload("Receiver").Preload("Details.Label")
+
+	if err = q.Where("uuid IN ?", uuids).Order(transactionsOrder).Find(t).Error; err != nil {
+		return err
+	}
+
+	return tagsOf(ctx.Storage, *t)
+}
+
+// ReplaceDetails corrects the breakdown of an existing transaction by
+// deleting all its details and creating the given ones instead, in a single
+// database transaction. The new details must add up to the transaction's
+// amount, otherwise nothing changes. Upon success the transaction has a new
+// version (see Version)
+func (t *Transactions) ReplaceDetails(ctx PushContext, uuid string, details []*Details) error {
+	db, err := withTableSuffix(ctx.Storage, ctx.TableSuffix)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var trx Transaction
+		if err := tx.Where("uuid = ?", uuid).First(&trx).Error; err != nil {
+			return notFound(err, "transaction", uuid)
+		}
+
+		trx.Details = details
+		if err := trx.validate(); err != nil {
+			return err
+		}
+
+		var names []string
+		for _, d := range details {
+			if d.Label == nil && d.LabelName != "" {
+				names = append(names, d.LabelName)
+			}
+		}
+
+		if ctx.AutoCreateLabels {
+			labels := make(Labels, 0, len(names))
+			for _, name := range names {
+				labels = append(labels, NewLabel(name, nil))
+			}
+
+			if err := labels.Push(PushContext{Storage: tx, BatchSize: ctx.BatchSize, JustAppend: true}); err != nil {
+				return err
+			}
+		} else if missing, err := missingNames(tx, &Label{}, names); err != nil {
+			return err
+		} else if len(missing) > 0 {
+			return fmt.Errorf("details labels %v: %w", missing, ErrUnknownLabel)
+		}
+
+		if err := tx.Where("transaction_uuid = ?", uuid).Delete(&Details{}).Error; err != nil {
+			return err
+		} else if err := tx.Model(&Transaction{}).Where("uuid = ?", uuid).Update("version", gorm.Expr("version + 1")).Error; err != nil {
+			return err
+		} else if len(details) == 0 {
+			return nil
+		}
+
+		for _, d := range details {
+			d.TransactionUUID = uuid
+		}
+
+		return tx.CreateInBatches(&details, ctx.BatchSize).Error
+	})
+}
+
+// SetFlags sets and clears flags on the transactions with the given UUIDs
+// with a single update, where clearing takes precedence (e.g. set and clear
+// FlagOutflow leaves it cleared). Every transaction updated makes a new
+// version of it (see Version). Unknown UUIDs are ignored. Upon success it
+// returns the number of transactions updated
+func (t *Transactions) SetFlags(ctx PushContext, uuids []string, set, clear uint16) (int64, error) {
+	if len(uuids) == 0 {
+		return 0, nil
+	}
+
+	db, err := withTableSuffix(ctx.Storage, ctx.TableSuffix)
+	if err != nil {
+		return 0, err
+	}
+
+	q := db.Model(&Transaction{}).Where("uuid IN ?", uuids).Updates(map[string]interface{}{
+		"flags":   gorm.Expr("(flags | ?) & ?", set, ^clear),
+		"version": gorm.Expr("version + 1"),
+	})
+
+	return q.RowsAffected, q.Error
+}
+
+// DeleteBefore removes the transactions dated before the cutoff along with
+// their details (e.g. archival), in batches of BatchSize transactions and
+// within a single database transaction. Actors and labels are kept as they
+// are. Upon success it returns the number of transactions removed
+func (t *Transactions) DeleteBefore(ctx PushContext, cutoff time.Time) (int64, error) {
+	db, err := withTableSuffix(ctx.Storage, ctx.TableSuffix)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for {
+			var uuids []string
+			q := tx.Model(&Transaction{}).Where("date < ?", cutoff).Limit(ctx.BatchSize)
+			if err := q.Pluck("uuid", &uuids).Error; err != nil {
+				return err
+			} else if len(uuids) == 0 {
+				return nil
+			}
+
+			if err := tx.Where("transaction_uuid IN ?", uuids).Delete(&Details{}).Error; err != nil {
+				return err
+			} else if err := tx.Where("transaction_uuid IN ?", uuids).Delete(&TransactionTag{}).Error; err != nil {
+				return err
+			} else if err := tx.Where("transaction_uuid IN ?", uuids).Delete(&Attachment{}).Error; err != nil {
+				return err
+			}
+
+			q = tx.Where("uuid IN ?", uuids).Delete(&Transaction{})
+			if q.Error != nil {
+				return q.Error
+			}
+			removed += q.RowsAffected
+		}
+	})
+
+	return removed, err
 }
 
 // Transaction *is* the key component of the expenses module which bounds
@@ -377,17 +1596,23 @@ func (t *Transactions) Pull(ctx PullContext) error {
 // and most importantly: the *amount* field is used to interpret the type
 // of the transaction as a binary operation (IN > 0 otherwise OUT)
 type Transaction struct {
-	UUID         *string   `json:"uuid,omitempty" gorm:"type: varchar(36); primaryKey"`
-	Date         time.Time `json:"date" gorm:"type: date; index; not null"`
-	Amount       int64     `json:"amount" gorm:"not null"`
-	LabelName    string    `json:"label" gorm:"not null"`
-	SenderName   string    `json:"sender" gorm:"not null"`
-	ReceiverName string    `json:"receiver" gorm:"not null"`
-	Signature    string    `json:"signature" gorm:"type: varchar(36); index; not null"`
-	Flags        uint16    `json:"flags" gorm:"not null"`
-	Headers      string    `json:"headers" gorm:"type: text; not null"`
-	CreatedAt    time.Time `json:"-" gorm:"autoCreateTime"`
-	UpdatedAt    time.Time `json:"-" gorm:"autoUpdateTime"`
+	UUID         *string        `json:"uuid,omitempty" gorm:"type: varchar(36); primaryKey"`
+	Date         time.Time      `json:"date" gorm:"type: date; index; not null"`
+	OccurredAt   *time.Time     `json:"-"`
+	Amount       int64          `json:"amount" gorm:"not null"`
+	Currency     string         `json:"currency,omitempty" gorm:"type: varchar(3); not null; default: ''"`
+	LabelName    string         `json:"label" gorm:"index; not null"`
+	SenderName   string         `json:"sender" gorm:"index; not null"`
+	ReceiverName string         `json:"receiver" gorm:"index; not null"`
+	Signature    string         `json:"signature" gorm:"type: varchar(36); index; not null"`
+	Flags        uint16         `json:"flags" gorm:"not null"`
+	Headers      string         `json:"headers" gorm:"type: text; not null"`
+	Meta         datatypes.JSON `json:"meta,omitempty"`
+	Tags         []string       `json:"tags,omitempty" gorm:"-"`
+	Version      uint           `json:"version,omitempty" gorm:"not null; default: 0"`
+	Status       Status         `json:"status,omitempty" gorm:"type: varchar(10); index; not null; default: pending"`
+	CreatedAt    time.Time      `json:"-" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time      `json:"-" gorm:"autoUpdateTime"`
 
 	Label    *Label `json:"-" gorm:"foreignKey: LabelName; constraint: OnUpdate:CASCADE"`
 	Sender   *Actor `json:"-" gorm:"foreignKey: SenderName; constraint: OnUpdate:CASCADE"`
@@ -412,28 +1637,147 @@ func (t *Transaction) String() string {
 // This method is responsible for constraints check upon amount details
 // preventing the introduction of incomplete or corrupted transactions
 func (t *Transaction) BeforeCreate(tx *gorm.DB) (err error) {
-	if t.UUID == nil {
-		pk := uuid.New().String()
+	if t.UUID == nil || *t.UUID == "" {
+		pk := UUIDFunc()
 		t.UUID = &pk
 	}
 
+	ctx := pushContextOf(tx)
+	if err := t.check(ctx); err != nil {
+		return err
+	} else if t.Status == "" {
+		t.Status = StatusPending
+	}
+	t.Headers = normalizeHeaders(t.Headers)
+
+	if ctx.PreserveTime {
+		occurredAt := t.Date
+		t.OccurredAt = &occurredAt
+	}
+	t.Date = dayIn(t.Date, ctx.Location)
+
+	if ctx.ForceExpensesNegative && t.Flags&FlagOutflow != 0 && t.Amount > 0 {
+		t.Amount = -t.Amount
+	}
+
+	if ctx.RequireDetailLabelsUnderTransactionLabel {
+		if err := t.detailsUnderLabel(tx.Session(&gorm.Session{NewDB: true})); err != nil {
+			return err
+		}
+	}
+
+	return t.validate()
+}
+
+// check the transaction against the options of the push which don't need
+// the persistence layer, so invalid ones can be skipped upfront as well
+// (see SkipInvalid)
+func (t *Transaction) check(ctx PushContext) error {
+	if t.Status != "" && !t.Status.valid() {
+		return fmt.Errorf("transaction %w: %q", ErrInvalidStatus, t.Status)
+	}
+
+	if ctx.MaxDetails > 0 && len(t.Details) > ctx.MaxDetails {
+		return fmt.Errorf("transaction %w, expected at most %d but got %d",
+			ErrTooManyDetails, ctx.MaxDetails, len(t.Details))
+	}
+
+	if ctx.RequireDetails && len(t.Details) == 0 {
+		return fmt.Errorf("transaction %w", ErrMissingDetails)
+	}
+
+	if ctx.DisallowDuplicateDetailLabels {
+		seen := make(map[string]bool, len(t.Details))
+		for _, d := range t.Details {
+			name := d.labelName()
+			if seen[name] {
+				return fmt.Errorf("transaction details %w: %s", ErrDuplicateDetailLabel, name)
+			}
+			seen[name] = true
+		}
+	}
+
+	if ctx.ValidateHeaders {
+		return t.validateHeaders()
+	}
+
+	return nil
+}
+
+// AfterFind hook from GORM to restore the time of day of transactions which
+// were pushed with it (see PushContext.PreserveTime)
+func (t *Transaction) AfterFind(tx *gorm.DB) (err error) {
+	if t.OccurredAt != nil {
+		t.Date = *t.OccurredAt
+	}
+
+	return nil
+}
+
+// validate the transaction's amount against its details (if any) regardless
+// of the persistence layer
+func (t *Transaction) validate() error {
 	if len(t.Details) > 0 {
+		// the sum would wrap around silently, so it could add up to any
+		// amount with details large enough
 		var sum int64
-		for _, d := range t.Details {
+		for i, d := range t.Details {
+			if (d.Amount > 0 && sum > math.MaxInt64-d.Amount) || (d.Amount < 0 && sum < math.MinInt64-d.Amount) {
+				return fmt.Errorf("details %w at #%d", ErrAmountOverflow, i)
+			}
 			sum += d.Amount
 		}
 
 		amount := t.Amount
-		if amount < 0 {
+		if amount == math.MinInt64 {
+			return fmt.Errorf("transaction %w", ErrAmountOverflow)
+		} else if amount < 0 {
 			amount *= -1
 		}
 
 		if sum != amount {
-			return fmt.Errorf("transaction details don't add up, expected %d but got %d", amount, sum)
+			return fmt.Errorf("%w, expected %d but got %d", ErrDetailsMismatch, amount, sum)
 		}
 	}
 
-	return
+	return nil
+}
+
+// detailsUnderLabel checks the label of each detail is the transaction's
+// label or one of its descendants, by walking up the tree of labels from
+// the registry (the labels are always pushed before transactions)
+func (t *Transaction) detailsUnderLabel(db *gorm.DB) error {
+	root := t.LabelName
+	if t.Label != nil {
+		root = t.Label.Name
+	}
+
+	parents := make(map[string]NullString)
+	for _, d := range t.Details {
+		seen := make(map[string]bool)
+		for name := d.labelName(); name != root; {
+			if seen[name] {
+				return fmt.Errorf("label %s: %w", name, ErrLabelCycle)
+			}
+			seen[name] = true
+
+			parent, ok := parents[name]
+			if !ok {
+				var label Label
+				if err := db.Where("name = ?", name).First(&label).Error; err != nil {
+					return notFound(err, "label", name)
+				}
+				parent, parents[name] = label.ParentName, label.ParentName
+			}
+
+			if !parent.Valid {
+				return fmt.Errorf("transaction details label %s %w %s", d.labelName(), ErrDetailLabelOutsideTree, root)
+			}
+			name = parent.String
+		}
+	}
+
+	return nil
 }
 
 // Details is an adjacent component of the expenses module to support the
@@ -441,11 +1785,12 @@ func (t *Transaction) BeforeCreate(tx *gorm.DB) (err error) {
 // labeled.
 //
 // This is the *only* entity that's created indirectly from a Transaction
-// and cannot have its fields updated in any way
+// and cannot have its fields updated in any way. The whole breakdown can
+// be replaced though (see ReplaceDetails)
 type Details struct {
 	UUID            *string   `json:"-" gorm:"type: varchar(36); primaryKey"`
 	TransactionUUID string    `json:"-" gorm:"not null"`
-	LabelName       string    `json:"label" gorm:"not null"`
+	LabelName       string    `json:"label" gorm:"index; not null"`
 	Amount          int64     `json:"amount" gorm:"not null"`
 	Flags           uint16    `json:"flags" gorm:"not null"`
 	Headers         string    `json:"headers" gorm:"type: text; not null"`
@@ -461,25 +1806,209 @@ func (d *Details) String() string {
 	return fmt.Sprintf(`D{Amount=%d Label=%v}`, d.Amount, d.Label)
 }
 
+// labelName returns the name of the label of details, either referenced by
+// name or by the associated struct
+func (d *Details) labelName() string {
+	if d.LabelName == "" && d.Label != nil {
+		return d.Label.Name
+	}
+
+	return d.LabelName
+}
+
 // BeforeCreate hook from GORM to generate an UUID just before creating
-// the new entry for the transaction details
+// the new entry for the transaction details. A caller provided UUID is
+// kept as is, which makes re-importing the same details idempotent
 func (d *Details) BeforeCreate(tx *gorm.DB) (err error) {
-	if d.UUID == nil {
-		pk := uuid.New().String()
+	if d.UUID == nil || *d.UUID == "" {
+		pk := UUIDFunc()
 		d.UUID = &pk
 	}
 
+	return d.validate()
+}
+
+// validate the details' amount and label regardless of the persistence
+// layer (details without any label would be orphans in the labels tree)
+func (d *Details) validate() error {
+	if d.Label == nil && d.LabelName == "" {
+		return fmt.Errorf("details %w, got no label", ErrUnknownLabel)
+	}
+
 	if d.Amount < 0 {
-		return errors.New("details amount cannot be negative")
+		return fmt.Errorf("%w, got %d", ErrNegativeDetail, d.Amount)
 	}
 
-	return
+	return nil
+}
+
+// exists is a generic SELECT 1 ... LIMIT 1 query on any registry entity
+func exists(ctx PullContext, model interface{}, query string, args ...interface{}) (bool, error) {
+	var found int
+	if err := ctx.reader().Model(model).Select("1").Where(query, args...).Limit(1).Scan(&found).Error; err != nil {
+		return false, err
+	}
+
+	return found == 1, nil
+}
+
+// missingNames returns the names (primary keys) of actors or labels which
+// aren't in registry, in the same order they were given
+func missingNames(db *gorm.DB, model interface{}, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var found []string
+	if err := db.Model(model).Where("name IN ?", names).Pluck("name", &found).Error; err != nil {
+		return nil, err
+	}
+
+	exists := make(map[string]bool, len(found))
+	for _, name := range found {
+		exists[name] = true
+	}
+
+	var missing []string
+	for _, name := range names {
+		if !exists[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing, nil
+}
+
+// notFound replaces the ORM's own error for missing records with the
+// package's ErrNotFound, so callers don't have to depend on GORM
+func notFound(err error, entity, key string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%s %s: %w", entity, key, ErrNotFound)
+	}
+
+	return err
 }
 
 // FromJson is a tiny helper function to deserialize a JSON payload into
 // one of the registry key components (Actors, Labels, Transactions)
 func FromJson(src []byte, into interface{}) error {
-	return json.Unmarshal(src, into)
+	return amountError(json.Unmarshal(src, into))
+}
+
+// FromJsonStrict works just like FromJson except it refuses payloads with
+// unknown keys (e.g. a misspelled "lable") instead of silently dropping
+// them, which is mostly useful to catch mistakes on import
+func FromJsonStrict(src []byte, into interface{}) error {
+	var payload interface{}
+	if err := json.Unmarshal(src, &payload); err != nil {
+		return err
+	}
+
+	// the decoder's own check doesn't reach into types decoding themselves
+	// (e.g. Transaction), so the keys are checked against the types upfront
+	if err := unknownFields(payload, reflect.TypeOf(into)); err != nil {
+		return err
+	}
+
+	return FromJson(src, into)
+}
+
+// unknownFields looks for keys of a decoded JSON payload which match no
+// field of the type it's decoded into, just like encoding/json does (i.e.
+// case insensitive and through embedded structs)
+func unknownFields(payload interface{}, t reflect.Type) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch v := payload.(type) {
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, item := range v {
+				if err := unknownFields(item, t.Elem()); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		if t.Kind() != reflect.Struct || t == timeType || t == nullStringType {
+			return nil
+		}
+
+		fields := make(map[string]reflect.Type)
+		var collect func(reflect.Type)
+		collect = func(t reflect.Type) {
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+				if name == "-" || (!field.IsExported() && !field.Anonymous) {
+					continue
+				} else if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+					collect(field.Type)
+				} else if name == "" {
+					fields[strings.ToLower(field.Name)] = field.Type
+				} else {
+					fields[strings.ToLower(name)] = field.Type
+				}
+			}
+		}
+		collect(t)
+
+		for key, value := range v {
+			field, ok := fields[strings.ToLower(key)]
+			if !ok {
+				return fmt.Errorf("json: unknown field %q", key)
+			} else if err := unknownFields(value, field); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// FromJsonFlexible works just like FromJson except it also accepts a single
+// JSON object for a collection (e.g. one transaction instead of an array
+// of transactions), in which case the collection has exactly one item
+func FromJsonFlexible(src []byte, into interface{}) error {
+	if trimmed := bytes.TrimSpace(src); len(trimmed) > 0 && trimmed[0] == '{' {
+		if v := reflect.ValueOf(into); v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+			item := reflect.New(v.Elem().Type().Elem())
+			if err := FromJson(trimmed, item.Interface()); err != nil {
+				return err
+			}
+
+			v.Elem().Set(reflect.Append(reflect.MakeSlice(v.Elem().Type(), 0, 1), item.Elem()))
+
+			return nil
+		}
+	}
+
+	return FromJson(src, into)
+}
+
+// amountError translates the generic decoding failure of an amount field
+// into a descriptive error, for amounts decoded as plain integers of minor
+// units (e.g. -3000 for -30.00), while transactions and details accept
+// decimals as well (see jsonAmount)
+func amountError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) || !strings.HasSuffix(typeErr.Field, "amount") {
+		return err
+	}
+
+	num := strings.TrimPrefix(typeErr.Value, "number ")
+	if num == typeErr.Value {
+		return err // not a number at all (e.g. a quoted string)
+	}
+
+	if f, err := strconv.ParseFloat(num, 64); err == nil && f != math.Trunc(f) {
+		return fmt.Errorf("amount %s cannot be fractional, expected minor units", num)
+	} else if err == nil && f >= math.MinInt64 && f < math.MaxInt64 {
+		return fmt.Errorf("amount %s must be written as an integer", num)
+	}
+
+	return fmt.Errorf("amount %s is out of range", num)
 }
 
 // ToJson is a tiny helper function to serialize into JSON any supported
@@ -492,12 +2021,29 @@ func ToJson(src interface{}) ([]byte, error) {
 	}
 }
 
+// EncodeJSON is the streaming counterpart of ToJson which serializes any
+// supported registry key components directly into a writer, without the
+// need to buffer the whole payload (e.g. HTTP responses or large files)
+func EncodeJSON(w io.Writer, src interface{}) error {
+	return json.NewEncoder(w).Encode(src)
+}
+
+// DecodeJSON is the streaming counterpart of FromJson which deserializes
+// a JSON payload from a reader into one of the registry key components
+func DecodeJSON(r io.Reader, into interface{}) error {
+	return amountError(json.NewDecoder(r).Decode(into))
+}
+
 // tables are declared to be used for Install and Uninstall
 var tables = [...]interface{}{
 	&Actor{},
 	&Label{},
 	&Transaction{},
 	&Details{},
+	&PushLog{},
+	&Tag{},
+	&TransactionTag{},
+	&Attachment{},
 }
 
 // Install is a helper function to create and migrate the required tables
@@ -525,6 +2071,145 @@ func Uninstall(db *gorm.DB) error {
 	return nil
 }
 
+// Optimize is a helper function to reclaim the space left behind by bulk
+// deletes (e.g. DeleteBefore), since it isn't done automatically. It runs
+// VACUUM on SQLite and PostgreSQL or OPTIMIZE TABLE on MySQL, while it does
+// nothing on other databases. Upon failure it returns errors that must be
+// handled by the caller
+func Optimize(db *gorm.DB) error {
+	switch db.Dialector.Name() {
+	case "sqlite":
+		return db.Exec("VACUUM").Error
+	case "postgres":
+		for _, table := range tables {
+			if err := db.Exec("VACUUM ?", clause.Table{Name: tableOf(db, table)}).Error; err != nil {
+				return err
+			}
+		}
+	case "mysql":
+		for _, table := range tables {
+			if err := db.Exec("OPTIMIZE TABLE ?", clause.Table{Name: tableOf(db, table)}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close is a helper function to close the underlying database connections
+// of the persistence layer once it's no longer used. Upon failure it returns
+// errors that must be handled by the caller
+func Close(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
+
+// PoolOptions are the settings of the underlying database connections pool
+// (see ConfigurePool). Any zero value keeps the current setting untouched
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// ConfigurePool is a helper function to tune the underlying database
+// connections pool, mostly useful for server deployments. Upon failure it
+// returns errors that must be handled by the caller
+func ConfigurePool(db *gorm.DB, opts PoolOptions) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	if opts.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+
+	if opts.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+
+	if opts.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+
+	if opts.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+
+	return nil
+}
+
+// WithTablePrefix is a helper function to namespace the tables (e.g. one set
+// per tenant in the same database). It returns a database handle sharing the
+// connections of db where every table name starts with the given prefix, so
+// Install, Uninstall, Push and Pull must all use it. Since the connections are
+// shared, Close on either handle closes both
+func WithTablePrefix(db *gorm.DB, prefix string) (*gorm.DB, error) {
+	return reopen(db, schema.NamingStrategy{TablePrefix: prefix})
+}
+
+// reopen returns a database handle sharing the connections of db but with
+// its own naming strategy (and its own cache of parsed models). The rest of
+// the configuration of db is kept and its plugins are registered again, so
+// the new handle behaves just like db does (e.g. PrepareStmt)
+func reopen(db *gorm.DB, namer schema.Namer) (*gorm.DB, error) {
+	// the config is copied field by field, since a copy of the whole of it
+	// would share the cache of parsed models and the callbacks of db
+	tx, err := gorm.Open(db.Dialector, &gorm.Config{
+		SkipDefaultTransaction:                   db.SkipDefaultTransaction,
+		NamingStrategy:                           namer,
+		FullSaveAssociations:                     db.FullSaveAssociations,
+		Logger:                                   db.Logger,
+		NowFunc:                                  db.NowFunc,
+		DryRun:                                   db.DryRun,
+		PrepareStmt:                              db.PrepareStmt,
+		DisableAutomaticPing:                     true,
+		DisableForeignKeyConstraintWhenMigrating: db.DisableForeignKeyConstraintWhenMigrating,
+		DisableNestedTransaction:                 db.DisableNestedTransaction,
+		AllowGlobalUpdate:                        db.AllowGlobalUpdate,
+		QueryFields:                              db.QueryFields,
+		CreateBatchSize:                          db.CreateBatchSize,
+		ClauseBuilders:                           db.ClauseBuilders,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if sqlDB, ok := unprepared(tx.ConnPool).(*sql.DB); ok && sqlDB != unprepared(db.ConnPool) {
+		if err := sqlDB.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	tx.ConnPool = db.ConnPool
+	tx.Statement.ConnPool = db.ConnPool
+
+	for _, plugin := range db.Plugins {
+		if err := tx.Use(plugin); err != nil {
+			return nil, err
+		}
+	}
+
+	return tx, nil
+}
+
+// unprepared returns the pool of connections behind prepared statements
+// (see gorm.Config.PrepareStmt), if any
+func unprepared(pool gorm.ConnPool) gorm.ConnPool {
+	if prepared, ok := pool.(*gorm.PreparedStmtDB); ok {
+		return prepared.ConnPool
+	}
+
+	return pool
+}
+
 // NewActor is an idiomatic constructor for the Actor entity. This method
 // doesn't handle meta fields such as Flags or Headers
 func NewActor(name string) Actor {
@@ -539,16 +2224,26 @@ func NewLabel(name string, parent *Label) Label {
 
 // NewTransaction is the primary idiomatic constructor for the Transaction
 // entity from which all other records can derive. Transaction details can
-// be omitted by providing nil map. This method doesn't handle meta fields
-// such as Flags or Headers
+// be omitted by providing nil map, otherwise they're sorted by their label
+// name (so the same transaction is always serialized the same way). This
+// method doesn't handle meta fields such as Flags or Headers
 func NewTransaction(d time.Time, a int64, lb Label, tx, rx Actor, ls map[Label]int64, z string) Transaction {
 	t := Transaction{Date: d, Amount: a, Label: &lb, Sender: &tx, Receiver: &rx, Signature: z}
 
 	if ls != nil {
 		t.Details = make([]*Details, 0, len(ls))
 		for label, value := range ls {
+			label := label // each details must point to its own label
 			t.Details = append(t.Details, &Details{Label: &label, Amount: value})
 		}
+
+		sort.Slice(t.Details, func(i, j int) bool {
+			a, b := t.Details[i], t.Details[j]
+			if a.Label.Name != b.Label.Name {
+				return a.Label.Name < b.Label.Name
+			}
+			return a.Amount < b.Amount
+		})
 	}
 
 	return t
@@ -21,7 +21,13 @@ package expenses
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -66,12 +72,39 @@ func begin(layer gorm.Dialector) (db *gorm.DB) {
 	return db
 }
 
-func close(db *gorm.DB) {
+func end(db *gorm.DB) {
 	Uninstall(db)
+	Close(db)
+}
+
+type fakeObserver struct {
+	pushes []string
+	pulls  []string
+}
+
+func (o *fakeObserver) ObservePush(entity string, n int, d time.Duration, err error) {
+	o.pushes = append(o.pushes, fmt.Sprintf("%s/%d/%v", entity, n, err))
+}
+
+func (o *fakeObserver) ObservePull(entity string, n int, d time.Duration, err error) {
+	o.pulls = append(o.pulls, fmt.Sprintf("%s/%d/%v", entity, n, err))
+}
+
+type capturingHandler struct {
+	records []slog.Record
+}
+
+func (h *capturingHandler) Enabled(context.Context, slog.Level) bool { return true }
 
-	// TODO(lexndru): how to close DB?
+func (h *capturingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.records = append(h.records, r)
+	return nil
 }
 
+func (h *capturingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *capturingHandler) WithGroup(string) slog.Handler { return h }
+
 func testActorsAPI(t *testing.T, db *gorm.DB) {
 	a := NewActor("Alexandru")
 
@@ -236,7 +269,7 @@ func testTransactionsAPI(t *testing.T, db *gorm.DB) {
 
 	moreTransactions = append(moreTransactions, recentTransactionWithUUID) // 2 inserts and 1 update
 
-	if err := moreTransactions.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+	if err := moreTransactions.Push(PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -384,13 +417,13 @@ func testIncorrectAmountForTransaction(t *testing.T, db *gorm.DB) {
 		LabelName: "??",
 	})
 
-	if err := incorrectTransactions.Push(PushContext{Storage: db, BatchSize: 10}); err == nil {
+	if err := incorrectTransactions.Push(PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true}); err == nil {
 		t.Fatal("Should have failed because of negative details amount")
 	}
 
 	incorrectTransactions[0].Details = []*Details{{Amount: 100, LabelName: "???"}}
 
-	if err := incorrectTransactions.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+	if err := incorrectTransactions.Push(PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -591,259 +624,2929 @@ func testEmptyNameChecks(t *testing.T, db *gorm.DB) {
 	}
 }
 
-func TestActorsAPI_Postgres(t *testing.T) {
-	db := begin(_Postgres)
-	defer close(db)
+func testTransactionUpdateColumns(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-04-28")
 
-	testActorsAPI(t, db)
-}
+	generatedId := uuid.New().String()
 
-func TestLabelsAPI_Postgres(t *testing.T) {
-	db := begin(_Postgres)
-	defer close(db)
+	trxs := Transactions{
+		Transaction{
+			UUID:         &generatedId,
+			Date:         date,
+			Amount:       1,
+			LabelName:    "original label",
+			SenderName:   "?",
+			ReceiverName: "?",
+		},
+	}
 
-	testLabelsAPI(t, db)
-}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
 
-func TestTransactionsAPI_Postgres(t *testing.T) {
-	db := begin(_Postgres)
-	defer close(db)
+	trxs[0].LabelName = "ignored label"
+	trxs[0].Flags = 7
 
-	testTransactionsAPI(t, db)
-}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10, UpdateColumns: []string{"flags"}}); err != nil {
+		t.Fatal(err)
+	}
 
-func TestIncorrectAmountForTransaction_Postgres(t *testing.T) {
-	db := begin(_Postgres)
-	defer close(db)
+	var transactionsCopy Transactions
+	if err := transactionsCopy.Pull(PullContext{Storage: db, Limit: 2}); err != nil {
+		t.Fatal(err)
+	}
 
-	// silent intentionally errors
-	testIncorrectAmountForTransaction(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
-}
+	if len(transactionsCopy) != 1 {
+		t.Fatalf("Expected 1 transaction but got %d instead\n", len(transactionsCopy))
+	}
 
-func TestPrimaryRequestsWithTransactions_Postgres(t *testing.T) {
-	db := begin(_Postgres)
-	defer close(db)
+	if transactionsCopy[0].Flags != 7 {
+		t.Fatalf("Expected flags to be updated but got %d instead", transactionsCopy[0].Flags)
+	}
 
-	testPrimaryRequestsWithTransactions(t, db)
+	if transactionsCopy[0].LabelName != "original label" {
+		t.Fatalf("Expected label to stay the original but got %s instead", transactionsCopy[0].LabelName)
+	}
+
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10, UpdateColumns: []string{"unknown"}}); err == nil {
+		t.Fatal("Expected push to fail because of unknown column to update")
+	}
 }
 
-func TestPrimaryRequestsWithLabelsTree_Postgres(t *testing.T) {
-	db := begin(_Postgres)
-	defer close(db)
+func testExistsChecks(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-04-29")
+	trx := NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "signature/0")
 
-	testPrimaryRequestsWithLabelsTree(t, db)
-}
+	trxs := Transactions{trx}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
 
-func TestTransactionJustAppendFlag_Postgres(t *testing.T) {
-	db := begin(_Postgres)
-	defer close(db)
+	ctx := PullContext{Storage: db}
 
-	testTransactionJustAppendFlag(t, db)
-}
+	if ok, err := (&Actors{}).Exists(ctx, "Magazin"); err != nil || !ok {
+		t.Fatalf("Expected actor to exist but got %v (%v)", ok, err)
+	}
 
-func TestLabelParentUpsert_Postgres(t *testing.T) {
-	db := begin(_Postgres)
-	defer close(db)
+	if ok, err := (&Actors{}).Exists(ctx, "Piață"); err != nil || ok {
+		t.Fatalf("Expected actor to be absent but got %v (%v)", ok, err)
+	}
 
-	testLabelParentUpsert(t, db)
-}
+	if ok, err := (&Labels{}).Exists(ctx, "Alimente"); err != nil || !ok {
+		t.Fatalf("Expected label to exist but got %v (%v)", ok, err)
+	}
 
-func TestEmptyNameChecks_Postgres(t *testing.T) {
-	db := begin(_Postgres)
-	defer close(db)
+	if ok, err := (&Labels{}).Exists(ctx, "Apă"); err != nil || ok {
+		t.Fatalf("Expected label to be absent but got %v (%v)", ok, err)
+	}
 
-	// silent intentionally errors
-	testEmptyNameChecks(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+	if ok, err := (&Transactions{}).Exists(ctx, *trxs[0].UUID); err != nil || !ok {
+		t.Fatalf("Expected transaction to exist but got %v (%v)", ok, err)
+	}
+
+	if ok, err := (&Transactions{}).Exists(ctx, uuid.New().String()); err != nil || ok {
+		t.Fatalf("Expected transaction to be absent but got %v (%v)", ok, err)
+	}
 }
 
-func TestActorsAPI_MySQL(t *testing.T) {
-	db := begin(_MySQL)
-	defer close(db)
+func testSingleRecordGetters(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-04-29")
+	ls := map[Label]int64{NewLabel("Pâine", nil): 3000}
+	trx := NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "signature/0")
 
-	testActorsAPI(t, db)
-}
+	trxs := Transactions{trx}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
 
-func TestLabelsAPI_MySQL(t *testing.T) {
-	db := begin(_MySQL)
-	defer close(db)
+	if err := (&Labels{NewLabel("Franzelă", &Label{Name: "Pâine"})}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
 
-	testLabelsAPI(t, db)
-}
+	ctx := PullContext{Storage: db}
 
-func TestTransactionsAPI_MySQL(t *testing.T) {
-	db := begin(_MySQL)
-	defer close(db)
+	if a, err := (&Actors{}).Get(ctx, "Magazin"); err != nil || a.Name != "Magazin" {
+		t.Fatalf("Expected actor Magazin but got %v (%v)", a, err)
+	}
 
-	testTransactionsAPI(t, db)
-}
+	if _, err := (&Actors{}).Get(ctx, "Piață"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected actor to be absent but got %v", err)
+	}
 
-func TestIncorrectAmountForTransaction_MySQL(t *testing.T) {
-	db := begin(_MySQL)
-	defer close(db)
+	if lb, err := (&Labels{}).Get(ctx, "Franzelă"); err != nil || lb.Parent == nil || lb.Parent.Name != "Pâine" {
+		t.Fatalf("Expected label with parent Pâine but got %v (%v)", lb, err)
+	}
 
-	// silent intentionally errors
-	testIncorrectAmountForTransaction(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
-}
+	if _, err := (&Labels{}).Get(ctx, "Apă"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected label to be absent but got %v", err)
+	}
 
-func TestPrimaryRequestsWithTransactions_MySQL(t *testing.T) {
-	db := begin(_MySQL)
-	defer close(db)
+	if tx, err := (&Transactions{}).Get(ctx, *trxs[0].UUID); err != nil {
+		t.Fatal(err)
+	} else if tx.Label == nil || tx.Sender == nil || tx.Receiver == nil || len(tx.Details) != 1 || tx.Details[0].Label == nil {
+		t.Fatalf("Expected transaction with resolved components but got %v", tx)
+	}
 
-	testPrimaryRequestsWithTransactions(t, db)
+	if _, err := (&Transactions{}).Get(ctx, uuid.New().String()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected transaction to be absent but got %v", err)
+	}
 }
 
-func TestPrimaryRequestsWithLabelsTree_MySQL(t *testing.T) {
-	db := begin(_MySQL)
-	defer close(db)
+func testSentinelErrors(t *testing.T, db *gorm.DB) {
+	if err := (&Actors{NewActor("")}).Push(PushContext{Storage: db, BatchSize: 1}); !errors.Is(err, ErrEmptyName) {
+		t.Fatalf("Expected ErrEmptyName for actor but got %v", err)
+	}
 
-	testPrimaryRequestsWithLabelsTree(t, db)
-}
+	if err := (&Labels{NewLabel("", nil)}).Push(PushContext{Storage: db, BatchSize: 1}); !errors.Is(err, ErrEmptyName) {
+		t.Fatalf("Expected ErrEmptyName for label but got %v", err)
+	}
 
-func TestTransactionJustAppendFlag_MySQL(t *testing.T) {
-	db := begin(_MySQL)
-	defer close(db)
+	date, _ := time.Parse("2006-01-02", "2021-04-23")
 
-	testTransactionJustAppendFlag(t, db)
-}
+	mismatch := Transactions{NewTransaction(date, -100, NewLabel("?", nil), NewActor("?"), NewActor("?"), map[Label]int64{NewLabel("?", nil): 50}, "")}
+	if err := mismatch.Push(PushContext{Storage: db, BatchSize: 1}); !errors.Is(err, ErrDetailsMismatch) {
+		t.Fatalf("Expected ErrDetailsMismatch but got %v", err)
+	}
 
-func TestLabelParentUpsert_MySQL(t *testing.T) {
-	db := begin(_MySQL)
-	defer close(db)
+	negative := Transactions{NewTransaction(date, 0, NewLabel("?", nil), NewActor("?"), NewActor("?"), map[Label]int64{NewLabel("?", nil): -50, NewLabel("??", nil): 50}, "")}
+	if err := negative.Push(PushContext{Storage: db, BatchSize: 1}); !errors.Is(err, ErrNegativeDetail) {
+		t.Fatalf("Expected ErrNegativeDetail but got %v", err)
+	}
 
-	testLabelParentUpsert(t, db)
-}
+	ctx := PullContext{Storage: db}
 
-func TestEmptyNameChecks_MySQL(t *testing.T) {
-	db := begin(_MySQL)
-	defer close(db)
+	if _, err := (&Actors{}).Get(ctx, "?!"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for actor but got %v", err)
+	}
 
-	// silent intentionally errors
-	testEmptyNameChecks(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+	if _, err := (&Labels{}).Get(ctx, "?!"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for label but got %v", err)
+	}
+
+	if _, err := (&Transactions{}).Get(ctx, "?!"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for transaction but got %v", err)
+	}
 }
 
-func TestActorsAPI_SQLite(t *testing.T) {
-	db := begin(_SQLite)
-	defer close(db)
+func testRegistryObserver(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-04-22")
+	trx := NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "signature/0")
 
-	testActorsAPI(t, db)
-}
+	observer := &fakeObserver{}
 
-func TestLabelsAPI_SQLite(t *testing.T) {
-	db := begin(_SQLite)
-	defer close(db)
+	trxs := Transactions{trx}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10, Observer: observer}); err != nil {
+		t.Fatal(err)
+	}
 
-	testLabelsAPI(t, db)
-}
+	var trxCopy Transactions
+	if err := trxCopy.Pull(PullContext{Storage: db, Observer: observer}); err != nil {
+		t.Fatal(err)
+	}
 
-func TestTransactionsAPI_SQLite(t *testing.T) {
-	db := begin(_SQLite)
-	defer close(db)
+	expectedPushes := []string{"actors/2/<nil>", "labels/1/<nil>", "transactions/1/<nil>"}
+	if fmt.Sprint(observer.pushes) != fmt.Sprint(expectedPushes) {
+		t.Fatalf("Expected pushes %v but got %v instead", expectedPushes, observer.pushes)
+	}
 
-	testTransactionsAPI(t, db)
+	expectedPulls := []string{"transactions/1/<nil>"}
+	if fmt.Sprint(observer.pulls) != fmt.Sprint(expectedPulls) {
+		t.Fatalf("Expected pulls %v but got %v instead", expectedPulls, observer.pulls)
+	}
 }
 
-func TestTransactionJustAppendFlag_SQLite(t *testing.T) {
-	db := begin(_SQLite)
-	defer close(db)
+func testRegistryLogger(t *testing.T, db *gorm.DB) {
+	handler := &capturingHandler{}
 
-	testTransactionJustAppendFlag(t, db)
-}
+	actors := Actors{NewActor("Alexandru")}
+	if err := actors.Push(PushContext{Storage: db, BatchSize: 10, Logger: slog.New(handler)}); err != nil {
+		t.Fatal(err)
+	}
 
-func TestIncorrectAmountForTransaction_SQLite(t *testing.T) {
-	db := begin(_SQLite)
-	defer close(db)
+	if len(handler.records) != 1 {
+		t.Fatalf("Expected 1 log record on push but got %d instead", len(handler.records))
+	}
 
-	// silent intentionally errors
-	testIncorrectAmountForTransaction(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
-}
+	r := handler.records[0]
+	if r.Level != slog.LevelDebug || r.Message != "push" {
+		t.Fatalf("Expected debug push record but got %v %s", r.Level, r.Message)
+	}
 
-func TestPrimaryRequestsWithTransactions_SQLite(t *testing.T) {
-	db := begin(_SQLite)
-	defer close(db)
+	attrs := make(map[string]slog.Value)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
 
-	testPrimaryRequestsWithTransactions(t, db)
+	if attrs["entity"].String() != "actors" || attrs["batch_size"].Int64() != 10 || attrs["rows"].Int64() != 1 {
+		t.Fatalf("Expected entity, batch size and rows to be logged but got %v", attrs)
+	}
+
+	// logger is optional and must not be required
+	if err := actors.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
 }
 
-func TestPrimaryRequestsWithLabelsTree_SQLite(t *testing.T) {
-	db := begin(_SQLite)
-	defer close(db)
+func testDetailsLabelIntegrity(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-04-26")
 
-	testPrimaryRequestsWithLabelsTree(t, db)
-}
+	newTransaction := func(labels ...string) *Transactions {
+		trx := Transaction{Date: date, LabelName: "?", SenderName: "?", ReceiverName: "?"}
+		for _, name := range labels {
+			trx.Amount -= 100
+			trx.Details = append(trx.Details, &Details{LabelName: name, Amount: 100})
+		}
 
-func TestLabelParentUpsert_SQLite(t *testing.T) {
-	db := begin(_SQLite)
-	defer close(db)
+		return &Transactions{trx}
+	}
 
-	testLabelParentUpsert(t, db)
-}
+	if err := newTransaction("Apă").Push(PushContext{Storage: db, BatchSize: 10}); !errors.Is(err, ErrUnknownLabel) {
+		t.Fatalf("Expected push to fail because of unknown details label but got %v", err)
+	}
 
-func TestEmptyNameChecks_SQLite(t *testing.T) {
-	db := begin(_SQLite)
-	defer close(db)
+	if err := newTransaction("").Push(PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true}); !errors.Is(err, ErrUnknownLabel) {
+		t.Fatalf("Expected push to fail because of details without label but got %v", err)
+	}
 
-	// silent intentionally errors
-	testEmptyNameChecks(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
-}
+	var trxs Transactions
+	if err := trxs.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(trxs) != 0 {
+		t.Fatalf("Expected no transactions after failed pushes but got %d", len(trxs))
+	}
 
-func TestIncorrectTransactions_Json(t *testing.T) {
-	input := `{
-	    "amount": "100",
-	    "date": 31231435,
-	    "sender": "?!!",
-	    "receiver": "??!",
-	    "label" "???"
-	}`
+	if err := newTransaction("Apă").Push(PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true}); err != nil {
+		t.Fatal(err)
+	}
 
-	var trx Transactions
-	if err := FromJson([]byte(input), &trx); err == nil {
-		t.Fatal("Expected failure from invalid JSON but instead it worked")
+	if ok, err := (&Labels{}).Exists(PullContext{Storage: db}, "Apă"); err != nil || !ok {
+		t.Fatalf("Expected details label to be created but got %v (%v)", ok, err)
 	}
 
-	if len(trx) != 0 {
-		t.Fatal("Expected no transactions because of inccorect JSON input")
+	// strict mode accepts both existing labels and labels pushed together
+	strict := newTransaction("Apă", "Pâine")
+	(*strict)[0].Details[1].Label = &Label{Name: "Pâine"}
+	if err := strict.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
 	}
 }
 
-func TestEncodeDecodeTransactions_Json(t *testing.T) {
-	date, _ := time.Parse("2006-01-02", "2021-04-24")
+func testRequireExistingReferences(t *testing.T, db *gorm.DB) {
+	if err := (&Actors{NewActor("Alexandru"), NewActor("Magazin")}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
 
-	oneTransaction := Transactions{
-		Transaction{
-			Date:         date,
-			Amount:       -100, // 1.00
-			LabelName:    "?",
-			SenderName:   "?",
-			ReceiverName: "?",
-			Signature:    "?",
-			Details: []*Details{
-				{
-					LabelName: "?",
-					Amount:    50,
-				},
-				{
-					LabelName: "?",
-					Amount:    30,
-				},
-				{
-					LabelName: "?",
-					Amount:    20,
-				},
-			},
-		},
+	if err := (&Labels{NewLabel("Alimente", nil)}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
 	}
 
-	expectedJson := `[
-		{
-			"date": "2021-04-24T00:00:00Z",
-			"amount": -100,
-			"label": "?",
-			"sender": "?",
-			"receiver": "?",
-			"signature": "?",
-			"flags": 0,
-			"headers": "",
-			"details": [
+	date, _ := time.Parse("2006-01-02", "2021-04-26")
+	strict := PushContext{Storage: db, BatchSize: 10, RequireExistingActors: true, RequireExistingLabels: true}
+
+	typo := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru Catrina"), NewActor("Magazin"), nil, "")}
+	if err := typo.Push(strict); !errors.Is(err, ErrUnknownActor) {
+		t.Fatalf("Expected push to fail because of unknown sender but got %v", err)
+	}
+
+	unknownLabel := Transactions{NewTransaction(date, -3000, NewLabel("Mâncare", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := unknownLabel.Push(strict); !errors.Is(err, ErrUnknownLabel) {
+		t.Fatalf("Expected push to fail because of unknown label but got %v", err)
+	}
+
+	if ok, err := (&Actors{}).Exists(PullContext{Storage: db}, "Alexandru Catrina"); err != nil || ok {
+		t.Fatalf("Expected unknown sender not to be created but got %v (%v)", ok, err)
+	}
+
+	valid := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := valid.Push(strict); err != nil {
+		t.Fatal(err)
+	}
+
+	// default behaviour is to create any referenced actor
+	if err := typo.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testCloseStorage(t *testing.T, db *gorm.DB) {
+	if err := (&Actors{NewActor("Alexandru")}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Close(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var actors Actors
+	if err := actors.Pull(PullContext{Storage: db}); err == nil {
+		t.Fatal("Expected pull to fail after closing the storage but instead it worked")
+	}
+}
+
+func testConfigurePool(t *testing.T, db *gorm.DB) {
+	if err := ConfigurePool(db, PoolOptions{MaxOpenConns: 7, MaxIdleConns: 3, ConnMaxLifetime: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := sqlDB.Stats(); stats.MaxOpenConnections != 7 {
+		t.Fatalf("Expected 7 max open connections but got %d instead", stats.MaxOpenConnections)
+	}
+
+	if err := (&Actors{NewActor("Alexandru")}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	// zero values keep the previous settings
+	if err := ConfigurePool(db, PoolOptions{MaxIdleConns: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := sqlDB.Stats(); stats.MaxOpenConnections != 7 {
+		t.Fatalf("Expected max open connections to stay 7 but got %d instead", stats.MaxOpenConnections)
+	}
+}
+
+func testPullByUUIDs(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+
+	var trxs Transactions
+	for i := 0; i < 5; i++ {
+		ls := map[Label]int64{NewLabel("Pâine", nil): int64(100 * (i + 1))}
+		trxs = append(trxs, NewTransaction(date.AddDate(0, 0, i), int64(-100*(i+1)), NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, ""))
+	}
+
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	subset := []string{*trxs[1].UUID, *trxs[4].UUID, *trxs[2].UUID, uuid.New().String()}
+
+	var pulled Transactions
+	if err := pulled.PullByUUIDs(PullContext{Storage: db}, subset); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{*trxs[4].UUID, *trxs[2].UUID, *trxs[1].UUID} // most recent first
+	if len(pulled) != len(expected) {
+		t.Fatalf("Expected %d transactions but got %d instead", len(expected), len(pulled))
+	}
+
+	for i, trx := range pulled {
+		if *trx.UUID != expected[i] {
+			t.Fatalf("Expected transaction #%d to be %s but got %s", i, expected[i], *trx.UUID)
+		}
+
+		if trx.Label == nil || trx.Sender == nil || trx.Receiver == nil || len(trx.Details) != 1 || trx.Details[0].Label == nil {
+			t.Fatalf("Expected transaction #%d with resolved components but got %v", i, &trx)
+		}
+	}
+}
+
+func testSkipInvalidTransactions(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+
+	mismatch := map[Label]int64{NewLabel("Pâine", nil): 100}
+	trxs := Transactions{
+		NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "valid/0"),
+		NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), mismatch, "invalid/1"),
+		NewTransaction(date, -1500, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"), nil, "valid/2"),
+	}
+
+	// skipped transactions don't fail the push, so it can be part of a
+	// larger database transaction without rolling it back
+	var result PushResult
+	err := db.Transaction(func(tx *gorm.DB) (err error) {
+		result, err = trxs.PushWithResult(PushContext{Storage: tx, BatchSize: 10, SkipInvalid: true})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trxs) != 3 || trxs[0].UUID == nil || trxs[1].UUID != nil || trxs[2].UUID == nil {
+		t.Fatalf("Expected the collection as it was with keys on the valid ones but got %v", trxs)
+	}
+
+	if result.Pushed != 2 || len(result.Skipped) != 1 || result.Skipped[0].Index != 1 {
+		t.Fatalf("Expected 2 pushed and transaction #1 skipped but got %v", result)
+	}
+
+	if !errors.Is(result.Skipped[0], ErrDetailsMismatch) {
+		t.Fatalf("Expected transaction to be skipped because of details but got %v", result.Skipped[0])
+	}
+
+	var pulled Transactions
+	if err := pulled.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pulled) != 2 {
+		t.Fatalf("Expected the 2 valid transactions to land but got %d instead", len(pulled))
+	}
+
+	for _, trx := range pulled {
+		if trx.Signature == "invalid/1" {
+			t.Fatal("Expected the invalid transaction to be skipped")
+		}
+	}
+
+	// all valid transactions are pushed without any error
+	valid := Transactions{NewTransaction(date, -500, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"), nil, "valid/3")}
+	if err := valid.Push(PushContext{Storage: db, BatchSize: 10, SkipInvalid: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the options of the push are checked per transaction as well
+	twice := []*Details{{LabelName: "Pâine", Amount: 100}, {LabelName: "Pâine", Amount: 100}}
+	headered := NewTransaction(date, -100, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"),
+		map[Label]int64{NewLabel("Pâine", nil): 100}, "")
+	headered.Headers = "malformed"
+	strict := Transactions{
+		NewTransaction(date, -100, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"), nil, ""),
+		{Date: date, Amount: -200, LabelName: "Alimente", SenderName: "Alexandru", ReceiverName: "Piață", Details: twice},
+		NewTransaction(date, -300, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"),
+			map[Label]int64{NewLabel("Pâine", nil): 100, NewLabel("Apă", nil): 100, NewLabel("Lapte", nil): 100}, ""),
+		headered,
+		NewTransaction(date, -400, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"),
+			map[Label]int64{NewLabel("Pâine", nil): 400}, "valid/4"),
+	}
+	result, err = strict.PushWithResult(PushContext{Storage: db, BatchSize: 10, SkipInvalid: true,
+		RequireDetails: true, MaxDetails: 2, DisallowDuplicateDetailLabels: true, ValidateHeaders: true})
+	if err != nil {
+		t.Fatal(err)
+	} else if result.Pushed != 1 || len(result.Skipped) != 4 {
+		t.Fatalf("Expected 1 pushed and 4 skipped transactions but got %v", result)
+	}
+
+	for i, reason := range []error{ErrMissingDetails, ErrDuplicateDetailLabel, ErrTooManyDetails, ErrMalformedHeader} {
+		if skip := result.Skipped[i]; skip.Index != i || !errors.Is(skip, reason) {
+			t.Fatalf("Expected transaction #%d to be skipped because of %v but got %v", i, reason, skip)
+		}
+	}
+}
+
+func testReplaceDetails(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	ls := map[Label]int64{NewLabel("Pâine", nil): 3000}
+
+	trxs := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "")}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	pk := *trxs[0].UUID
+	ctx := PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true}
+
+	breakdown := []*Details{{LabelName: "Pâine", Amount: 1000}, {LabelName: "Apă", Amount: 2000}}
+	if err := trxs.ReplaceDetails(ctx, pk, breakdown); err != nil {
+		t.Fatal(err)
+	}
+
+	trx, err := trxs.Get(PullContext{Storage: db}, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trx.Details) != 2 {
+		t.Fatalf("Expected 2 details after replace but got %d instead", len(trx.Details))
+	}
+
+	wrong := []*Details{{LabelName: "Pâine", Amount: 1000}}
+	if err := trxs.ReplaceDetails(ctx, pk, wrong); !errors.Is(err, ErrDetailsMismatch) {
+		t.Fatalf("Expected replace to fail because details don't add up but got %v", err)
+	}
+
+	if trx, err = trxs.Get(PullContext{Storage: db}, pk); err != nil {
+		t.Fatal(err)
+	} else if len(trx.Details) != 2 {
+		t.Fatalf("Expected previous 2 details to be kept but got %d instead", len(trx.Details))
+	}
+
+	if err := trxs.ReplaceDetails(ctx, uuid.New().String(), breakdown); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected replace to fail because of unknown transaction but got %v", err)
+	}
+}
+
+func testRequireDetails(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	strict := PushContext{Storage: db, BatchSize: 10, RequireDetails: true}
+
+	bare := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := bare.Push(strict); !errors.Is(err, ErrMissingDetails) {
+		t.Fatalf("Expected push to fail because of missing details but got %v", err)
+	}
+
+	ls := map[Label]int64{NewLabel("Pâine", nil): 3000}
+	itemized := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "")}
+	if err := itemized.Push(strict); err != nil {
+		t.Fatal(err)
+	}
+
+	// default behaviour is lenient
+	if err := bare.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testUUIDFunc(t *testing.T, db *gorm.DB) {
+	defer func(fn func() string) { UUIDFunc = fn }(UUIDFunc)
+
+	var seq int
+	UUIDFunc = func() string {
+		seq++
+		return fmt.Sprintf("00000000-0000-0000-0000-%012d", seq)
+	}
+
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	ls := map[Label]int64{NewLabel("Pâine", nil): 3000}
+	trx := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "")}
+	if err := trx.Push(PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Transactions
+	if err := got.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 1 || len(got[0].Details) != 1 {
+		t.Fatalf("Expected one transaction with one detail, got %v", got)
+	}
+
+	if uuid := *got[0].UUID; uuid != "00000000-0000-0000-0000-000000000001" {
+		t.Fatalf("Expected transaction UUID from UUIDFunc, got %s", uuid)
+	}
+	if uuid := *got[0].Details[0].UUID; uuid != "00000000-0000-0000-0000-000000000002" {
+		t.Fatalf("Expected details UUID from UUIDFunc, got %s", uuid)
+	}
+}
+
+func TestNewUUIDv7(t *testing.T) {
+	a, b := NewUUIDv7(), NewUUIDv7()
+	if id, err := uuid.Parse(a); err != nil || id.Version() != 7 {
+		t.Fatalf("Expected a version 7 UUID, got %s (%v)", a, err)
+	}
+	if a >= b {
+		t.Fatalf("Expected time-ordered UUIDs, got %s then %s", a, b)
+	}
+}
+
+func testDetailsWithUUID(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	ctx := PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true}
+
+	for i := 0; i < 2; i++ {
+		ls := map[Label]int64{NewLabel("Pâine", nil): 1000, NewLabel("Lapte", nil): 2000}
+		trx := NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "")
+		trxUUID := "00000000-0000-0000-0000-000000000001"
+		trx.UUID = &trxUUID
+		for _, d := range trx.Details {
+			detailUUID := "00000000-0000-0000-0000-00000000000" + map[string]string{"Pâine": "2", "Lapte": "3"}[d.Label.Name]
+			d.UUID = &detailUUID
+		}
+
+		if err := (&Transactions{trx}).Push(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var count int64
+	if err := db.Model(&Details{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Fatalf("Expected 2 details after re-import, got %d", count)
+	}
+
+	var got Details
+	if err := db.Where("uuid = ?", "00000000-0000-0000-0000-000000000002").First(&got).Error; err != nil {
+		t.Fatal(err)
+	} else if got.LabelName != "Pâine" {
+		t.Fatalf("Expected caller provided UUID for Pâine, got %v", got)
+	}
+}
+
+func testIndexes(t *testing.T, db *gorm.DB) {
+	m := db.Migrator()
+	for _, idx := range []struct {
+		model interface{}
+		field string
+	}{
+		{&Transaction{}, "Date"},
+		{&Transaction{}, "LabelName"},
+		{&Transaction{}, "SenderName"},
+		{&Transaction{}, "ReceiverName"},
+		{&Details{}, "LabelName"},
+	} {
+		if !m.HasIndex(idx.model, idx.field) {
+			t.Errorf("Expected index on %T.%s", idx.model, idx.field)
+		}
+	}
+}
+
+func testTablePrefix(t *testing.T, db *gorm.DB) {
+	tenant, err := WithTablePrefix(db, "tenantA_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Install(tenant); err != nil {
+		t.Fatal(err)
+	}
+	defer Uninstall(tenant)
+
+	if !db.Migrator().HasTable("tenantA_transactions") {
+		t.Fatal("Expected prefixed transactions table to be installed")
+	}
+
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	ls := map[Label]int64{NewLabel("Pâine", nil): 3000}
+	trx := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "")}
+	if err := trx.Push(PushContext{Storage: tenant, BatchSize: 10, AutoCreateLabels: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Transactions
+	if err := got.Pull(PullContext{Storage: tenant}); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 1 || len(got[0].Details) != 1 {
+		t.Fatalf("Expected one transaction with one detail from prefixed tables, got %v", got)
+	}
+
+	var shared Transactions
+	if err := shared.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(shared) != 0 {
+		t.Fatalf("Expected no transactions in unprefixed tables, got %v", shared)
+	}
+}
+
+type fakePlugin struct {
+	initialized []*gorm.DB
+}
+
+func (p *fakePlugin) Name() string { return "fake" }
+
+func (p *fakePlugin) Initialize(db *gorm.DB) error {
+	p.initialized = append(p.initialized, db)
+	return nil
+}
+
+func TestTablePrefixConfig_SQLite(t *testing.T) {
+	db, err := gorm.Open(_SQLite, &gorm.Config{PrepareStmt: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(db)
+
+	plugin := &fakePlugin{}
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+
+	tenant, err := WithTablePrefix(db, "tenantB_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tenant.PrepareStmt || !tenant.SkipDefaultTransaction {
+		t.Fatalf("Expected the config of the prefixed handle to be kept, got %+v", tenant.Config)
+	} else if len(plugin.initialized) != 2 || plugin.initialized[1] != tenant {
+		t.Fatalf("Expected the plugin to be registered on the prefixed handle, got %v", plugin.initialized)
+	}
+
+	if err := Install(tenant); err != nil {
+		t.Fatal(err)
+	}
+	defer Uninstall(tenant)
+
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trx := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := trx.Push(PushContext{Storage: tenant, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Transactions
+	if err := got.Pull(PullContext{Storage: tenant}); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 1 {
+		t.Fatalf("Expected one transaction from prefixed tables, got %v", got)
+	}
+}
+
+func testTransactionsPreload(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	ls := map[Label]int64{NewLabel("Pâine", nil): 3000}
+	trx := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "")}
+	if err := trx.Push(PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var flat Transactions
+	if err := flat.Pull(PullContext{Storage: db, Preload: PreloadNone}); err != nil {
+		t.Fatal(err)
+	} else if len(flat) != 1 {
+		t.Fatalf("Expected one transaction, got %v", flat)
+	} else if flat[0].Details != nil || flat[0].Label != nil || flat[0].Sender != nil {
+		t.Fatalf("Expected no associations without preloading, got %v", flat[0])
+	} else if flat[0].LabelName != "Alimente" || flat[0].SenderName != "Alexandru" {
+		t.Fatalf("Expected label and sender names without preloading, got %v", flat[0])
+	}
+
+	var full Transactions
+	if err := full.Pull(PullContext{Storage: db, Preload: PreloadAll}); err != nil {
+		t.Fatal(err)
+	} else if full[0].Label == nil || full[0].Receiver == nil || len(full[0].Details) != 1 || full[0].Details[0].Label == nil {
+		t.Fatalf("Expected every association to be preloaded, got %v", full[0])
+	}
+
+	var details Transactions
+	if err := details.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(details[0].Details) != 1 || details[0].Label != nil {
+		t.Fatalf("Expected just the details to be preloaded by default, got %v", details[0])
+	}
+}
+
+func testDuplicateDetailLabels(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trx := NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")
+	trx.Details = []*Details{{LabelName: "?", Amount: 1000}, {LabelName: "?", Amount: 2000}}
+
+	strict := PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true, DisallowDuplicateDetailLabels: true}
+	if err := (&Transactions{trx}).Push(strict); !errors.Is(err, ErrDuplicateDetailLabel) {
+		t.Fatalf("Expected push to fail because of duplicate detail labels but got %v", err)
+	}
+
+	// default behaviour is lenient
+	if err := (&Transactions{trx}).Push(PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testChangedSince(t *testing.T, db *gorm.DB) {
+	ctx := PushContext{Storage: db, BatchSize: 10}
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+
+	older := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := older.Push(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(50 * time.Millisecond)
+
+	newer := Transactions{NewTransaction(date, -1500, NewLabel("Transport", nil), NewActor("Alexandru"), NewActor("Autobuz"), nil, "")}
+	if err := newer.Push(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	pull := PullContext{Storage: db, ChangedSince: since}
+
+	var actors Actors
+	if err := actors.Pull(pull); err != nil {
+		t.Fatal(err)
+	} else if len(actors) != 1 || actors[0].Name != "Autobuz" {
+		t.Fatalf("Expected only the newer actor, got %v", actors)
+	}
+
+	var labels Labels
+	if err := labels.Pull(pull); err != nil {
+		t.Fatal(err)
+	} else if len(labels) != 1 || labels[0].Name != "Transport" {
+		t.Fatalf("Expected only the newer label, got %v", labels)
+	}
+
+	var trxs Transactions
+	if err := trxs.Pull(pull); err != nil {
+		t.Fatal(err)
+	} else if len(trxs) != 1 || trxs[0].Amount != -1500 {
+		t.Fatalf("Expected only the newer transaction, got %v", trxs)
+	}
+}
+
+func testDeleteBefore(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2018-11-01")
+	ls := map[Label]int64{NewLabel("Pâine", nil): 3000}
+
+	var trxs Transactions
+	for i := 0; i < 5; i++ {
+		trxs = append(trxs, NewTransaction(date.AddDate(0, i, 0), -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, ""))
+	}
+
+	ctx := PushContext{Storage: db, BatchSize: 2, AutoCreateLabels: true}
+	if err := trxs.Push(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cutoff, _ := time.Parse("2006-01-02", "2019-01-01")
+	if removed, err := trxs.DeleteBefore(ctx, cutoff); err != nil {
+		t.Fatal(err)
+	} else if removed != 2 {
+		t.Fatalf("Expected 2 transactions removed, got %d", removed)
+	}
+
+	var kept Transactions
+	if err := kept.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(kept) != 3 {
+		t.Fatalf("Expected 3 transactions kept, got %v", kept)
+	}
+	for _, trx := range kept {
+		if trx.Date.Before(cutoff) || len(trx.Details) != 1 {
+			t.Fatalf("Expected only transactions since the cutoff with their details, got %v", trx)
+		}
+	}
+
+	var details int64
+	if err := db.Model(&Details{}).Count(&details).Error; err != nil {
+		t.Fatal(err)
+	} else if details != 3 {
+		t.Fatalf("Expected details of removed transactions to be removed, got %d details", details)
+	}
+
+	if ok, err := (&Actors{}).Exists(PullContext{Storage: db}, "Magazin"); err != nil || !ok {
+		t.Fatalf("Expected actors to be kept, got %v", err)
+	}
+	if ok, err := (&Labels{}).Exists(PullContext{Storage: db}, "Pâine"); err != nil || !ok {
+		t.Fatalf("Expected labels to be kept, got %v", err)
+	}
+}
+
+func testOptimize(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2018-11-01")
+	trxs := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+
+	ctx := PushContext{Storage: db, BatchSize: 10}
+	if err := trxs.Push(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := trxs.DeleteBefore(ctx, date.AddDate(1, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Optimize(db); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testPreserveTime(t *testing.T, db *gorm.DB) {
+	moment, _ := time.Parse(time.RFC3339, "2021-05-01T18:45:30Z")
+
+	pos := Transactions{NewTransaction(moment, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := pos.Push(PushContext{Storage: db, BatchSize: 10, PreserveTime: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	dated := Transactions{NewTransaction(moment, -1500, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := dated.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Transactions
+	if err := got.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 2 {
+		t.Fatalf("Expected 2 transactions, got %v", got)
+	}
+
+	// SQLite keeps whatever is stored regardless of the date type
+	for _, trx := range got {
+		when := trx.Date.UTC().Format(time.RFC3339)
+		if trx.Amount == -3000 && (trx.OccurredAt == nil || when != "2021-05-01T18:45:30Z") {
+			t.Fatalf("Expected time of day to be preserved, got %s", when)
+		} else if trx.Amount == -1500 && db.Dialector.Name() != "sqlite" && when != "2021-05-01T00:00:00Z" {
+			t.Fatalf("Expected date only by default, got %s", when)
+		}
+	}
+}
+
+func testLocation(t *testing.T, db *gorm.DB) {
+	loc := time.FixedZone("EEST", 3*60*60)
+	moment := time.Date(2021, 5, 2, 1, 30, 0, 0, loc) // 22:30 UTC the day before
+
+	trxs := Transactions{NewTransaction(moment, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10, Location: loc}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Transactions
+	if err := got.Pull(PullContext{Storage: db, Location: loc}); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 1 {
+		t.Fatalf("Expected one transaction, got %v", got)
+	} else if day := got[0].Date.In(loc).Format("2006-01-02"); day != "2021-05-02" {
+		t.Fatalf("Expected transaction on the local day 2021-05-02, got %s", day)
+	}
+
+	var since Transactions
+	from := time.Date(2021, 5, 2, 0, 0, 0, 0, loc)
+	if err := since.Pull(PullContext{Storage: db, Location: loc, From: from}); err != nil {
+		t.Fatal(err)
+	} else if len(since) != 1 {
+		t.Fatalf("Expected transaction since the local day %s, got %v", from.Format(DateFormat), since)
+	}
+
+	var until Transactions
+	to := time.Date(2021, 5, 1, 23, 59, 0, 0, loc)
+	if err := until.Pull(PullContext{Storage: db, Location: loc, To: to}); err != nil {
+		t.Fatal(err)
+	} else if len(until) != 0 {
+		t.Fatalf("Expected no transaction until the local day %s, got %v", to.Format(DateFormat), until)
+	}
+}
+
+func testActorsPrefixAndFlags(t *testing.T, db *gorm.DB) {
+	const archived = 1 << 0
+
+	actors := Actors{NewActor("Magazin"), NewActor("Mega Image"), NewActor("Metrou"), NewActor("Alexandru"), NewActor("Mo_ll"), NewActor("Mobil")}
+	actors[5].Flags = archived
+	if err := actors.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Actors
+	if err := got.Pull(PullContext{Storage: db, NamePrefix: "M", ExcludeFlags: archived}); err != nil {
+		t.Fatal(err)
+	} else if names := fmt.Sprint(got.names()); names != "[Magazin Mega Image Metrou Mo_ll]" {
+		t.Fatalf("Expected unarchived actors starting with M, got %s", names)
+	}
+
+	var literal Actors
+	if err := literal.Pull(PullContext{Storage: db, NamePrefix: "Mo_"}); err != nil {
+		t.Fatal(err)
+	} else if names := fmt.Sprint(literal.names()); names != "[Mo_ll]" {
+		t.Fatalf("Expected wildcards in prefix to match literally, got %s", names)
+	}
+}
+
+func testActorsGetOrCreate(t *testing.T, db *gorm.DB) {
+	existing := Actors{NewActor("Magazin")}
+	existing[0].Flags = 3
+	if err := existing.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := PushContext{Storage: db, BatchSize: 10}
+	for i := 0; i < 2; i++ {
+		if actor, err := (&Actors{}).GetOrCreate(ctx, "Alexandru"); err != nil {
+			t.Fatal(err)
+		} else if actor.Name != "Alexandru" || actor.CreatedAt.IsZero() {
+			t.Fatalf("Expected persisted actor, got %v", actor)
+		}
+	}
+
+	var count int64
+	if err := db.Model(&Actor{}).Where("name = ?", "Alexandru").Count(&count).Error; err != nil {
+		t.Fatal(err)
+	} else if count != 1 {
+		t.Fatalf("Expected one actor after getting it twice, got %d", count)
+	}
+
+	if actor, err := (&Actors{}).GetOrCreate(ctx, "Magazin"); err != nil {
+		t.Fatal(err)
+	} else if actor.Flags != 3 {
+		t.Fatalf("Expected existing actor to be left untouched, got %v", actor)
+	}
+}
+
+func testLabelsGetOrCreate(t *testing.T, db *gorm.DB) {
+	ctx := PushContext{Storage: db, BatchSize: 10}
+	parent := NewLabel("Cheltuieli", nil)
+
+	for i := 0; i < 2; i++ {
+		label, err := (&Labels{}).GetOrCreate(ctx, "Alimente", &parent)
+		if err != nil {
+			t.Fatal(err)
+		} else if label.Name != "Alimente" || label.ParentName.String != "Cheltuieli" {
+			t.Fatalf("Expected label linked to its parent, got %v", label)
+		} else if label.Parent == nil || label.Parent.Name != "Cheltuieli" || label.Parent.CreatedAt.IsZero() {
+			t.Fatalf("Expected persisted parent to be preloaded, got %v", label.Parent)
+		}
+	}
+
+	var labels Labels
+	if err := labels.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if names := fmt.Sprint(labels.names()); names != "[Alimente Cheltuieli]" {
+		t.Fatalf("Expected both labels exactly once, got %s", names)
+	}
+}
+
+func testLabelsPushOrder(t *testing.T, db *gorm.DB) {
+	stamp, _ := time.Parse(time.RFC3339, "2021-05-01T10:00:00Z")
+	label := func(name string, parent *Label) Label {
+		lb := NewLabel(name, parent)
+		lb.CreatedAt, lb.UpdatedAt = stamp, stamp
+		return lb
+	}
+
+	root := label("Cheltuieli", nil)
+	groups := []Label{label("Casă", &root), label("Mâncare", &root), label("Transport", &root)}
+
+	var labels Labels
+	var expected []string
+	for i := 0; i < 20; i++ {
+		labels = append(labels, label(fmt.Sprintf("Eticheta %02d", i), &groups[i%len(groups)]))
+	}
+	for i, lb := range labels {
+		if i == 0 {
+			expected = append(expected, "Cheltuieli")
+		}
+		if i < len(groups) {
+			expected = append(expected, groups[i].Name)
+		}
+		expected = append(expected, lb.Name)
+	}
+
+	first, err := PushSQL(&labels, PushContext{Storage: db, BatchSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// parents are upserted as associations first, so only the last
+	// statement has the labels of the collection
+	stmts := strings.Split(first, ";\n")
+	labelsStmt := stmts[len(stmts)-1]
+
+	last := -1
+	for _, name := range expected {
+		pos := strings.Index(labelsStmt, "'"+name+"'")
+		if pos < 0 {
+			pos = strings.Index(labelsStmt, `"`+name+`"`)
+		}
+		if pos <= last {
+			t.Fatalf("Expected label %s to be pushed in first-seen order, got %s", name, labelsStmt)
+		}
+		last = pos
+	}
+
+	for i := 0; i < 10; i++ {
+		if again, err := PushSQL(&labels, PushContext{Storage: db, BatchSize: 100}); err != nil {
+			t.Fatal(err)
+		} else if again != first {
+			t.Fatalf("Expected the same statements on every push, got %s and %s", first, again)
+		}
+	}
+}
+
+func testTransactionsCaughtLabels(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	expenses := NewLabel("Cheltuieli", nil)
+	food := NewLabel("Alimente", &expenses)
+
+	trx := NewTransaction(date, -3000, food, NewActor("Alexandru"), NewActor("Magazin"), nil, "")
+	trx.Details = []*Details{
+		{Label: &Label{Name: "Pâine", Parent: &food}, Amount: 1000},
+		{Label: &Label{Name: "Lapte", Parent: &food}, Amount: 1500},
+		{Label: &Label{Name: "Apă"}, Amount: 500},
+	}
+
+	for i := 0; i < 3; i++ {
+		observer := &fakeObserver{}
+		if err := (&Transactions{trx}).Push(PushContext{Storage: db, BatchSize: 10, Observer: observer}); err != nil {
+			t.Fatal(err)
+		}
+
+		expectedPushes := "[actors/2/<nil> labels/5/<nil> transactions/1/<nil>]"
+		if pushes := fmt.Sprint(observer.pushes); pushes != expectedPushes {
+			t.Fatalf("Expected pushes %s but got %s instead", expectedPushes, pushes)
+		}
+	}
+
+	var labels Labels
+	if err := labels.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if names := fmt.Sprint(labels.names()); names != "[Alimente Apă Cheltuieli Lapte Pâine]" {
+		t.Fatalf("Expected every label of the transaction, got %s", names)
+	}
+}
+
+func testForceExpensesNegative(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	ls := map[Label]int64{NewLabel("Pâine", nil): 3000}
+
+	outflow := NewTransaction(date, 3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "")
+	outflow.Flags = FlagOutflow
+	income := NewTransaction(date, 5000, NewLabel("Salariu", nil), NewActor("Angajator"), NewActor("Alexandru"), nil, "")
+	expense := NewTransaction(date, -1500, NewLabel("Transport", nil), NewActor("Alexandru"), NewActor("Autobuz"), nil, "")
+	expense.Flags = FlagOutflow
+
+	trxs := Transactions{outflow, income, expense}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true, ForceExpensesNegative: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Transactions
+	if err := got.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	}
+
+	amounts := make(map[string]int64)
+	for _, trx := range got {
+		amounts[trx.LabelName] = trx.Amount
+	}
+
+	expected := map[string]int64{"Alimente": -3000, "Salariu": 5000, "Transport": -1500}
+	if fmt.Sprint(amounts) != fmt.Sprint(expected) {
+		t.Fatalf("Expected normalized amounts %v but got %v instead", expected, amounts)
+	}
+}
+
+func testValidateHeaders(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	strict := PushContext{Storage: db, BatchSize: 10, ValidateHeaders: true}
+
+	malformed := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	malformed[0].Headers = "imagepath"
+	if err := malformed.Push(strict); !errors.Is(err, ErrMalformedHeader) {
+		t.Fatalf("Expected push to fail because of malformed header but got %v", err)
+	}
+
+	wellFormed := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	wellFormed[0].Headers = "image=/path/to/img"
+	if err := wellFormed.Push(strict); err != nil {
+		t.Fatal(err)
+	}
+
+	// default behaviour is lenient
+	if err := malformed.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testDetailLabelsUnderTransactionLabel(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	strict := PushContext{Storage: db, BatchSize: 10, RequireDetailLabelsUnderTransactionLabel: true}
+
+	root := NewLabel("Cheltuieli", nil)
+	food := NewLabel("Alimente", &root)
+	bread := NewLabel("Pâine", &food)
+	fuel := NewLabel("Combustibil", &root)
+
+	inTree := Transactions{NewTransaction(date, -3000, food, NewActor("Alexandru"), NewActor("Magazin"),
+		map[Label]int64{bread: 1000, food: 2000}, "")}
+	if err := inTree.Push(strict); err != nil {
+		t.Fatal(err)
+	}
+
+	outOfTree := Transactions{NewTransaction(date, -3000, food, NewActor("Alexandru"), NewActor("Magazin"),
+		map[Label]int64{bread: 1000, fuel: 2000}, "")}
+	if err := outOfTree.Push(strict); !errors.Is(err, ErrDetailLabelOutsideTree) {
+		t.Fatalf("Expected push to fail because of a label outside the tree but got %v", err)
+	}
+
+	// default behaviour is lenient
+	if err := outOfTree.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testPreloadLabelAncestors(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	root := NewLabel("Cheltuieli", nil)
+	food := NewLabel("Alimente", &root)
+	groceries := NewLabel("Băcănie", &food)
+
+	trxs := Transactions{NewTransaction(date, -3000, groceries, NewActor("Alexandru"), NewActor("Magazin"),
+		map[Label]int64{NewLabel("Pâine", &groceries): 3000}, "")}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	var pulled Transactions
+	if err := pulled.Pull(PullContext{Storage: db, PreloadLabelAncestors: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var chain []string
+	for lb := pulled[0].Label; lb != nil; lb = lb.Parent {
+		chain = append(chain, lb.Name)
+	}
+	if fmt.Sprint(chain) != "[Băcănie Alimente Cheltuieli]" {
+		t.Fatalf("Expected the label chain up to the root but got %v", chain)
+	}
+
+	chain = nil
+	for lb := pulled[0].Details[0].Label; lb != nil; lb = lb.Parent {
+		chain = append(chain, lb.Name)
+	}
+	if fmt.Sprint(chain) != "[Pâine Băcănie Alimente Cheltuieli]" {
+		t.Fatalf("Expected the details label chain up to the root but got %v", chain)
+	}
+}
+
+func testTransactionMeta(t *testing.T, db *gorm.DB) {
+	type geo struct {
+		Lat float64 `json:"lat"`
+		Lng float64 `json:"lng"`
+	}
+
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trx := NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")
+	trx.Headers = "image=/path/to/img"
+	if err := trx.SetMeta("tags", []string{"weekend", "family"}); err != nil {
+		t.Fatal(err)
+	} else if err := trx.SetMeta("location", map[string]geo{"store": {Lat: 44.43, Lng: 26.1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&Transactions{trx}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	var trxs Transactions
+	if err := trxs.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if trxs[0].Headers != "image=/path/to/img" {
+		t.Fatalf("Expected headers to be kept but got %q", trxs[0].Headers)
+	}
+
+	var tags []string
+	if ok, err := trxs[0].GetMeta("tags", &tags); err != nil || !ok {
+		t.Fatalf("Expected tags metadata but got %v (%v)", ok, err)
+	} else if fmt.Sprint(tags) != "[weekend family]" {
+		t.Fatalf("Expected tags [weekend family] but got %v", tags)
+	}
+
+	var location map[string]geo
+	if ok, err := trxs[0].GetMeta("location", &location); err != nil || !ok {
+		t.Fatalf("Expected location metadata but got %v (%v)", ok, err)
+	} else if location["store"] != (geo{Lat: 44.43, Lng: 26.1}) {
+		t.Fatalf("Expected nested location metadata but got %v", location)
+	}
+
+	if ok, err := trxs[0].GetMeta("unknown", new(string)); err != nil || ok {
+		t.Fatalf("Expected no metadata for an unknown key but got %v (%v)", ok, err)
+	}
+}
+
+func testOnlyWithoutDetails(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trxs := Transactions{
+		NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"),
+			map[Label]int64{NewLabel("Pâine", nil): 3000}, ""),
+		NewTransaction(date, -1500, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"), nil, ""),
+	}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	var bare Transactions
+	if err := bare.Pull(PullContext{Storage: db, OnlyWithoutDetails: true}); err != nil {
+		t.Fatal(err)
+	} else if len(bare) != 1 || bare[0].Amount != -1500 {
+		t.Fatalf("Expected only the bare transaction but got %v", bare)
+	}
+
+	var itemized Transactions
+	if err := itemized.Pull(PullContext{Storage: db, OnlyWithDetails: true}); err != nil {
+		t.Fatal(err)
+	} else if len(itemized) != 1 || itemized[0].Amount != -3000 {
+		t.Fatalf("Expected only the itemized transaction but got %v", itemized)
+	}
+
+	var all Transactions
+	if err := all.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(all) != 2 {
+		t.Fatalf("Expected both transactions by default but got %v", all)
+	}
+}
+
+func testReadStorage(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	replica := begin(sqlite.Open("file:replica?mode=memory&cache=shared"))
+	defer end(replica)
+
+	primary := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := primary.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	replicated := Transactions{NewTransaction(date, -1500, NewLabel("Transport", nil), NewActor("Alexandru"), NewActor("Metrou"), nil, "")}
+	if err := replicated.Push(PushContext{Storage: replica, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := PullContext{Storage: db, ReadStorage: replica}
+
+	var trxs Transactions
+	if err := trxs.Pull(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(trxs) != 1 || trxs[0].Amount != -1500 {
+		t.Fatalf("Expected transactions to be pulled from the replica but got %v", trxs)
+	}
+
+	var actors Actors
+	if err := actors.Pull(ctx); err != nil {
+		t.Fatal(err)
+	} else if names := actors.names(); fmt.Sprint(names) != "[Alexandru Metrou]" {
+		t.Fatalf("Expected actors to be pulled from the replica but got %v", names)
+	}
+
+	if ok, err := (&Labels{}).Exists(ctx, "Alimente"); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Fatal("Expected the label of the primary not to exist on the replica")
+	}
+
+	// aggregations and usage are reads as well
+	if _, expense, err := trxs.IncomeExpense(ctx); err != nil {
+		t.Fatal(err)
+	} else if expense != -1500 {
+		t.Fatalf("Expected expenses to be summed on the replica but got %d", expense)
+	}
+
+	if used, err := trxs.UsedLabels(ctx); err != nil {
+		t.Fatal(err)
+	} else if fmt.Sprint(used) != "[Transport]" {
+		t.Fatalf("Expected labels used on the replica but got %v", used)
+	}
+
+	// without a replica pulls go to the primary
+	if err := trxs.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(trxs) != 1 || trxs[0].Amount != -3000 {
+		t.Fatalf("Expected transactions to be pulled from the primary but got %v", trxs)
+	}
+}
+
+func testOptimisticLocking(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trxs := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	// two clients read the same transaction
+	var first, second Transactions
+	if err := first.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if err := second.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	}
+
+	first[0].Headers = "edited=first"
+	if err := first.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	} else if first[0].Version != 1 {
+		t.Fatalf("Expected the pushed transaction to be at version 1 but got %d", first[0].Version)
+	}
+
+	second[0].Headers = "edited=second"
+	if err := second.Push(PushContext{Storage: db, BatchSize: 10}); !errors.Is(err, ErrStaleVersion) {
+		t.Fatalf("Expected a stale update to be rejected but got %v", err)
+	}
+
+	var pulled Transactions
+	if err := pulled.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if pulled[0].Headers != "edited=first" || pulled[0].Version != 1 {
+		t.Fatalf("Expected the first update to be kept at version 1 but got %q at %d", pulled[0].Headers, pulled[0].Version)
+	}
+
+	// the first client can keep editing with the new version
+	first[0].Headers = "edited=again"
+	if err := first.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	} else if first[0].Version != 2 {
+		t.Fatalf("Expected the pushed transaction to be at version 2 but got %d", first[0].Version)
+	}
+
+	// every other update makes a new version as well
+	uuid := *first[0].UUID
+	if err := first.SetStatus(PushContext{Storage: db}, []string{uuid}, StatusCleared); err != nil {
+		t.Fatal(err)
+	} else if err := first.ReplaceDetails(PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true}, uuid,
+		[]*Details{{LabelName: "Pâine", Amount: 3000}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := first.Get(PullContext{Storage: db}, uuid); err != nil {
+		t.Fatal(err)
+	} else if got.Version != 4 {
+		t.Fatalf("Expected the transaction to be at version 4 but got %d", got.Version)
+	}
+
+	first[0].Headers = "edited=stale"
+	if err := first.Push(PushContext{Storage: db, BatchSize: 10}); !errors.Is(err, ErrStaleVersion) {
+		t.Fatalf("Expected an update older than the last ones to be rejected but got %v", err)
+	}
+}
+
+func testSetFlags(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	flagged := func(amount int64, flags uint16) Transaction {
+		trx := NewTransaction(date, amount, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")
+		trx.Flags = flags
+		return trx
+	}
+
+	trxs := Transactions{flagged(-1000, 0), flagged(-2000, FlagOutflow), flagged(-3000, FlagOutflow|1), flagged(-4000, 1)}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	uuids := []string{*trxs[0].UUID, *trxs[1].UUID, *trxs[2].UUID}
+	if n, err := trxs.SetFlags(PushContext{Storage: db}, uuids, FlagNonExpense, FlagOutflow); err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Fatalf("Expected 3 transactions to be updated but got %d", n)
+	}
+
+	var pulled Transactions
+	if err := pulled.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	}
+
+	var flags []string
+	for _, trx := range pulled {
+		flags = append(flags, fmt.Sprintf("%d:%#x/v%d", trx.Amount, trx.Flags, trx.Version))
+	}
+
+	expected := fmt.Sprint([]string{"-1000:0x8000/v1", "-2000:0x8000/v1", "-3000:0x8001/v1", "-4000:0x1/v0"})
+	if fmt.Sprint(flags) != expected {
+		t.Fatalf("Expected flags %s but got %v instead", expected, flags)
+	}
+}
+
+func testPullDetailsFlags(t *testing.T, db *gorm.DB) {
+	const reimbursable uint16 = 1 << 0
+
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trxs := Transactions{
+		NewTransaction(date, -3000, NewLabel("Deplasare", nil), NewActor("Alexandru"), NewActor("Hotel"),
+			map[Label]int64{NewLabel("Cazare", nil): 2000, NewLabel("Minibar", nil): 1000}, ""),
+		NewTransaction(date.AddDate(0, 0, 1), -1500, NewLabel("Deplasare", nil), NewActor("Alexandru"), NewActor("Taxi"),
+			map[Label]int64{NewLabel("Transport", nil): 1500}, ""),
+	}
+	for _, d := range append(trxs[0].Details, trxs[1].Details...) {
+		if d.Label.Name != "Minibar" {
+			d.Flags = reimbursable
+		}
+	}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	labels := func(ctx PullContext) string {
+		details, err := (&Transactions{}).PullDetails(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out []string
+		for _, d := range details {
+			out = append(out, d.Label.Name)
+		}
+		return fmt.Sprint(out)
+	}
+
+	if all := labels(PullContext{Storage: db}); all != "[Transport Cazare Minibar]" {
+		t.Fatalf("Expected every detail but got %s", all)
+	}
+
+	if flagged := labels(PullContext{Storage: db, DetailFlags: reimbursable}); flagged != "[Transport Cazare]" {
+		t.Fatalf("Expected only the reimbursable details but got %s", flagged)
+	}
+
+	if excluded := labels(PullContext{Storage: db, ExcludeFlags: reimbursable}); excluded != "[Minibar]" {
+		t.Fatalf("Expected only the details which aren't reimbursable but got %s", excluded)
+	}
+
+	if windowed := labels(PullContext{Storage: db, DetailFlags: reimbursable, To: date}); windowed != "[Cazare]" {
+		t.Fatalf("Expected only the reimbursable details within the window but got %s", windowed)
+	}
+}
+
+func testLabelsPushSkipDedupe(t *testing.T, db *gorm.DB) {
+	root := NewLabel("Cheltuieli", nil)
+	groups := []Label{NewLabel("Casă", &root), NewLabel("Mâncare", &root)}
+
+	labels := Labels{root, groups[0], groups[1]}
+	for i := 0; i < 10; i++ {
+		labels = append(labels, NewLabel(fmt.Sprintf("Eticheta %02d", i), &groups[i%len(groups)]))
+	}
+
+	state := func() map[string]string {
+		var pulled Labels
+		if err := pulled.Pull(PullContext{Storage: db, Limit: 100}); err != nil {
+			t.Fatal(err)
+		}
+		names := make(map[string]string)
+		for _, lb := range pulled {
+			names[lb.Name] = lb.ParentName.String
+		}
+		return names
+	}
+
+	if err := labels.Push(PushContext{Storage: db, BatchSize: 5, SkipDedupe: true}); err != nil {
+		t.Fatal(err)
+	}
+	fast := state()
+
+	if len(fast) != len(labels) {
+		t.Fatalf("Expected %d labels pushed, got %v", len(labels), fast)
+	}
+
+	if err := labels.Push(PushContext{Storage: db, BatchSize: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if deduped := state(); !reflect.DeepEqual(fast, deduped) {
+		t.Fatalf("Expected same labels with and without dedupe, got %v and %v", fast, deduped)
+	}
+
+	for _, lb := range labels {
+		parent := ""
+		if lb.Parent != nil {
+			parent = lb.Parent.Name
+		}
+		if fast[lb.Name] != parent {
+			t.Fatalf("Expected label %s under %q, got %q", lb.Name, parent, fast[lb.Name])
+		}
+	}
+}
+
+func testHasHeaderKey(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trx := func(amount int64, headers string) Transaction {
+		trx := NewTransaction(date, amount, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")
+		trx.Headers = headers
+		return trx
+	}
+
+	trxs := Transactions{
+		trx(-1000, "image=/path/to/img"),
+		trx(-2000, "source=bank;image=/path/to/img"),
+		trx(-3000, "source=bank"),
+		trx(-4000, "thumbnail_image=/path/to/img"),
+		trx(-5000, ""),
+		trx(-6000, "source=card; receipt =/path/to/img"),
+		trx(-7000, "note=two words ; receipt= /path/to/my img"),
+	}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10, ValidateHeaders: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string]string{
+		"image":   "[-1000 -2000]",
+		"source":  "[-2000 -3000 -6000]",
+		"receipt": "[-6000 -7000]",
+		"note":    "[-7000]",
+		"words":   "[]",
+		"im%":     "[]",
+		"":        "[-1000 -2000 -3000 -4000 -5000 -6000 -7000]",
+	} {
+		var pulled Transactions
+		if err := pulled.Pull(PullContext{Storage: db, HasHeaderKey: key}); err != nil {
+			t.Fatal(err)
+		}
+
+		amounts := make([]int64, 0, len(pulled))
+		for _, trx := range pulled {
+			amounts = append(amounts, trx.Amount)
+		}
+		if fmt.Sprint(amounts) != expected {
+			t.Fatalf("Expected transactions %s with header %q, got %v", expected, key, amounts)
+		}
+	}
+
+	// spaces within values are kept, only the ones around them are left out
+	var pulled Transactions
+	if err := pulled.Pull(PullContext{Storage: db, HasHeaderKey: "note"}); err != nil {
+		t.Fatal(err)
+	} else if len(pulled) != 1 || pulled[0].Headers != "note=two words;receipt=/path/to/my img" {
+		t.Fatalf("Expected normalized headers with spaces within values, got %v", pulled)
+	}
+}
+
+func testPreloadReferences(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	root := NewLabel("Cheltuieli", nil)
+	food := NewLabel("Alimente", &root)
+
+	trxs := Transactions{
+		NewTransaction(date, -3000, food, NewActor("Alexandru"), NewActor("Magazin"),
+			map[Label]int64{NewLabel("Pâine", &food): 1000, NewLabel("Apă", &food): 2000}, ""),
+		NewTransaction(date, -1500, food, NewActor("Alexandru"), NewActor("Piață"), nil, ""),
+	}
+
+	strict := PushContext{Storage: db, BatchSize: 10, RequireExistingActors: true, RequireExistingLabels: true}
+	if err := trxs.Push(strict); !errors.Is(err, ErrUnknownActor) {
+		t.Fatalf("Expected strict push to fail with ErrUnknownActor before preloading, got %v", err)
+	}
+
+	if err := PreloadReferences(PushContext{Storage: db, BatchSize: 2}, trxs); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"Alexandru", "Magazin", "Piață"} {
+		if ok, err := (&Actors{}).Exists(PullContext{Storage: db}, name); err != nil || !ok {
+			t.Fatalf("Expected actor %s to be preloaded, got %v (%v)", name, ok, err)
+		}
+	}
+	for _, name := range []string{"Cheltuieli", "Alimente", "Pâine", "Apă"} {
+		if ok, err := (&Labels{}).Exists(PullContext{Storage: db}, name); err != nil || !ok {
+			t.Fatalf("Expected label %s to be preloaded, got %v (%v)", name, ok, err)
+		}
+	}
+
+	if err := trxs.Push(strict); err != nil {
+		t.Fatal(err)
+	}
+
+	var pulled Transactions
+	if err := pulled.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(pulled) != len(trxs) {
+		t.Fatalf("Expected %d transactions pushed, got %d", len(trxs), len(pulled))
+	}
+}
+
+func testMaxDetails(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	strict := PushContext{Storage: db, BatchSize: 10, MaxDetails: 2}
+
+	ls := map[Label]int64{NewLabel("Pâine", nil): 1000, NewLabel("Apă", nil): 1000, NewLabel("Lapte", nil): 1000}
+	crowded := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "")}
+	if err := crowded.Push(strict); !errors.Is(err, ErrTooManyDetails) {
+		t.Fatalf("Expected push to fail because of too many details but got %v", err)
+	} else if !strings.Contains(err.Error(), *crowded[0].UUID) {
+		t.Fatalf("Expected error to name the transaction %s, got %v", *crowded[0].UUID, err)
+	}
+
+	var pulled Transactions
+	if err := pulled.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(pulled) != 0 {
+		t.Fatalf("Expected no transaction pushed, got %v", pulled)
+	}
+
+	ls = map[Label]int64{NewLabel("Pâine", nil): 1000, NewLabel("Apă", nil): 2000}
+	itemized := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "")}
+	if err := itemized.Push(strict); err != nil {
+		t.Fatal(err)
+	}
+
+	// default behaviour is unlimited
+	if err := crowded.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestActorsAPI_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testActorsAPI(t, db)
+}
+
+func TestLabelsAPI_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testLabelsAPI(t, db)
+}
+
+func TestTransactionsAPI_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testTransactionsAPI(t, db)
+}
+
+func TestIncorrectAmountForTransaction_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testIncorrectAmountForTransaction(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestPrimaryRequestsWithTransactions_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testPrimaryRequestsWithTransactions(t, db)
+}
+
+func TestPrimaryRequestsWithLabelsTree_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testPrimaryRequestsWithLabelsTree(t, db)
+}
+
+func TestTransactionJustAppendFlag_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testTransactionJustAppendFlag(t, db)
+}
+
+func TestLabelParentUpsert_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testLabelParentUpsert(t, db)
+}
+
+func TestEmptyNameChecks_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testEmptyNameChecks(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestTransactionUpdateColumns_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testTransactionUpdateColumns(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestExistsChecks_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testExistsChecks(t, db)
+}
+
+func TestSingleRecordGetters_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testSingleRecordGetters(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestSentinelErrors_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testSentinelErrors(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestRegistryObserver_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testRegistryObserver(t, db)
+}
+
+func TestRegistryLogger_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testRegistryLogger(t, db)
+}
+
+func TestDetailsLabelIntegrity_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testDetailsLabelIntegrity(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestRequireExistingReferences_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testRequireExistingReferences(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestCloseStorage_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testCloseStorage(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestConfigurePool_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testConfigurePool(t, db)
+}
+
+func TestPullByUUIDs_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testPullByUUIDs(t, db)
+}
+
+func TestSkipInvalidTransactions_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testSkipInvalidTransactions(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestReplaceDetails_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testReplaceDetails(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestRequireDetails_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testRequireDetails(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestUUIDFunc_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testUUIDFunc(t, db)
+}
+
+func TestDetailsWithUUID_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testDetailsWithUUID(t, db)
+}
+
+func TestIndexes_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testIndexes(t, db)
+}
+
+func TestTablePrefix_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testTablePrefix(t, db)
+}
+
+func TestTransactionsPreload_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testTransactionsPreload(t, db)
+}
+
+func TestDuplicateDetailLabels_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testDuplicateDetailLabels(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestChangedSince_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testChangedSince(t, db)
+}
+
+func TestDeleteBefore_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testDeleteBefore(t, db)
+}
+
+func TestOptimize_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testOptimize(t, db)
+}
+
+func TestPreserveTime_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testPreserveTime(t, db)
+}
+
+func TestLocation_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testLocation(t, db)
+}
+
+func TestActorsPrefixAndFlags_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testActorsPrefixAndFlags(t, db)
+}
+
+func TestActorsGetOrCreate_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testActorsGetOrCreate(t, db)
+}
+
+func TestLabelsGetOrCreate_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testLabelsGetOrCreate(t, db)
+}
+
+func TestLabelsPushOrder_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testLabelsPushOrder(t, db)
+}
+
+func TestTransactionsCaughtLabels_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testTransactionsCaughtLabels(t, db)
+}
+
+func TestForceExpensesNegative_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testForceExpensesNegative(t, db)
+}
+
+func TestValidateHeaders_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testValidateHeaders(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestDetailLabelsUnderTransactionLabel_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testDetailLabelsUnderTransactionLabel(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestPreloadLabelAncestors_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testPreloadLabelAncestors(t, db)
+}
+
+func TestTransactionMeta_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testTransactionMeta(t, db)
+}
+
+func TestOnlyWithoutDetails_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testOnlyWithoutDetails(t, db)
+}
+
+func TestReadStorage_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testReadStorage(t, db)
+}
+
+func TestOptimisticLocking_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testOptimisticLocking(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestSetFlags_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testSetFlags(t, db)
+}
+
+func TestPullDetailsFlags_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testPullDetailsFlags(t, db)
+}
+
+func TestLabelsPushSkipDedupe_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testLabelsPushSkipDedupe(t, db)
+}
+
+func TestHasHeaderKey_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testHasHeaderKey(t, db)
+}
+
+func TestPreloadReferences_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testPreloadReferences(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestMaxDetails_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testMaxDetails(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestActorsAPI_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testActorsAPI(t, db)
+}
+
+func TestLabelsAPI_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testLabelsAPI(t, db)
+}
+
+func TestTransactionsAPI_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testTransactionsAPI(t, db)
+}
+
+func TestIncorrectAmountForTransaction_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testIncorrectAmountForTransaction(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestPrimaryRequestsWithTransactions_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testPrimaryRequestsWithTransactions(t, db)
+}
+
+func TestPrimaryRequestsWithLabelsTree_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testPrimaryRequestsWithLabelsTree(t, db)
+}
+
+func TestTransactionJustAppendFlag_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testTransactionJustAppendFlag(t, db)
+}
+
+func TestLabelParentUpsert_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testLabelParentUpsert(t, db)
+}
+
+func TestEmptyNameChecks_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testEmptyNameChecks(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestTransactionUpdateColumns_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testTransactionUpdateColumns(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestExistsChecks_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testExistsChecks(t, db)
+}
+
+func TestSingleRecordGetters_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testSingleRecordGetters(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestSentinelErrors_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testSentinelErrors(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestRegistryObserver_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testRegistryObserver(t, db)
+}
+
+func TestRegistryLogger_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testRegistryLogger(t, db)
+}
+
+func TestDetailsLabelIntegrity_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testDetailsLabelIntegrity(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestRequireExistingReferences_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testRequireExistingReferences(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestCloseStorage_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testCloseStorage(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestConfigurePool_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testConfigurePool(t, db)
+}
+
+func TestPullByUUIDs_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testPullByUUIDs(t, db)
+}
+
+func TestSkipInvalidTransactions_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testSkipInvalidTransactions(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestReplaceDetails_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testReplaceDetails(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestRequireDetails_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testRequireDetails(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestUUIDFunc_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testUUIDFunc(t, db)
+}
+
+func TestDetailsWithUUID_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testDetailsWithUUID(t, db)
+}
+
+func TestIndexes_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testIndexes(t, db)
+}
+
+func TestTablePrefix_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testTablePrefix(t, db)
+}
+
+func TestTransactionsPreload_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testTransactionsPreload(t, db)
+}
+
+func TestDuplicateDetailLabels_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testDuplicateDetailLabels(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestChangedSince_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testChangedSince(t, db)
+}
+
+func TestDeleteBefore_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testDeleteBefore(t, db)
+}
+
+func TestOptimize_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testOptimize(t, db)
+}
+
+func TestPreserveTime_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testPreserveTime(t, db)
+}
+
+func TestLocation_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testLocation(t, db)
+}
+
+func TestActorsPrefixAndFlags_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testActorsPrefixAndFlags(t, db)
+}
+
+func TestActorsGetOrCreate_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testActorsGetOrCreate(t, db)
+}
+
+func TestLabelsGetOrCreate_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testLabelsGetOrCreate(t, db)
+}
+
+func TestLabelsPushOrder_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testLabelsPushOrder(t, db)
+}
+
+func TestTransactionsCaughtLabels_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testTransactionsCaughtLabels(t, db)
+}
+
+func TestForceExpensesNegative_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testForceExpensesNegative(t, db)
+}
+
+func TestValidateHeaders_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testValidateHeaders(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestDetailLabelsUnderTransactionLabel_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testDetailLabelsUnderTransactionLabel(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestPreloadLabelAncestors_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testPreloadLabelAncestors(t, db)
+}
+
+func TestTransactionMeta_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testTransactionMeta(t, db)
+}
+
+func TestOnlyWithoutDetails_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testOnlyWithoutDetails(t, db)
+}
+
+func TestReadStorage_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testReadStorage(t, db)
+}
+
+func TestOptimisticLocking_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testOptimisticLocking(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestSetFlags_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testSetFlags(t, db)
+}
+
+func TestPullDetailsFlags_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testPullDetailsFlags(t, db)
+}
+
+func TestLabelsPushSkipDedupe_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testLabelsPushSkipDedupe(t, db)
+}
+
+func TestHasHeaderKey_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testHasHeaderKey(t, db)
+}
+
+func TestPreloadReferences_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testPreloadReferences(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestMaxDetails_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testMaxDetails(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestActorsAPI_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testActorsAPI(t, db)
+}
+
+func TestLabelsAPI_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testLabelsAPI(t, db)
+}
+
+func TestTransactionsAPI_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testTransactionsAPI(t, db)
+}
+
+func TestTransactionJustAppendFlag_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testTransactionJustAppendFlag(t, db)
+}
+
+func TestIncorrectAmountForTransaction_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testIncorrectAmountForTransaction(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestPrimaryRequestsWithTransactions_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testPrimaryRequestsWithTransactions(t, db)
+}
+
+func TestPrimaryRequestsWithLabelsTree_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testPrimaryRequestsWithLabelsTree(t, db)
+}
+
+func TestLabelParentUpsert_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testLabelParentUpsert(t, db)
+}
+
+func TestEmptyNameChecks_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testEmptyNameChecks(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestTransactionUpdateColumns_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testTransactionUpdateColumns(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestExistsChecks_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testExistsChecks(t, db)
+}
+
+func TestSingleRecordGetters_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testSingleRecordGetters(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestSentinelErrors_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testSentinelErrors(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestRegistryObserver_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testRegistryObserver(t, db)
+}
+
+func TestRegistryLogger_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testRegistryLogger(t, db)
+}
+
+func TestDetailsLabelIntegrity_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testDetailsLabelIntegrity(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestRequireExistingReferences_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testRequireExistingReferences(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestCloseStorage_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testCloseStorage(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestConfigurePool_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testConfigurePool(t, db)
+}
+
+func TestPullByUUIDs_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testPullByUUIDs(t, db)
+}
+
+func TestSkipInvalidTransactions_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testSkipInvalidTransactions(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestReplaceDetails_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testReplaceDetails(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestRequireDetails_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testRequireDetails(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestUUIDFunc_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testUUIDFunc(t, db)
+}
+
+func TestDetailsWithUUID_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testDetailsWithUUID(t, db)
+}
+
+func TestIndexes_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testIndexes(t, db)
+}
+
+func TestTablePrefix_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testTablePrefix(t, db)
+}
+
+func TestTransactionsPreload_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testTransactionsPreload(t, db)
+}
+
+func TestDuplicateDetailLabels_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testDuplicateDetailLabels(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestChangedSince_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testChangedSince(t, db)
+}
+
+func TestDeleteBefore_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testDeleteBefore(t, db)
+}
+
+func TestOptimize_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testOptimize(t, db)
+}
+
+func TestPreserveTime_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testPreserveTime(t, db)
+}
+
+func TestLocation_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testLocation(t, db)
+}
+
+func TestActorsPrefixAndFlags_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testActorsPrefixAndFlags(t, db)
+}
+
+func TestActorsGetOrCreate_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testActorsGetOrCreate(t, db)
+}
+
+func TestLabelsGetOrCreate_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testLabelsGetOrCreate(t, db)
+}
+
+func TestLabelsPushOrder_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testLabelsPushOrder(t, db)
+}
+
+func TestTransactionsCaughtLabels_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testTransactionsCaughtLabels(t, db)
+}
+
+func TestForceExpensesNegative_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testForceExpensesNegative(t, db)
+}
+
+func TestValidateHeaders_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testValidateHeaders(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestDetailLabelsUnderTransactionLabel_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testDetailLabelsUnderTransactionLabel(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestPreloadLabelAncestors_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testPreloadLabelAncestors(t, db)
+}
+
+func TestTransactionMeta_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testTransactionMeta(t, db)
+}
+
+func TestOnlyWithoutDetails_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testOnlyWithoutDetails(t, db)
+}
+
+func TestReadStorage_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testReadStorage(t, db)
+}
+
+func TestOptimisticLocking_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testOptimisticLocking(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestSetFlags_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testSetFlags(t, db)
+}
+
+func TestPullDetailsFlags_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testPullDetailsFlags(t, db)
+}
+
+func TestLabelsPushSkipDedupe_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testLabelsPushSkipDedupe(t, db)
+}
+
+func TestLabelSetCatch(t *testing.T) {
+	leaves := benchDeepTree(10)
+	leaves = append(leaves, NewLabel("Nivel 005", nil), NewLabel("Altceva", nil))
+
+	// the set of labels must be the same as a full walk of every chain
+	seen := make(map[string]bool)
+	var expected []string
+	labels := newLabelSet()
+	for i := 0; i < 3*len(leaves); i++ {
+		lb := leaves[(i*7)%len(leaves)]
+		for p := &lb; p != nil; p = p.Parent {
+			if !seen[p.Name] {
+				seen[p.Name] = true
+				expected = append(expected, p.Name)
+			}
+		}
+		labels.catch(lb)
+	}
+
+	if names := labels.list.names(); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected labels %v, got %v", expected, names)
+	}
+}
+
+func TestHasHeaderKey_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testHasHeaderKey(t, db)
+}
+
+func TestPreloadReferences_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testPreloadReferences(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestMaxDetails_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testMaxDetails(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestIncorrectTransactions_Json(t *testing.T) {
+	input := `{
+	    "amount": "100",
+	    "date": 31231435,
+	    "sender": "?!!",
+	    "receiver": "??!",
+	    "label" "???"
+	}`
+
+	var trx Transactions
+	if err := FromJson([]byte(input), &trx); err == nil {
+		t.Fatal("Expected failure from invalid JSON but instead it worked")
+	}
+
+	if len(trx) != 0 {
+		t.Fatal("Expected no transactions because of inccorect JSON input")
+	}
+}
+
+func TestEncodeDecodeTransactions_Json(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-04-24")
+
+	oneTransaction := Transactions{
+		Transaction{
+			Date:         date,
+			Amount:       -100, // 1.00
+			LabelName:    "?",
+			SenderName:   "?",
+			ReceiverName: "?",
+			Signature:    "?",
+			Details: []*Details{
+				{
+					LabelName: "?",
+					Amount:    50,
+				},
+				{
+					LabelName: "?",
+					Amount:    30,
+				},
+				{
+					LabelName: "?",
+					Amount:    20,
+				},
+			},
+		},
+	}
+
+	expectedJson := `[
+		{
+			"date": "2021-04-24T00:00:00Z",
+			"amount": -100,
+			"label": "?",
+			"sender": "?",
+			"receiver": "?",
+			"signature": "?",
+			"flags": 0,
+			"headers": "",
+			"details": [
 				{
 					"label": "?",
 					"amount": 50,
@@ -896,3 +3599,197 @@ func TestEncodeDecodeLabels_Json(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestNewTransactionDetailsOrder_Json(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-04-24")
+	details := map[Label]int64{
+		NewLabel("Pâine", nil): 1000, NewLabel("Apă", nil): 500, NewLabel("Lapte", nil): 700,
+		NewLabel("Ouă", nil): 1200, NewLabel("Brânză", nil): 2600,
+	}
+
+	var first []byte
+	for i := 0; i < 10; i++ {
+		trx := NewTransaction(date, -6000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), details, "")
+		out, err := ToJson(&Transactions{trx})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if first == nil {
+			first = out
+		} else if string(out) != string(first) {
+			t.Fatalf("Expected the same transaction to serialize the same way, got %s and %s", first, out)
+		}
+	}
+}
+
+func TestEncodeDecodeTransactions_JsonStream(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-04-24")
+
+	oneTransaction := Transactions{
+		Transaction{
+			Date:         date,
+			Amount:       -100, // 1.00
+			LabelName:    "?",
+			SenderName:   "?",
+			ReceiverName: "?",
+			Signature:    "?",
+			Details: []*Details{
+				{
+					LabelName: "?",
+					Amount:    70,
+				},
+				{
+					LabelName: "?",
+					Amount:    30,
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeJSON(&buf, oneTransaction); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ToJson(oneTransaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(out, bytes.TrimSpace(buf.Bytes())) {
+		t.Fatal("Expected streamed JSON to match with ToJson output")
+	}
+
+	var tmp Transactions
+	if err := DecodeJSON(&buf, &tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	if out2, err := ToJson(tmp); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(out, out2) {
+		t.Fatal("Expected JSON results to be the same")
+	}
+}
+
+func TestUnknownFieldsTransactions_Json(t *testing.T) {
+	input := `[
+		{
+			"date": "2021-04-24T00:00:00Z",
+			"amount": -100,
+			"lable": "?",
+			"sender": "?",
+			"receiver": "?"
+		}
+	]`
+
+	var trx Transactions
+	if err := FromJson([]byte(input), &trx); err != nil {
+		t.Fatal(err)
+	}
+
+	var strictTrx Transactions
+	if err := FromJsonStrict([]byte(input), &strictTrx); err == nil {
+		t.Fatal("Expected failure from misspelled field but instead it worked")
+	}
+}
+
+func TestIncorrectAmountTransactions_Json(t *testing.T) {
+	inputs := map[string]string{
+		"fractional": `[{"amount": 100.505, "label": "?", "sender": "?", "receiver": "?"}]`,
+		"overflow":   `[{"amount": 9223372036854775808, "label": "?", "sender": "?", "receiver": "?"}]`,
+		"details":    `[{"amount": -100, "details": [{"label": "?", "amount": 99.999}]}]`,
+		"exponent":   `[{"amount": -3e400, "label": "?", "sender": "?", "receiver": "?"}]`,
+		"string":     `[{"amount": "-30.0.0", "label": "?", "sender": "?", "receiver": "?"}]`,
+		"precision":  `[{"amount": 1000.5, "currency": "JPY", "label": "?", "sender": "?", "receiver": "?"}]`,
+	}
+
+	for name, input := range inputs {
+		var trx Transactions
+		if err := FromJson([]byte(input), &trx); err == nil {
+			t.Fatalf("Expected failure from %s amount but instead it worked", name)
+		} else if !strings.HasPrefix(err.Error(), "amount ") {
+			t.Fatalf("Expected descriptive error for %s amount but got %v", name, err)
+		}
+	}
+}
+
+func TestDecimalAmountTransactions_Json(t *testing.T) {
+	inputs := map[string]string{
+		"minor units":    `[{"amount": -3000, "details": [{"label": "?", "amount": 1000}, {"label": "?", "amount": 2000}]}]`,
+		"decimal string": `[{"amount": "-30.00", "details": [{"label": "?", "amount": "10"}, {"label": "?", "amount": "20.00"}]}]`,
+		"currency scale": `[{"details": [{"label": "?", "amount": "1000"}, {"label": "?", "amount": "2000"}], "amount": "-3000", "currency": "JPY"}]`,
+		"decimal number": `[{"amount": -30.00, "details": [{"label": "?", "amount": 10.0}, {"label": "?", "amount": 2e1}]}]`,
+	}
+
+	for name, input := range inputs {
+		var trxs Transactions
+		if err := FromJsonStrict([]byte(input), &trxs); err != nil {
+			t.Fatalf("Expected %s amounts to be accepted but got %v", name, err)
+		} else if trxs[0].Amount != -3000 {
+			t.Fatalf("Expected %s amount to be -3000 minor units but got %d", name, trxs[0].Amount)
+		} else if trxs[0].Details[0].Amount != 1000 || trxs[0].Details[1].Amount != 2000 {
+			t.Fatalf("Expected %s details amounts in minor units but got %v", name, trxs[0].Details)
+		}
+
+		// amounts are always written back as minor units
+		if out, err := ToJson(&trxs); err != nil {
+			t.Fatal(err)
+		} else if !strings.Contains(string(out), `"amount":-3000`) {
+			t.Fatalf("Expected %s amount to be written as minor units but got %s", name, out)
+		}
+	}
+}
+
+func TestFractionalAmountTransactions_Json(t *testing.T) {
+	for input, expected := range map[string]int64{
+		`[{"amount": -30.00}]`:                    -3000,
+		`[{"amount": -30.5}]`:                     -3050,
+		`[{"amount": -3.05e1}]`:                   -3050,
+		`[{"amount": -30}]`:                       -30,
+		`[{"amount": 1.5e3, "currency": "JPY"}]`:  1500,
+		`[{"amount": 30.125, "currency": "KWD"}]`: 30125,
+	} {
+		var trxs Transactions
+		if err := FromJson([]byte(input), &trxs); err != nil {
+			t.Fatalf("Expected %s to be accepted but got %v", input, err)
+		} else if trxs[0].Amount != expected {
+			t.Fatalf("Expected %s to be %d minor units but got %d", input, expected, trxs[0].Amount)
+		}
+	}
+}
+
+func TestFlexibleTransactions_Json(t *testing.T) {
+	object := `{
+		"date": "2021-04-24T00:00:00Z",
+		"amount": -100,
+		"label": "?",
+		"sender": "?",
+		"receiver": "?"
+	}`
+
+	var trx Transactions
+	if err := FromJson([]byte(object), &trx); err == nil {
+		t.Fatal("Expected failure from single object on strict array path but instead it worked")
+	}
+
+	if err := FromJsonFlexible([]byte(object), &trx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trx) != 1 || trx[0].Amount != -100 {
+		t.Fatalf("Expected exactly one transaction from single object but got %v", trx)
+	}
+
+	array := "[" + object + "," + object + "]"
+
+	var trxs Transactions
+	if err := FromJsonFlexible([]byte(array), &trxs); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trxs) != 2 {
+		t.Fatalf("Expected two transactions from array but got %d instead", len(trxs))
+	}
+}
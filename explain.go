@@ -0,0 +1,130 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ExplainPull returns the query plan of the main query a registry would run
+// when pulled within the given context (preloads are not explained). The
+// query is captured from a dry run of Pull, so nothing is actually read,
+// and then explained by the database it would be read from (i.e. the
+// replica, if any)
+func ExplainPull(reg Registry, ctx PullContext) (string, error) {
+	db := ctx.reader()
+	capture := &queryCapture{Interface: db.Logger}
+
+	dry := ctx
+	dry.Observer = nil
+	dry.Storage, dry.ReadStorage = db.Session(&gorm.Session{DryRun: true, Logger: capture}), nil
+	if err := reg.Pull(dry); err != nil {
+		return "", err
+	}
+
+	if len(capture.sqls) == 0 {
+		return "", fmt.Errorf("no query to explain for %T", reg)
+	}
+
+	explain := "EXPLAIN "
+	if db.Dialector.Name() == "sqlite" {
+		explain = "EXPLAIN QUERY PLAN "
+	}
+
+	rows, err := db.Raw(explain + capture.sqls[0]).Rows()
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	return planOf(rows)
+}
+
+// PushSQL returns the SQL statements a registry would run when pushed within
+// the given context, one per line, without executing them. This is useful to
+// check the generated conflict clauses. Note the GORM hooks still run, so the
+// records of the collection get their UUIDs as if they were pushed
+func PushSQL(reg Registry, ctx PushContext) (string, error) {
+	capture := &queryCapture{Interface: ctx.Storage.Logger}
+
+	dry := ctx
+	dry.Observer = nil
+	dry.Storage = ctx.Storage.Session(&gorm.Session{DryRun: true, Logger: capture})
+	if err := reg.Push(dry); err != nil {
+		return "", err
+	}
+
+	return strings.Join(capture.sqls, ";\n"), nil
+}
+
+// planOf formats the rows of an EXPLAIN as tab separated lines of text
+func planOf(rows *sql.Rows) (string, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+
+	var plan strings.Builder
+	values := make([]sql.NullString, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return "", err
+		}
+
+		fields := make([]string, len(values))
+		for i, v := range values {
+			fields[i] = v.String
+		}
+		plan.WriteString(strings.Join(fields, "\t"))
+		plan.WriteByte('\n')
+	}
+
+	return plan.String(), rows.Err()
+}
+
+// queryCapture is a GORM logger keeping the traced SQL statements (with
+// their variables interpolated) in the order they were built
+type queryCapture struct {
+	logger.Interface
+	sqls []string
+}
+
+// LogMode keeps the capture in place regardless of the log level
+func (c *queryCapture) LogMode(logger.LogLevel) logger.Interface {
+	return c
+}
+
+// Trace records the statement instead of logging it
+func (c *queryCapture) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	c.sqls = append(c.sqls, sql)
+}
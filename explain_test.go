@@ -0,0 +1,123 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func testExplainPull(t *testing.T, db *gorm.DB) {
+	from, _ := time.Parse("2006-01-02", "2021-01-01")
+	plan, err := ExplainPull(&Transactions{}, PullContext{Storage: db, Limit: 10, From: from})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(plan) == "" {
+		t.Fatal("Expected a query plan for pulling transactions")
+	}
+
+	plan, err = ExplainPull(&Transactions{}, PullContext{Storage: db, ReadStorage: db, Limit: 10, From: from})
+	if err != nil {
+		t.Fatal(err)
+	} else if strings.TrimSpace(plan) == "" {
+		t.Fatal("Expected a query plan for pulling transactions from the replica")
+	}
+}
+
+func testPushSQL(t *testing.T, db *gorm.DB) {
+	actors := Actors{NewActor("Alexandru"), NewActor("Magazin")}
+
+	upsert, err := PushSQL(&actors, PushContext{Storage: db, BatchSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appends, err := PushSQL(&actors, PushContext{Storage: db, BatchSize: 10, JustAppend: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Dialector.Name() == "mysql" {
+		if !strings.Contains(upsert, "ON DUPLICATE KEY UPDATE") || !strings.Contains(appends, "ON DUPLICATE KEY UPDATE") {
+			t.Fatalf("Expected ON DUPLICATE KEY clauses, got %q and %q", upsert, appends)
+		}
+	} else {
+		if !strings.Contains(upsert, "ON CONFLICT") || !strings.Contains(upsert, "DO UPDATE") {
+			t.Fatalf("Expected ON CONFLICT DO UPDATE clause, got %q", upsert)
+		}
+		if !strings.Contains(appends, "ON CONFLICT DO NOTHING") {
+			t.Fatalf("Expected ON CONFLICT DO NOTHING clause, got %q", appends)
+		}
+	}
+
+	var count int64
+	if err := db.Model(&Actor{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	} else if count != 0 {
+		t.Fatalf("Expected nothing pushed on dry run, got %d actors", count)
+	}
+}
+
+func TestExplainPull_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testExplainPull(t, db)
+}
+
+func TestPushSQL_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testPushSQL(t, db)
+}
+
+func TestExplainPull_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testExplainPull(t, db)
+}
+
+func TestPushSQL_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testPushSQL(t, db)
+}
+
+func TestExplainPull_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testExplainPull(t, db)
+}
+
+func TestPushSQL_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testPushSQL(t, db)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// HeadersSeparator separates the key=value pairs of headers, e.g.
+// "image=/path/to/img;source=bank"
+const HeadersSeparator = ";"
+
+// ParseHeaders parses the headers of any entity into key=value pairs. An
+// empty string has no headers, while a pair without "=" or with an empty
+// key is malformed
+func ParseHeaders(headers string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	if strings.TrimSpace(headers) == "" {
+		return pairs, nil
+	}
+
+	for _, pair := range strings.Split(headers, HeadersSeparator) {
+		key, value, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return nil, fmt.Errorf("%w: %q", ErrMalformedHeader, pair)
+		}
+		pairs[key] = strings.TrimSpace(value)
+	}
+
+	return pairs, nil
+}
+
+// validateHeaders checks the headers of a transaction and its details
+func (t *Transaction) validateHeaders() error {
+	if _, err := ParseHeaders(t.Headers); err != nil {
+		return fmt.Errorf("transaction %w", err)
+	}
+
+	for _, d := range t.Details {
+		if _, err := ParseHeaders(d.Headers); err != nil {
+			return fmt.Errorf("transaction details %w", err)
+		}
+	}
+
+	return nil
+}
+
+// normalizeHeaders leaves out the spaces around the keys, the values and
+// the separators of headers (e.g. "a=1 ; b = 2" becomes "a=1;b=2"), while
+// the spaces within keys or values are kept as they are
+func normalizeHeaders(headers string) string {
+	if strings.TrimSpace(headers) == "" {
+		return ""
+	}
+
+	pairs := strings.Split(headers, HeadersSeparator)
+	for i, pair := range pairs {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			pairs[i] = strings.TrimSpace(key) + "=" + strings.TrimSpace(value)
+		} else {
+			pairs[i] = strings.TrimSpace(pair)
+		}
+	}
+
+	return strings.Join(pairs, HeadersSeparator)
+}
+
+// headered narrows down transactions to the ones having the header key
+// (see HasHeaderKey), either as the first pair of headers or after a
+// separator. Headers of transactions are normalized when they're written
+// (see normalizeHeaders), so spaces around keys don't matter. Any wildcard
+// of LIKE in the key is matched literally
+func (ctx PullContext) headered(q *gorm.DB) *gorm.DB {
+	if ctx.HasHeaderKey == "" {
+		return q
+	}
+
+	key := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(strings.TrimSpace(ctx.HasHeaderKey)) + "=%"
+
+	return q.Where("(headers LIKE ? ESCAPE '!' OR headers LIKE ? ESCAPE '!')", key, "%"+HeadersSeparator+key)
+}
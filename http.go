@@ -0,0 +1,186 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// HTTPBatchSize is the batch size used to push records received over HTTP
+var HTTPBatchSize = 100
+
+// HTTPMaxBodySize is the most bytes of a body received over HTTP, beyond
+// which the request is rejected as too large. Zero means no limit
+var HTTPMaxBodySize int64 = 10 << 20
+
+// HTTPMaxDetails is the most details a transaction received over HTTP may
+// have (see PushContext.MaxDetails). Zero means no limit
+var HTTPMaxDetails = 1000
+
+// ActorsHandler exposes the actors registry over HTTP (see registryHandler)
+func ActorsHandler(db *gorm.DB) http.Handler {
+	return &registryHandler{storage: db, registry: func() Registry { return &Actors{} }}
+}
+
+// LabelsHandler exposes the labels registry over HTTP (see registryHandler)
+func LabelsHandler(db *gorm.DB) http.Handler {
+	return &registryHandler{storage: db, registry: func() Registry { return &Labels{} }}
+}
+
+// TransactionsHandler exposes the transactions registry over HTTP (see
+// registryHandler)
+func TransactionsHandler(db *gorm.DB) http.Handler {
+	return &registryHandler{storage: db, registry: func() Registry { return &Transactions{} }}
+}
+
+// registryHandler is a thin REST façade on top of a registry collection
+// where GET pulls records and POST pushes records from a JSON body, both
+// responding with the JSON of the records. The pull is driven by the query
+// parameters limit, offset, from and to (dates written as 2006-01-02), while
+// the push is limited by HTTPMaxBodySize and HTTPMaxDetails
+type registryHandler struct {
+	storage  *gorm.DB
+	registry func() Registry
+}
+
+// ServeHTTP maps the request's method to the registry's Pull or Push
+func (h *registryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ctx, err := pullContextOf(h.storage, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if out, err := NewPullRequest(h.registry(), ctx); err != nil {
+			writeError(w, statusOf(err), err)
+		} else {
+			writeJson(w, http.StatusOK, out)
+		}
+	case http.MethodPost:
+		if HTTPMaxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, HTTPMaxBodySize)
+		}
+
+		body, err := io.ReadAll(r.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		} else if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		reg := h.registry()
+		if err := FromJsonFlexible(body, reg); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if out, err := NewPushRequest(reg, PushContext{Storage: h.storage, BatchSize: HTTPBatchSize, MaxDetails: HTTPMaxDetails}); err != nil {
+			writeError(w, statusOf(err), err)
+		} else {
+			writeJson(w, http.StatusCreated, out)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
+
+// pullContextOf reads the pull context from the request's query parameters
+func pullContextOf(db *gorm.DB, r *http.Request) (ctx PullContext, err error) {
+	ctx.Storage = db
+
+	query := r.URL.Query()
+	if v := query.Get("limit"); v != "" {
+		if ctx.Limit, err = strconv.Atoi(v); err != nil {
+			return
+		}
+	}
+
+	if v := query.Get("offset"); v != "" {
+		if ctx.Offset, err = strconv.Atoi(v); err != nil {
+			return
+		}
+	}
+
+	if v := query.Get("from"); v != "" {
+		if ctx.From, err = time.Parse("2006-01-02", v); err != nil {
+			return
+		}
+	}
+
+	if v := query.Get("to"); v != "" {
+		if ctx.To, err = time.Parse("2006-01-02", v); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// statusOf maps the package's errors to HTTP status codes. Records that
+// cannot be pushed because of their content are unprocessable, while any
+// other failure is on the server's side
+func statusOf(err error) int {
+	var invalid ValidationErrors
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrStaleVersion), errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.As(err, &invalid),
+		errors.Is(err, ErrEmptyName),
+		errors.Is(err, ErrDetailsMismatch),
+		errors.Is(err, ErrNegativeDetail),
+		errors.Is(err, ErrLabelCycle),
+		errors.Is(err, ErrUnknownLabel),
+		errors.Is(err, ErrUnknownActor),
+		errors.Is(err, ErrInvalidStatus),
+		errors.Is(err, ErrInvalidAmount),
+		errors.Is(err, ErrAmountOverflow),
+		errors.Is(err, ErrTooManyDetails):
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusInternalServerError
+}
+
+// writeJson writes an already serialized JSON response
+func writeJson(w http.ResponseWriter, status int, out []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// writeError writes the error as a JSON response, e.g. {"error": "..."}
+func writeError(w http.ResponseWriter, status int, err error) {
+	out, _ := ToJson(map[string]string{"error": err.Error()})
+	writeJson(w, status, out)
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func testTransactionsHandler(t *testing.T, db *gorm.DB) {
+	srv := httptest.NewServer(TransactionsHandler(db))
+	defer srv.Close()
+
+	payload := `[
+		{
+			"date": "2021-04-24T00:00:00Z",
+			"amount": -3000,
+			"label": "Alimente",
+			"sender": "Alexandru",
+			"receiver": "Magazin"
+		},
+		{
+			"date": "2021-05-24T00:00:00Z",
+			"amount": -1500,
+			"label": "Alimente",
+			"sender": "Alexandru",
+			"receiver": "Piață"
+		}
+	]`
+
+	res, err := http.Post(srv.URL, "application/json", strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	} else if res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected POST to respond with %d but got %d instead", http.StatusCreated, res.StatusCode)
+	}
+
+	var pushed Transactions
+	if err := DecodeJSON(res.Body, &pushed); err != nil {
+		t.Fatal(err)
+	} else if len(pushed) != 2 || pushed[0].UUID == nil {
+		t.Fatalf("Expected POST to respond with the pushed transactions but got %v", pushed)
+	}
+	res.Body.Close()
+
+	res, err = http.Get(srv.URL + "?limit=10&from=2021-05-01")
+	if err != nil {
+		t.Fatal(err)
+	} else if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected GET to respond with %d but got %d instead", http.StatusOK, res.StatusCode)
+	}
+
+	var pulled Transactions
+	if err := DecodeJSON(res.Body, &pulled); err != nil {
+		t.Fatal(err)
+	} else if len(pulled) != 1 || pulled[0].ReceiverName != "Piață" {
+		t.Fatalf("Expected GET to respond with the transactions since May but got %v", pulled)
+	}
+	res.Body.Close()
+
+	failures := map[string]int{
+		"GET ?limit=ten":      http.StatusBadRequest,
+		"GET ?from=yesterday": http.StatusBadRequest,
+		"POST [{":             http.StatusBadRequest,
+		"POST [{\"amount\": -100, \"details\": [{\"label\": \"?\", \"amount\": 50}]}]": http.StatusUnprocessableEntity,
+		"DELETE ": http.StatusMethodNotAllowed,
+	}
+
+	for request, status := range failures {
+		method, rest, _ := strings.Cut(request, " ")
+
+		var req *http.Request
+		if method == http.MethodPost {
+			req, _ = http.NewRequest(method, srv.URL, strings.NewReader(rest))
+		} else {
+			req, _ = http.NewRequest(method, srv.URL+rest, nil)
+		}
+
+		if res, err := http.DefaultClient.Do(req); err != nil {
+			t.Fatal(err)
+		} else if res.Body.Close(); res.StatusCode != status {
+			t.Fatalf("Expected %s to respond with %d but got %d instead", request, status, res.StatusCode)
+		}
+	}
+
+	defer func(max int64) { HTTPMaxBodySize = max }(HTTPMaxBodySize)
+	HTTPMaxBodySize = int64(len(payload))
+
+	large := payload + strings.Repeat(" ", 10)
+	if res, err := http.Post(srv.URL, "application/json", strings.NewReader(large)); err != nil {
+		t.Fatal(err)
+	} else if res.Body.Close(); res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected a large body to respond with %d but got %d instead", http.StatusRequestEntityTooLarge, res.StatusCode)
+	}
+
+	defer func(max int) { HTTPMaxDetails = max }(HTTPMaxDetails)
+	HTTPMaxDetails = 1
+
+	crowded := `[{"amount": -100, "details": [{"label": "Pâine", "amount": 50}, {"label": "Apă", "amount": 50}]}]`
+	if res, err := http.Post(srv.URL, "application/json", strings.NewReader(crowded)); err != nil {
+		t.Fatal(err)
+	} else if body, _ := io.ReadAll(res.Body); res.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected too many details to respond with %d but got %d instead", http.StatusUnprocessableEntity, res.StatusCode)
+	} else if res.Body.Close(); !strings.Contains(string(body), ErrTooManyDetails.Error()) {
+		t.Fatalf("Expected too many details to be reported but got %s", body)
+	}
+}
+
+func TestTransactionsHandler_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testTransactionsHandler(t, db)
+}
+
+func TestTransactionsHandler_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testTransactionsHandler(t, db)
+}
+
+func TestTransactionsHandler_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testTransactionsHandler(t, db)
+}
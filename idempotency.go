@@ -0,0 +1,115 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PushLog is the record of a successful push with an idempotency key (see
+// PushContext.IdempotencyKey), which is kept to skip repeated pushes. The
+// same key can be used by a push of each entity (e.g. PreloadReferences),
+// while the result of the push is kept to be returned again on repeat
+type PushLog struct {
+	Key       string         `json:"key" gorm:"column:idempotency_key; type: varchar(255); primaryKey"`
+	Entity    string         `json:"entity" gorm:"type: varchar(20); primaryKey"`
+	Result    datatypes.JSON `json:"result,omitempty"`
+	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// once runs a push within a database transaction along with the record of
+// its idempotency key, unless the key is already in the push log. Since the
+// record is written first, concurrent pushes with the same key wait for one
+// another and a failed push doesn't keep its key. Once pushed, the result
+// (if any) is kept in the log, while a repeated push reads it back instead
+func (ctx PushContext) once(entity string, result interface{}, push func(PushContext) error) error {
+	return ctx.Storage.Transaction(func(tx *gorm.DB) error {
+		log := PushLog{Key: ctx.IdempotencyKey, Entity: entity}
+		key := tx.Where("idempotency_key = ? AND entity = ?", log.Key, log.Entity)
+
+		q := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&log)
+		if q.Error != nil {
+			return q.Error
+		} else if q.RowsAffected == 0 {
+			if result == nil {
+				return nil // already pushed
+			} else if err := key.First(&log).Error; err != nil || len(log.Result) == 0 {
+				return err
+			}
+
+			return json.Unmarshal(log.Result, result)
+		}
+
+		subctx := ctx
+		subctx.Storage = tx
+		subctx.IdempotencyKey = ""
+
+		if err := push(subctx); err != nil || result == nil {
+			return err
+		}
+
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		return key.Model(&PushLog{}).Update("result", datatypes.JSON(raw)).Error
+	})
+}
+
+// pushedKey is the key and version a transaction was pushed with, which is
+// kept in the push log so a repeated push gets them as well
+type pushedKey struct {
+	UUID    *string `json:"uuid"`
+	Version uint    `json:"version"`
+}
+
+// keys returns the key and version of each transaction, by position
+func (t *Transactions) keys() []pushedKey {
+	keys := make([]pushedKey, 0, len(*t))
+	for _, trx := range *t {
+		keys = append(keys, pushedKey{UUID: trx.UUID, Version: trx.Version})
+	}
+
+	return keys
+}
+
+// replay gives the transactions of a repeated push the keys and versions
+// they were first pushed with, and it reports the same result again (the
+// ones skipped are found once more, as validation doesn't need the registry)
+func (t *Transactions) replay(ctx PushContext, keys []pushedKey) (result PushResult) {
+	for i := range *t {
+		if i < len(keys) && keys[i].UUID != nil {
+			(*t)[i].UUID, (*t)[i].Version = keys[i].UUID, keys[i].Version
+		}
+	}
+
+	if ctx.SkipInvalid {
+		_, _, result.Skipped = t.partition(ctx)
+	}
+	result.Pushed = len(*t) - len(result.Skipped)
+
+	return result
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testIdempotencyKey(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	batch := func() *Transactions {
+		ls := map[Label]int64{NewLabel("Pâine", nil): 3000}
+		return &Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "")}
+	}
+
+	var uuids []string
+	for i := 0; i < 2; i++ {
+		observer := &fakeObserver{}
+		ctx := PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true, IdempotencyKey: "batch-1", Observer: observer}
+		trxs := batch()
+		if result, err := trxs.PushWithResult(ctx); err != nil {
+			t.Fatal(err)
+		} else if result.Pushed != 1 {
+			t.Fatalf("Expected the same result on each push, got %+v", result)
+		}
+
+		if i == 1 && len(observer.pushes) > 0 {
+			t.Fatalf("Expected repeated batch to be skipped, got pushes %v", observer.pushes)
+		}
+
+		if (*trxs)[0].UUID == nil {
+			t.Fatalf("Expected push #%d to give the transaction its key", i)
+		}
+		uuids = append(uuids, *(*trxs)[0].UUID)
+	}
+
+	if uuids[0] != uuids[1] {
+		t.Fatalf("Expected repeated batch to get the prior key %s, got %s", uuids[0], uuids[1])
+	}
+
+	var got Transactions
+	if err := got.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 1 {
+		t.Fatalf("Expected one transaction after pushing the same batch twice, got %v", got)
+	}
+
+	// another key is another batch
+	if err := batch().Push(PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true, IdempotencyKey: "batch-2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs []PushLog
+	if err := db.Order("idempotency_key").Find(&logs).Error; err != nil {
+		t.Fatal(err)
+	} else if keys := fmt.Sprintf("%d %s %s %s", len(logs), logs[0].Key, logs[1].Key, logs[0].Entity); keys != "2 batch-1 batch-2 transactions" {
+		t.Fatalf("Expected both keys in the push log, got %v", logs)
+	}
+}
+
+func testIdempotencyKeyEntities(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trxs := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+
+	// actors and labels are pushed with the same key, one after another
+	if err := PreloadReferences(PushContext{Storage: db, BatchSize: 10, IdempotencyKey: "import-1"}, trxs); err != nil {
+		t.Fatal(err)
+	}
+
+	var labels Labels
+	if err := labels.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(labels) != 1 {
+		t.Fatalf("Expected the label to be pushed with the same key as actors, got %v", labels)
+	}
+}
+
+func testIdempotencyKeySkipInvalid(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	mismatch := map[Label]int64{NewLabel("Pâine", nil): 100}
+	ctx := PushContext{Storage: db, BatchSize: 10, SkipInvalid: true, IdempotencyKey: "batch-1"}
+
+	// skipped transactions don't fail the push, so neither the valid ones
+	// nor the key are rolled back, and a repeated push reports them again
+	for i := 0; i < 2; i++ {
+		trxs := Transactions{
+			NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""),
+			NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), mismatch, ""),
+		}
+		if result, err := trxs.PushWithResult(ctx); err != nil {
+			t.Fatal(err)
+		} else if result.Pushed != 1 || len(result.Skipped) != 1 {
+			t.Fatalf("Expected push #%d to report one pushed and one skipped, got %+v", i, result)
+		}
+	}
+
+	var got Transactions
+	if err := got.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 1 {
+		t.Fatalf("Expected the valid transaction to be written once, got %v", got)
+	}
+
+	var logs []PushLog
+	if err := db.Find(&logs).Error; err != nil {
+		t.Fatal(err)
+	} else if len(logs) != 1 {
+		t.Fatalf("Expected the key in the push log, got %v", logs)
+	}
+}
+
+func testIdempotencyKeyFailure(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	ctx := PushContext{Storage: db, BatchSize: 10, IdempotencyKey: "batch-1"}
+
+	bad := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"),
+		map[Label]int64{NewLabel("Pâine", nil): 1000}, "")}
+	if err := bad.Push(ctx); err == nil {
+		t.Fatal("Expected push with mismatched details to fail")
+	}
+
+	good := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")}
+	if err := good.Push(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Transactions
+	if err := got.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 1 {
+		t.Fatalf("Expected failed push not to keep its key, got %v", got)
+	}
+}
+
+func TestIdempotencyKey_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testIdempotencyKey(t, db)
+}
+
+func TestIdempotencyKeyFailure_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testIdempotencyKeyFailure(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestIdempotencyKeyEntities_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testIdempotencyKeyEntities(t, db)
+}
+
+func TestIdempotencyKeySkipInvalid_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testIdempotencyKeySkipInvalid(t, db)
+}
+
+func TestIdempotencyKey_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testIdempotencyKey(t, db)
+}
+
+func TestIdempotencyKeyFailure_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testIdempotencyKeyFailure(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestIdempotencyKeyEntities_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testIdempotencyKeyEntities(t, db)
+}
+
+func TestIdempotencyKeySkipInvalid_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testIdempotencyKeySkipInvalid(t, db)
+}
+
+func TestIdempotencyKey_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testIdempotencyKey(t, db)
+}
+
+func TestIdempotencyKeyFailure_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testIdempotencyKeyFailure(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestIdempotencyKeyEntities_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testIdempotencyKeyEntities(t, db)
+}
+
+func TestIdempotencyKeySkipInvalid_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testIdempotencyKeySkipInvalid(t, db)
+}
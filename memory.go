@@ -0,0 +1,378 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryRegistry is an in-memory registry of any of the registry key
+// components, meant to test code which depends on Registry without any
+// database. Items is the collection pushed and pulled (just like Actors,
+// Labels and Transactions are), while the records are kept by their primary
+// key with the same upsert and validation rules. The persistence layer of
+// contexts is ignored, as is any filter other than Limit, Offset, From and To
+//
+//	reg := NewMemoryRegistry[Actor]()
+//	reg.Items = []Actor{NewActor("Alexandru")}
+//	err := reg.Push(PushContext{})
+type MemoryRegistry[T Entity] struct {
+	Items []T
+
+	mu      sync.Mutex
+	records map[string]T
+}
+
+// NewMemoryRegistry is an idiomatic constructor for the MemoryRegistry of
+// any of the registry key components
+func NewMemoryRegistry[T Entity]() *MemoryRegistry[T] {
+	return &MemoryRegistry[T]{records: make(map[string]T)}
+}
+
+// Push writes the items into memory or updates the existing ones on
+// conflict (see ConflictMode), after the same checks a push into registry
+// does. Transactions without an UUID get one, just like on push
+func (m *MemoryRegistry[T]) Push(ctx PushContext) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := registryOf(&m.Items).(interface{ Validate() error }).Validate(); err != nil {
+		return err
+	}
+
+	var records []T
+	switch items := any(m.Items).(type) {
+	case []Label:
+		records = any(memoryLabels(items)).([]T)
+	case []Transaction:
+		for i := range items {
+			if err := memoryTransaction(&items[i]); err != nil {
+				return err
+			}
+		}
+		records = m.Items
+	default:
+		records = m.Items
+	}
+
+	// conflicts are checked upfront, so a failed push changes nothing
+	mode := ctx.conflictMode()
+	for _, item := range records {
+		old, ok := m.records[memoryKey(item)]
+		if !ok {
+			continue
+		} else if mode == ConflictError {
+			return fmt.Errorf("%s %s: %w", memoryEntity(item), memoryKey(item), ErrConflict)
+		} else if mode == ConflictDoNothing {
+			continue
+		}
+
+		if trx, ok := any(item).(Transaction); ok && any(old).(Transaction).Version != trx.Version {
+			return fmt.Errorf("transaction %s %w, expected version %d but got %d",
+				*trx.UUID, ErrStaleVersion, any(old).(Transaction).Version, trx.Version)
+		}
+	}
+
+	now := time.Now()
+	for i, record := range records {
+		key := memoryKey(record)
+		old, ok := m.records[key]
+		switch {
+		case !ok:
+			m.records[key] = memoryCreate(record, now)
+		case mode == ConflictDoNothing, mode == ConflictError:
+			continue
+		case mode == ConflictUpdateIfNewer && !memoryNewer(old, record):
+			continue
+		default:
+			m.records[key] = memoryUpdate(old, record, now)
+			if trxs, ok := any(m.Items).([]Transaction); ok {
+				trxs[i].Version++
+			}
+		}
+	}
+
+	return nil
+}
+
+// Pull reads the items from memory, in the same order a pull from registry
+// would (i.e. actors and labels by name, transactions by date)
+func (m *MemoryRegistry[T]) Pull(ctx PullContext) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := make([]T, 0, len(m.records))
+	for _, record := range m.records {
+		if trx, ok := any(record).(Transaction); ok {
+			if (!ctx.From.IsZero() && trx.Date.Before(ctx.From)) || (!ctx.To.IsZero() && trx.Date.After(ctx.To)) {
+				continue
+			}
+		}
+		items = append(items, memoryCopy(record, m.records))
+	}
+
+	sort.Slice(items, func(i, j int) bool { return memoryLess(items[i], items[j]) })
+
+	if ctx.Offset > 0 {
+		items = items[min(ctx.Offset, len(items)):]
+	}
+	if ctx.Limit > 0 {
+		items = items[:min(ctx.Limit, len(items))]
+	}
+	m.Items = items
+
+	return nil
+}
+
+// memoryLabels returns the labels with their parents before them, linked
+// by name instead of pointers (just like they're stored)
+func memoryLabels(items []Label) []Label {
+	var list []Label
+	seen := make(map[string]bool, len(items))
+	var add func(lb Label)
+	add = func(lb Label) {
+		if seen[lb.Name] {
+			return
+		}
+		seen[lb.Name] = true
+
+		if lb.Parent != nil {
+			add(*lb.Parent)
+			lb.ParentName = NullString{sql.NullString{String: lb.Parent.Name, Valid: true}}
+			lb.Parent = nil
+		}
+		list = append(list, lb)
+	}
+	for _, lb := range items {
+		add(lb)
+	}
+
+	return list
+}
+
+// memoryTransaction prepares a transaction to be stored the same way it's
+// done before being created in registry (see BeforeCreate), with its
+// associations linked by name instead of pointers
+func memoryTransaction(trx *Transaction) error {
+	if trx.UUID == nil || *trx.UUID == "" {
+		pk := UUIDFunc()
+		trx.UUID = &pk
+	}
+
+	if trx.Status == "" {
+		trx.Status = StatusPending
+	} else if !trx.Status.valid() {
+		return fmt.Errorf("transaction %w: %q", ErrInvalidStatus, trx.Status)
+	}
+	trx.Headers = normalizeHeaders(trx.Headers)
+
+	trx.LabelName = labelName(trx.LabelName, trx.Label)
+	trx.SenderName = actorName(trx.SenderName, trx.Sender)
+	trx.ReceiverName = actorName(trx.ReceiverName, trx.Receiver)
+
+	for _, d := range trx.Details {
+		if d.UUID == nil || *d.UUID == "" {
+			pk := UUIDFunc()
+			d.UUID = &pk
+		}
+		d.TransactionUUID = *trx.UUID
+		d.LabelName = d.labelName()
+	}
+
+	return nil
+}
+
+// memoryKey returns the primary key of a record
+func memoryKey(record any) string {
+	switch r := record.(type) {
+	case Actor:
+		return r.Name
+	case Label:
+		return r.Name
+	case Transaction:
+		return *r.UUID
+	}
+
+	panic("unsupported registry entity")
+}
+
+// memoryEntity returns the name of the entity of a record
+func memoryEntity(record any) string {
+	switch record.(type) {
+	case Actor:
+		return "actor"
+	case Label:
+		return "label"
+	}
+
+	return "transaction"
+}
+
+// memoryNewer checks whether the pushed record was updated after the stored
+// one, where records without a time of update are updated just now
+func memoryNewer(old, record any) bool {
+	var before, after time.Time
+	switch r := record.(type) {
+	case Actor:
+		before, after = old.(Actor).UpdatedAt, r.UpdatedAt
+	case Label:
+		before, after = old.(Label).UpdatedAt, r.UpdatedAt
+	case Transaction:
+		before, after = old.(Transaction).UpdatedAt, r.UpdatedAt
+	}
+
+	return after.IsZero() || before.Before(after)
+}
+
+// memoryCreate stamps a new record with the time of its creation
+func memoryCreate[T Entity](record T, now time.Time) T {
+	stamp := func(created, updated *time.Time) {
+		if created.IsZero() {
+			*created = now
+		}
+		if updated.IsZero() {
+			*updated = now
+		}
+	}
+
+	switch r := any(&record).(type) {
+	case *Actor:
+		stamp(&r.CreatedAt, &r.UpdatedAt)
+	case *Label:
+		stamp(&r.CreatedAt, &r.UpdatedAt)
+	case *Transaction:
+		stamp(&r.CreatedAt, &r.UpdatedAt)
+		r.Label, r.Sender, r.Receiver = nil, nil, nil
+		r.Meta = append(r.Meta[:0:0], r.Meta...)
+		r.Details = memoryDetails(nil, r.Details, now)
+	}
+
+	return record
+}
+
+// memoryUpdate updates the same fields of a stored record a push updates
+// on conflict (see Push on collections)
+func memoryUpdate[T Entity](old, record T, now time.Time) T {
+	updated := func(t time.Time) time.Time {
+		if t.IsZero() {
+			return now
+		}
+		return t
+	}
+
+	switch r := any(&old).(type) {
+	case *Actor:
+		next := any(record).(Actor)
+		r.Flags, r.Headers, r.UpdatedAt = next.Flags, next.Headers, updated(next.UpdatedAt)
+	case *Label:
+		next := any(record).(Label)
+		r.ParentName, r.Flags, r.Headers, r.UpdatedAt = next.ParentName, next.Flags, next.Headers, updated(next.UpdatedAt)
+	case *Transaction:
+		next := any(record).(Transaction)
+		r.LabelName, r.SenderName, r.ReceiverName, r.Currency = next.LabelName, next.SenderName, next.ReceiverName, next.Currency
+		r.Flags, r.Headers, r.Meta, r.UpdatedAt = next.Flags, next.Headers, append(next.Meta[:0:0], next.Meta...), updated(next.UpdatedAt)
+		r.Details = memoryDetails(r.Details, next.Details, now)
+		r.Version++
+	}
+
+	return old
+}
+
+// memoryDetails adds the pushed details to the stored ones, unless they're
+// stored already
+func memoryDetails(stored, pushed []*Details, now time.Time) []*Details {
+	seen := make(map[string]bool, len(stored))
+	details := make([]*Details, 0, len(stored)+len(pushed))
+	for _, d := range stored {
+		seen[*d.UUID] = true
+		details = append(details, d)
+	}
+
+	for _, d := range pushed {
+		if !seen[*d.UUID] {
+			copied := *d
+			copied.Transaction, copied.Label = nil, nil
+			if copied.CreatedAt.IsZero() {
+				copied.CreatedAt, copied.UpdatedAt = now, now
+			}
+			details = append(details, &copied)
+		}
+	}
+
+	return details
+}
+
+// memoryCopy returns a copy of a stored record, so the caller cannot change
+// it in place. Labels have their parent attached, just like on pull
+func memoryCopy[T Entity](record T, records map[string]T) T {
+	switch r := any(&record).(type) {
+	case *Label:
+		if parent, ok := records[r.ParentName.String]; r.ParentName.Valid && ok {
+			lb := any(parent).(Label)
+			r.Parent = &lb
+		}
+	case *Transaction:
+		details := make([]*Details, 0, len(r.Details))
+		for _, d := range r.Details {
+			copied := *d
+			details = append(details, &copied)
+		}
+		r.Details = details
+		r.Meta = append(r.Meta[:0:0], r.Meta...)
+	}
+
+	return record
+}
+
+// memoryLess orders records the same way a pull from registry does
+func memoryLess(a, b any) bool {
+	switch x := a.(type) {
+	case Actor:
+		return x.Name < b.(Actor).Name
+	case Label:
+		return x.Name < b.(Label).Name
+	}
+
+	// the same as transactionsOrder, where a missing time of occurrence
+	// comes last (as it does on SQLite and MySQL)
+	x, y := a.(Transaction), b.(Transaction)
+	if !x.Date.Equal(y.Date) {
+		return x.Date.After(y.Date)
+	}
+
+	switch {
+	case x.OccurredAt == nil && y.OccurredAt != nil:
+		return false
+	case x.OccurredAt != nil && y.OccurredAt == nil:
+		return true
+	case x.OccurredAt != nil && !x.OccurredAt.Equal(*y.OccurredAt):
+		return x.OccurredAt.After(*y.OccurredAt)
+	}
+
+	if x.Amount != y.Amount {
+		return x.Amount > y.Amount
+	}
+
+	return *x.UUID < *y.UUID
+}
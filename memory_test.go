@@ -0,0 +1,261 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+var (
+	_ Registry = (*MemoryRegistry[Actor])(nil)
+	_ Registry = (*MemoryRegistry[Label])(nil)
+	_ Registry = (*MemoryRegistry[Transaction])(nil)
+)
+
+func TestMemoryActorsAPI(t *testing.T) {
+	reg := NewMemoryRegistry[Actor]()
+
+	reg.Items = []Actor{NewActor("Alexandru")}
+	if err := reg.Push(PushContext{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reg.Pull(PullContext{Limit: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reg.Items) != 1 || reg.Items[0].Name != "Alexandru" {
+		t.Fatal("Pulled actor doesn't match with pushed actor")
+	}
+
+	reg.Items[0].Flags = 29 // push must upsert
+	reg.Items = append(reg.Items,
+		Actor{Name: "XYZ", Flags: 2, Headers: "image=/path/to/img"},
+		Actor{Name: "Hypermarket", Headers: "image=/path/to/img"},
+	)
+
+	if err := reg.Push(PushContext{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reg.Pull(PullContext{Limit: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reg.Items) != 3 {
+		t.Fatalf("Pushed 3 actors and got back %d instead\n", len(reg.Items))
+	} else if reg.Items[0].Name != "Alexandru" || reg.Items[0].Flags != 29 {
+		t.Fatalf("Expected actors by name with the upserted one first, got %v", reg.Items)
+	}
+
+	reg.Items = []Actor{{Name: ""}}
+	if err := reg.Push(PushContext{}); !errors.Is(err, ErrEmptyName) {
+		t.Fatalf("Expected push of an actor without name to fail with ErrEmptyName, got %v", err)
+	}
+}
+
+func TestMemoryLabelsAPI(t *testing.T) {
+	reg := NewMemoryRegistry[Label]()
+
+	reg.Items = []Label{{Name: "Tabletă"}}
+	if err := reg.Push(PushContext{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reg.Pull(PullContext{Limit: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reg.Items) != 1 || reg.Items[0].Name != "Tabletă" {
+		t.Fatal("Pulled label doesn't match with pushed label")
+	}
+
+	reg.Items[0].Parent = &Label{
+		Name:   "Electronice",
+		Parent: &Label{Name: "Bunuri"},
+	}
+	reg.Items = append(reg.Items,
+		Label{Name: "Alimente"},
+		Label{Name: "Pâine", Parent: &Label{Name: "Alimente"}},
+	)
+
+	if err := reg.Push(PushContext{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reg.Pull(PullContext{Limit: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reg.Items) != 5 {
+		t.Fatalf("Pushed 5 labels and got back %d instead\n", len(reg.Items))
+	}
+
+	for _, lb := range reg.Items {
+		if lb.Name == "Tabletă" && (lb.Parent == nil || lb.Parent.Name != "Electronice" || lb.Parent.ParentName.String != "Bunuri") {
+			t.Fatalf("Expected label with its parent attached, got %v", lb)
+		}
+	}
+
+	// parents are checked for conflicts as well, even if not pushed directly
+	reg.Items = []Label{{Name: "Cereale", Parent: &Label{Name: "Alimente"}}}
+	if err := reg.Push(PushContext{OnConflict: ConflictError}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected the existing parent to conflict but got %v", err)
+	}
+}
+
+func TestMemoryTransactionsAPI(t *testing.T) {
+	reg := NewMemoryRegistry[Transaction]()
+
+	date, _ := time.Parse("2006-01-02", "2021-04-22")
+	reg.Items = []Transaction{
+		NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "signature/0"),
+	}
+	if err := reg.Push(PushContext{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reg.Pull(PullContext{Limit: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reg.Items) != 1 || reg.Items[0].UUID == nil || *reg.Items[0].UUID == "" {
+		t.Fatal("Pulled transaction doesn't match with pushed transaction")
+	}
+
+	if reg.Items[0].Signature == "" || reg.Items[0].LabelName != "Alimente" {
+		t.Fatalf("Expected signature and label on first transaction but got %v", reg.Items[0])
+	}
+
+	recentTransactionWithUUID := reg.Items[0] // this should not get duplicated, but updated
+	recentTransactionWithUUID.LabelName = "?"
+	recentTransactionWithUUID.Label = nil
+	recentTransactionWithUUID.Flags = 29
+	recentTransactionWithUUID.Details = []*Details{
+		{LabelName: "Pâine", Amount: 1000},
+		{LabelName: "Prăjitură", Amount: 2000},
+	}
+
+	reg.Items = []Transaction{
+		{
+			Date:         date.AddDate(0, 0, 1),
+			Amount:       5000, // 50.00
+			LabelName:    "Transfer",
+			SenderName:   "?",
+			ReceiverName: "Alexandru",
+		},
+		{
+			Date:         date.AddDate(0, 1, 0),
+			Amount:       -15000, // -150.00
+			LabelName:    "?",
+			SenderName:   "Alexandru Catrina",
+			ReceiverName: "Magazin",
+			Details: []*Details{
+				{LabelName: "Alimente", Amount: 5000},
+				{LabelName: "Hrană pentru animale", Amount: 8000},
+				{LabelName: "Apă", Amount: 2000},
+			},
+		},
+		recentTransactionWithUUID, // 2 inserts and 1 update
+	}
+
+	if err := reg.Push(PushContext{}); err != nil {
+		t.Fatal(err)
+	} else if reg.Items[2].Version != 1 {
+		t.Fatalf("Expected updated transaction to have a new version, got %d", reg.Items[2].Version)
+	}
+
+	if err := reg.Pull(PullContext{Limit: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reg.Items) != 3 {
+		t.Fatalf("Pushed 3 transactions and got back %d instead\n", len(reg.Items))
+	}
+
+	numDetails := 0
+	for _, trx := range reg.Items {
+		numDetails += len(trx.Details)
+
+		if *trx.UUID == *recentTransactionWithUUID.UUID && (trx.Signature == "" || trx.LabelName != "?" || trx.Flags != 29) {
+			t.Fatalf("Expected upsert to update the label and flags but keep the signature, got %v", trx)
+		}
+	}
+
+	if numDetails != 5 {
+		t.Fatalf("Expected 5 details on 2 transactions but instead got %d", numDetails)
+	}
+
+	// the pushed transaction is now stale, since it was updated meanwhile
+	reg.Items = []Transaction{recentTransactionWithUUID}
+	if err := reg.Push(PushContext{}); !errors.Is(err, ErrStaleVersion) {
+		t.Fatalf("Expected push of a stale transaction to fail with ErrStaleVersion, got %v", err)
+	}
+
+	reg.Items = []Transaction{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"),
+		map[Label]int64{NewLabel("Pâine", nil): 1000}, "")}
+	if err := reg.Push(PushContext{}); !errors.Is(err, ErrDetailsMismatch) {
+		t.Fatalf("Expected push of mismatching details to fail with ErrDetailsMismatch, got %v", err)
+	}
+}
+
+func TestMemoryTransactionsOrder(t *testing.T) {
+	reg := NewMemoryRegistry[Transaction]()
+
+	date, _ := time.Parse("2006-01-02", "2021-04-22")
+	occurredAt := date.Add(12 * time.Hour)
+	for i := 0; i < 20; i++ {
+		trx := NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")
+		if i == 10 {
+			trx.OccurredAt = &occurredAt
+		}
+		reg.Items = append(reg.Items, trx)
+	}
+	if err := reg.Push(PushContext{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// ties are broken the same way as the registry does, so every pull agrees
+	var first []string
+	for run := 0; run < 5; run++ {
+		if err := reg.Pull(PullContext{}); err != nil {
+			t.Fatal(err)
+		}
+
+		var uuids []string
+		for _, trx := range reg.Items {
+			uuids = append(uuids, *trx.UUID)
+		}
+
+		if reg.Items[0].OccurredAt == nil {
+			t.Fatalf("Expected the transaction with a time of occurrence first, got %v", reg.Items[0])
+		} else if !sort.StringsAreSorted(uuids[1:]) {
+			t.Fatalf("Expected transactions of the same date and amount ordered by UUID, got %v", uuids)
+		} else if first == nil {
+			first = uuids
+		} else if fmt.Sprint(uuids) != fmt.Sprint(first) {
+			t.Fatalf("Expected the same order on every pull, got %v and %v", first, uuids)
+		}
+	}
+}
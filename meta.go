@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import "encoding/json"
+
+// SetMeta sets a key of the transaction's metadata to any value that can be
+// serialized as JSON (e.g. tags, external IDs or a geolocation), while the
+// other keys are kept as they are
+func (t *Transaction) SetMeta(key string, value interface{}) error {
+	meta := make(map[string]json.RawMessage)
+	if len(t.Meta) > 0 {
+		if err := json.Unmarshal(t.Meta, &meta); err != nil {
+			return err
+		}
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	meta[key] = raw
+
+	if t.Meta, err = json.Marshal(meta); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetMeta reads a key of the transaction's metadata into the given value,
+// which must be a pointer. It reports whether the key is set at all
+func (t *Transaction) GetMeta(key string, into interface{}) (bool, error) {
+	if len(t.Meta) == 0 {
+		return false, nil
+	}
+
+	var meta map[string]json.RawMessage
+	if err := json.Unmarshal(t.Meta, &meta); err != nil {
+		return false, err
+	}
+
+	raw, ok := meta[key]
+	if !ok {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(raw, into)
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"database/sql"
+
+	"github.com/lexndru/expenses/expensespb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ToProto converts the actor into its protobuf message
+func (a *Actor) ToProto() *expensespb.Actor {
+	return &expensespb.Actor{Name: a.Name, Flags: uint32(a.Flags), Headers: a.Headers}
+}
+
+// FromProto overwrites the actor's fields with the ones of the message
+func (a *Actor) FromProto(m *expensespb.Actor) {
+	*a = Actor{Name: m.GetName(), Flags: uint16(m.GetFlags()), Headers: m.GetHeaders()}
+}
+
+// ToProto converts the label into its protobuf message. Just like JSON, a
+// label without parent name has an unset parent
+func (lb *Label) ToProto() *expensespb.Label {
+	m := &expensespb.Label{Name: lb.Name, Flags: uint32(lb.Flags), Headers: lb.Headers}
+	if lb.ParentName.Valid {
+		parent := lb.ParentName.String
+		m.Parent = &parent
+	}
+
+	return m
+}
+
+// FromProto overwrites the label's fields with the ones of the message
+func (lb *Label) FromProto(m *expensespb.Label) {
+	*lb = Label{Name: m.GetName(), Flags: uint16(m.GetFlags()), Headers: m.GetHeaders()}
+	if m.Parent != nil {
+		lb.ParentName = NullString{sql.NullString{String: m.GetParent(), Valid: true}}
+	}
+}
+
+// ToProto converts the transaction and its details into their protobuf
+// messages. Just like JSON, a transaction without UUID has an unset uuid
+func (t *Transaction) ToProto() *expensespb.Transaction {
+	m := &expensespb.Transaction{
+		Uuid:      t.UUID,
+		Date:      timestamppb.New(t.Date),
+		Amount:    t.Amount,
+		Label:     t.LabelName,
+		Sender:    t.SenderName,
+		Receiver:  t.ReceiverName,
+		Signature: t.Signature,
+		Flags:     uint32(t.Flags),
+		Headers:   t.Headers,
+		Meta:      t.Meta,
+		Tags:      t.Tags,
+		Status:    string(t.Status),
+		Currency:  t.Currency,
+		Version:   uint64(t.Version),
+	}
+
+	for _, d := range t.Details {
+		m.Details = append(m.Details, d.ToProto())
+	}
+
+	return m
+}
+
+// FromProto overwrites the transaction's fields and details with the ones
+// of the message
+func (t *Transaction) FromProto(m *expensespb.Transaction) {
+	*t = Transaction{
+		Date:         m.GetDate().AsTime(),
+		Amount:       m.GetAmount(),
+		LabelName:    m.GetLabel(),
+		SenderName:   m.GetSender(),
+		ReceiverName: m.GetReceiver(),
+		Signature:    m.GetSignature(),
+		Flags:        uint16(m.GetFlags()),
+		Headers:      m.GetHeaders(),
+		Meta:         m.GetMeta(),
+		Tags:         m.GetTags(),
+		Status:       Status(m.GetStatus()),
+		Currency:     m.GetCurrency(),
+		Version:      uint(m.GetVersion()),
+	}
+
+	if m.Uuid != nil {
+		pk := m.GetUuid()
+		t.UUID = &pk
+	}
+
+	for _, dm := range m.GetDetails() {
+		d := &Details{}
+		d.FromProto(dm)
+		t.Details = append(t.Details, d)
+	}
+}
+
+// ToProto converts the transaction details into their protobuf message
+func (d *Details) ToProto() *expensespb.Details {
+	return &expensespb.Details{Label: d.LabelName, Amount: d.Amount, Flags: uint32(d.Flags), Headers: d.Headers}
+}
+
+// FromProto overwrites the details' fields with the ones of the message
+func (d *Details) FromProto(m *expensespb.Details) {
+	*d = Details{LabelName: m.GetLabel(), Amount: m.GetAmount(), Flags: uint16(m.GetFlags()), Headers: m.GetHeaders()}
+}
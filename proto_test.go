@@ -0,0 +1,135 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lexndru/expenses/expensespb"
+	"google.golang.org/protobuf/proto"
+)
+
+// roundTrip converts a message into bytes and back, as if it crossed the wire
+func roundTrip(t *testing.T, in, out proto.Message) {
+	b, err := proto.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proto.Unmarshal(b, out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sameJson asserts both entities serialize to the same JSON
+func sameJson(t *testing.T, a, b interface{}) {
+	outA, err := ToJson(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outB, err := ToJson(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(outA, outB) {
+		t.Fatalf("Expected %s but got %s instead", outA, outB)
+	}
+}
+
+func TestActorProto(t *testing.T) {
+	a := Actor{Name: "Alexandru", Flags: 2, Headers: "image=/path/to/img"}
+
+	var m expensespb.Actor
+	roundTrip(t, a.ToProto(), &m)
+
+	var b Actor
+	b.FromProto(&m)
+
+	sameJson(t, a, b)
+}
+
+func TestLabelProto(t *testing.T) {
+	var labels Labels
+	if err := FromJson([]byte(`[{"name":"Pâine","parent":"Alimente","flags":1},{"name":"Alimente","parent":null}]`), &labels); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, a := range labels {
+		var m expensespb.Label
+		roundTrip(t, a.ToProto(), &m)
+
+		if a.ParentName.Valid != (m.Parent != nil) {
+			t.Fatalf("Expected null parent to be unset on message but got %v", m.Parent)
+		}
+
+		var b Label
+		b.FromProto(&m)
+
+		sameJson(t, a, b)
+	}
+}
+
+func TestTransactionProto(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-04-24")
+	pk := "3b0a4e3c-4b1e-4f0a-9d4e-3f3c2b1a0d9e"
+
+	trxs := Transactions{
+		Transaction{
+			UUID:         &pk,
+			Date:         date,
+			Amount:       -100,
+			LabelName:    "?",
+			SenderName:   "Alexandru",
+			ReceiverName: "Magazin",
+			Signature:    "signature/0",
+			Flags:        4,
+			Meta:         []byte(`{"external_id":"a-1"}`),
+			Tags:         []string{"trip", "work"},
+			Status:       StatusCleared,
+			Currency:     "RON",
+			Version:      3,
+			Details: []*Details{
+				{LabelName: "Pâine", Amount: 70, Headers: "image=/path/to/img"},
+				{LabelName: "Apă", Amount: 30},
+			},
+		},
+		Transaction{
+			Date:         date,
+			Amount:       5000,
+			LabelName:    "Transfer",
+			SenderName:   "?",
+			ReceiverName: "Alexandru",
+		},
+	}
+
+	for _, a := range trxs {
+		var m expensespb.Transaction
+		roundTrip(t, a.ToProto(), &m)
+
+		var b Transaction
+		b.FromProto(&m)
+
+		sameJson(t, a, b)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Unused returns the labels referenced by no transaction, no details and
+// no other label as parent (e.g. to prune them), sorted by their name.
+// Labels are shared by every suffixed set of tables (see InstallWithSuffix),
+// so references are checked in all of them, whatever TableSuffix is
+func (l *Labels) Unused(ctx PullContext) (Labels, error) {
+	q, err := unusedLabels(ctx.reader())
+	if err != nil {
+		return nil, err
+	}
+
+	var unused Labels
+	err = q.Limit(ctx.Limit).Offset(ctx.Offset).Find(&unused).Error
+
+	return unused, err
+}
+
+// Unused returns the actors referenced by no transaction, either as sender
+// or as receiver (e.g. to prune them), sorted by their name. Just like
+// labels, references are checked in every suffixed set of tables
+func (a *Actors) Unused(ctx PullContext) (Actors, error) {
+	q, err := unusedActors(ctx.reader())
+	if err != nil {
+		return nil, err
+	}
+
+	var unused Actors
+	err = q.Limit(ctx.Limit).Offset(ctx.Offset).Find(&unused).Error
+
+	return unused, err
+}
+
+// PruneUnusedLabels deletes the labels without references (see Unused) in a
+// single database transaction, where references are checked again to avoid
+// races with concurrent pushes. Parents of pruned labels become unused only
+// afterwards, so they're left for a later prune. Labels are shared by every
+// suffixed set of tables (see InstallWithSuffix), so references are checked
+// in all of them, whatever TableSuffix is. Upon success it returns the
+// number of labels deleted
+func PruneUnusedLabels(ctx PushContext) (int64, error) {
+	return prune(ctx, &Label{}, func(tx *gorm.DB) ([]string, error) {
+		q, err := unusedLabels(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		var unused Labels
+		err = q.Find(&unused).Error
+		return unused.names(), err
+	})
+}
+
+// PruneUnusedActors deletes the actors without references (see Unused) in a
+// single database transaction, where references are checked again to avoid
+// races with concurrent pushes. Just like labels, references are checked in
+// every suffixed set of tables. Upon success it returns the number of actors
+// deleted
+func PruneUnusedActors(ctx PushContext) (int64, error) {
+	return prune(ctx, &Actor{}, func(tx *gorm.DB) ([]string, error) {
+		q, err := unusedActors(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		var unused Actors
+		err = q.Find(&unused).Error
+		return unused.names(), err
+	})
+}
+
+// prune deletes the records of a model selected as unused. Actors and labels
+// are never suffixed, so the suffix of the context doesn't matter here
+func prune(ctx PushContext, model interface{}, unused func(*gorm.DB) ([]string, error)) (int64, error) {
+	var pruned int64
+	err := ctx.Storage.Transaction(func(tx *gorm.DB) error {
+		names, err := unused(tx)
+		if err != nil {
+			return err
+		} else if len(names) == 0 {
+			return nil
+		}
+
+		q := tx.Where("name IN ?", names).Delete(model)
+		pruned = q.RowsAffected
+
+		return q.Error
+	})
+
+	return pruned, err
+}
+
+// unusedLabels selects the labels without references in any of the sets of
+// transactions and details tables (see installedSuffixes), nor as parents
+func unusedLabels(db *gorm.DB) (*gorm.DB, error) {
+	suffixes, err := installedSuffixes(db)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := tableOf(db, &Label{})
+	name := clause.Column{Table: labels, Name: "name"}
+
+	q := db.Model(&Label{}).Where("NOT EXISTS (?)",
+		db.Table("?", clause.Table{Name: labels, Alias: "children"}).Select("1").
+			Where("? = ?", clause.Column{Table: "children", Name: "parent_name"}, name))
+
+	transactions, details := tableOf(db, &Transaction{}), tableOf(db, &Details{})
+	for _, suffix := range suffixes {
+		for _, table := range []string{transactions + suffix, details + suffix} {
+			q = q.Where("NOT EXISTS (?)", db.Table("?", clause.Table{Name: table}).Select("1").
+				Where("? = ?", clause.Column{Table: table, Name: "label_name"}, name))
+		}
+	}
+
+	return q.Order(clause.OrderByColumn{Column: name}), nil
+}
+
+// unusedActors selects the actors without references in any of the sets of
+// transactions tables (see installedSuffixes), either as sender or receiver
+func unusedActors(db *gorm.DB) (*gorm.DB, error) {
+	suffixes, err := installedSuffixes(db)
+	if err != nil {
+		return nil, err
+	}
+
+	actors, transactions := tableOf(db, &Actor{}), tableOf(db, &Transaction{})
+	name := clause.Column{Table: actors, Name: "name"}
+
+	q := db.Model(&Actor{})
+	for _, suffix := range suffixes {
+		table := transactions + suffix
+		q = q.Where("NOT EXISTS (?)", db.Table("?", clause.Table{Name: table}).Select("1").
+			Where("? = ? OR ? = ?",
+				clause.Column{Table: table, Name: "sender_name"}, name,
+				clause.Column{Table: table, Name: "receiver_name"}, name))
+	}
+
+	return q.Order(clause.OrderByColumn{Column: name}), nil
+}
+
+// installedSuffixes returns the suffixes of every set of transactions and
+// details tables installed (see InstallWithSuffix), starting with the one
+// without a suffix. Databases other than SQLite, PostgreSQL and MySQL can't
+// be listed, so only the tables without a suffix are known there
+func installedSuffixes(db *gorm.DB) ([]string, error) {
+	var query string
+	switch db.Dialector.Name() {
+	case "sqlite":
+		query = "SELECT name FROM sqlite_master WHERE type = 'table'"
+	case "postgres":
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA()"
+	case "mysql":
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE()"
+	default:
+		return []string{""}, nil
+	}
+
+	var names []string
+	if err := db.Raw(query).Scan(&names).Error; err != nil {
+		return nil, err
+	}
+
+	installed := make(map[string]bool, len(names))
+	for _, name := range names {
+		installed[name] = true
+	}
+
+	suffixes := []string{""}
+	transactions, details := tableOf(db, &Transaction{}), tableOf(db, &Details{})
+	for _, name := range names {
+		if suffix := strings.TrimPrefix(name, transactions); suffix != name && suffix != "" && installed[details+suffix] {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	sort.Strings(suffixes)
+
+	return suffixes, nil
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func seedUnused(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	root := NewLabel("Cheltuieli", nil)
+	food := NewLabel("Alimente", &root)
+
+	if err := (&Labels{NewLabel("Orfan", nil)}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	} else if err := (&Actors{NewActor("Nimeni")}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	trxs := Transactions{NewTransaction(date, -3000, food, NewActor("Alexandru"), NewActor("Magazin"),
+		map[Label]int64{NewLabel("Pâine", nil): 3000}, "")}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testUnused(t *testing.T, db *gorm.DB) {
+	seedUnused(t, db)
+
+	labels, err := (&Labels{}).Unused(PullContext{Storage: db})
+	if err != nil {
+		t.Fatal(err)
+	} else if names := labels.names(); fmt.Sprint(names) != "[Orfan]" {
+		t.Fatalf("Expected only the orphan label to be unused but got %v", names)
+	}
+
+	actors, err := (&Actors{}).Unused(PullContext{Storage: db})
+	if err != nil {
+		t.Fatal(err)
+	} else if names := actors.names(); fmt.Sprint(names) != "[Nimeni]" {
+		t.Fatalf("Expected only the orphan actor to be unused but got %v", names)
+	}
+}
+
+func testPrune(t *testing.T, db *gorm.DB) {
+	seedUnused(t, db)
+
+	if n, err := PruneUnusedLabels(PushContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("Expected one label to be pruned but got %d", n)
+	}
+
+	if n, err := PruneUnusedActors(PushContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("Expected one actor to be pruned but got %d", n)
+	}
+
+	var labels Labels
+	if err := labels.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if names := labels.names(); fmt.Sprint(names) != "[Alimente Cheltuieli Pâine]" {
+		t.Fatalf("Expected referenced labels to be left intact but got %v", names)
+	}
+
+	var actors Actors
+	if err := actors.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if names := actors.names(); fmt.Sprint(names) != "[Alexandru Magazin]" {
+		t.Fatalf("Expected referenced actors to be left intact but got %v", names)
+	}
+}
+
+func testPruneSuffixed(t *testing.T, db *gorm.DB) {
+	seedUnused(t, db)
+
+	if err := InstallWithSuffix(db, "_2021"); err != nil {
+		t.Fatal(err)
+	}
+	defer UninstallWithSuffix(db, "_2021")
+
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	archived := Transactions{NewTransaction(date, -1000, NewLabel("Orfan", nil), NewActor("Nimeni"), NewActor("Magazin"), nil, "")}
+	if err := archived.Push(PushContext{Storage: db, BatchSize: 10, TableSuffix: "_2021"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the replica sees the same tables, whatever the suffix
+	for _, suffix := range []string{"", "_2021"} {
+		ctx := PullContext{ReadStorage: db, TableSuffix: suffix}
+		if labels, err := (&Labels{}).Unused(ctx); err != nil {
+			t.Fatal(err)
+		} else if len(labels) != 0 {
+			t.Fatalf("Expected no unused label with suffix %q but got %v", suffix, labels.names())
+		}
+
+		if actors, err := (&Actors{}).Unused(ctx); err != nil {
+			t.Fatal(err)
+		} else if len(actors) != 0 {
+			t.Fatalf("Expected no unused actor with suffix %q but got %v", suffix, actors.names())
+		}
+	}
+
+	// labels and actors are shared, so the ones used by any set of tables stay
+	for _, suffix := range []string{"", "_2021"} {
+		if n, err := PruneUnusedLabels(PushContext{Storage: db, TableSuffix: suffix}); err != nil {
+			t.Fatal(err)
+		} else if n != 0 {
+			t.Fatalf("Expected no label to be pruned with suffix %q but got %d", suffix, n)
+		}
+
+		if n, err := PruneUnusedActors(PushContext{Storage: db, TableSuffix: suffix}); err != nil {
+			t.Fatal(err)
+		} else if n != 0 {
+			t.Fatalf("Expected no actor to be pruned with suffix %q but got %d", suffix, n)
+		}
+	}
+
+	var labels Labels
+	if err := labels.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if names := labels.names(); fmt.Sprint(names) != "[Alimente Cheltuieli Orfan Pâine]" {
+		t.Fatalf("Expected every label to be left intact but got %v", names)
+	}
+}
+
+func TestUnused_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testUnused(t, db)
+}
+
+func TestPrune_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testPrune(t, db)
+}
+
+func TestPruneSuffixed_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testPruneSuffixed(t, db)
+}
+
+func TestUnused_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testUnused(t, db)
+}
+
+func TestPrune_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testPrune(t, db)
+}
+
+func TestPruneSuffixed_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testPruneSuffixed(t, db)
+}
+
+func TestUnused_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testUnused(t, db)
+}
+
+func TestPrune_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testPrune(t, db)
+}
+
+func TestPruneSuffixed_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testPruneSuffixed(t, db)
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// QueryBuilder composes the filters of a pull one by one, which reads better
+// than a PullContext literal for reports with many conditions. Each method
+// returns a new builder, so a partial query can be shared and extended
+//
+//	trxs, err := Query().Between(from, to).Labels("Alimente").Limit(50).Transactions(db)
+type QueryBuilder struct {
+	ctx PullContext
+}
+
+// Query starts a new query without any filter
+func Query() QueryBuilder {
+	return QueryBuilder{}
+}
+
+// Between limits transactions to a window of dates (see PullContext.From)
+func (q QueryBuilder) Between(from, to time.Time) QueryBuilder {
+	q.ctx.From, q.ctx.To = from, to
+	return q
+}
+
+// Labels limits transactions to the ones with any of these labels
+func (q QueryBuilder) Labels(names ...string) QueryBuilder {
+	q.ctx.LabelNames = appendNames(q.ctx.LabelNames, names)
+	return q
+}
+
+// Senders limits transactions to the ones sent by any of these actors
+func (q QueryBuilder) Senders(names ...string) QueryBuilder {
+	q.ctx.SenderNames = appendNames(q.ctx.SenderNames, names)
+	return q
+}
+
+// Receivers limits transactions to the ones received by any of these actors
+func (q QueryBuilder) Receivers(names ...string) QueryBuilder {
+	q.ctx.ReceiverNames = appendNames(q.ctx.ReceiverNames, names)
+	return q
+}
+
+// Currencies limits transactions to the ones in any of these currencies
+func (q QueryBuilder) Currencies(codes ...string) QueryBuilder {
+	q.ctx.Currencies = appendNames(q.ctx.Currencies, codes)
+	return q
+}
+
+// Tags limits transactions to the ones tagged with all of these tags
+func (q QueryBuilder) Tags(names ...string) QueryBuilder {
+	q.ctx.HasTags = appendNames(q.ctx.HasTags, names)
+	return q
+}
+
+// Statuses limits transactions to the ones in any of these statuses
+func (q QueryBuilder) Statuses(statuses ...Status) QueryBuilder {
+	q.ctx.Statuses = append(q.ctx.Statuses[:len(q.ctx.Statuses):len(q.ctx.Statuses)], statuses...)
+	return q
+}
+
+// ExcludeFlags skips the records which have any of these flags set
+func (q QueryBuilder) ExcludeFlags(flags uint16) QueryBuilder {
+	q.ctx.ExcludeFlags |= flags
+	return q
+}
+
+// Limit reads at most n records
+func (q QueryBuilder) Limit(n int) QueryBuilder {
+	q.ctx.Limit = n
+	return q
+}
+
+// Offset skips the first n records
+func (q QueryBuilder) Offset(n int) QueryBuilder {
+	q.ctx.Offset = n
+	return q
+}
+
+// Context returns the PullContext of the query on the given storage, to be
+// used with any pull or aggregation of transactions (e.g. MonthlyTotals),
+// which all apply the same filters
+func (q QueryBuilder) Context(db *gorm.DB) PullContext {
+	ctx := q.ctx
+	ctx.Storage = db
+
+	return ctx
+}
+
+// Transactions pulls the transactions matching the query right away
+func (q QueryBuilder) Transactions(db *gorm.DB) (Transactions, error) {
+	var trxs Transactions
+	if err := trxs.Pull(q.Context(db)); err != nil {
+		return nil, err
+	}
+
+	return trxs, nil
+}
+
+// appendNames adds names to a filter without sharing the backing array of
+// another builder
+func appendNames(filter, names []string) []string {
+	return append(filter[:len(filter):len(filter)], names...)
+}
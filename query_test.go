@@ -0,0 +1,116 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func testQueryBuilder(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	food, transport := NewLabel("Alimente", nil), NewLabel("Transport", nil)
+	me, partner := NewActor("Alexandru"), NewActor("Ioana")
+
+	trxs := Transactions{
+		NewTransaction(date, -1000, food, me, NewActor("Magazin"), nil, ""),
+		NewTransaction(date.AddDate(0, 0, 5), -2000, food, me, NewActor("Piață"), nil, ""),
+		NewTransaction(date.AddDate(0, 0, 6), -3000, food, partner, NewActor("Magazin"), nil, ""),
+		NewTransaction(date.AddDate(0, 0, 7), -4000, transport, me, NewActor("Autobuz"), nil, ""),
+		NewTransaction(date.AddDate(0, 1, 0), -5000, food, me, NewActor("Magazin"), nil, ""),
+	}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	amounts := func(trxs Transactions) string {
+		var amounts []int64
+		for _, trx := range trxs {
+			amounts = append(amounts, trx.Amount)
+		}
+		return fmt.Sprint(amounts)
+	}
+
+	month := Query().Between(date, date.AddDate(0, 0, 30))
+	pulled, err := month.Labels("Alimente").Senders("Alexandru").Limit(50).Transactions(db)
+	if err != nil {
+		t.Fatal(err)
+	} else if expected := "[-2000 -1000]"; amounts(pulled) != expected {
+		t.Fatalf("Expected transactions %s but got %s instead", expected, amounts(pulled))
+	}
+
+	// the shared part of the query isn't changed by the other queries
+	pulled, err = month.Receivers("Magazin", "Autobuz").Transactions(db)
+	if err != nil {
+		t.Fatal(err)
+	} else if expected := "[-4000 -3000 -1000]"; amounts(pulled) != expected {
+		t.Fatalf("Expected transactions %s but got %s instead", expected, amounts(pulled))
+	}
+
+	// the context works with other pulls as well
+	income, expense, err := (&Transactions{}).IncomeExpense(month.Labels("Alimente").Context(db))
+	if err != nil {
+		t.Fatal(err)
+	} else if income != 0 || expense != -6000 {
+		t.Fatalf("Expected expenses of -6000 but got %d and %d instead", income, expense)
+	}
+
+	// aggregations apply the same filters as pulls
+	if err := trxs.SetStatus(PushContext{Storage: db}, []string{*trxs[0].UUID}, StatusCleared); err != nil {
+		t.Fatal(err)
+	}
+
+	cleared := month.Labels("Alimente").Statuses(StatusCleared).Context(db)
+	if _, expense, err := (&Transactions{}).IncomeExpense(cleared); err != nil {
+		t.Fatal(err)
+	} else if expense != -1000 {
+		t.Fatalf("Expected expenses of the cleared transaction only but got %d instead", expense)
+	}
+
+	if summaries, err := (&Transactions{}).PullWithDetailCounts(cleared); err != nil {
+		t.Fatal(err)
+	} else if len(summaries) != 1 || summaries[0].Amount != -1000 {
+		t.Fatalf("Expected the cleared transaction only but got %v instead", summaries)
+	}
+}
+
+func TestQueryBuilder_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testQueryBuilder(t, db)
+}
+
+func TestQueryBuilder_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testQueryBuilder(t, db)
+}
+
+func TestQueryBuilder_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testQueryBuilder(t, db)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Receipt formats the transaction as a plain-text block, meant to be read
+// (or shared) by people rather than parsed. The details are listed one per
+// line, with their amounts aligned to the right just like the total
+func (t *Transaction) Receipt() string {
+	header := [][2]string{
+		{"Date", t.Date.Format(DateFormat)},
+		{"Sender", actorName(t.SenderName, t.Sender)},
+		{"Receiver", actorName(t.ReceiverName, t.Receiver)},
+		{"Label", labelName(t.LabelName, t.Label)},
+	}
+	if t.Currency != "" {
+		header = append(header, [2]string{"Currency", t.Currency})
+	}
+
+	lines := make([][2]string, 0, len(t.Details)+1)
+	for _, d := range t.Details {
+		lines = append(lines, [2]string{d.labelName(), FormatAmountIn(d.Amount, t.Currency)})
+	}
+	total := [2]string{"Total", FormatAmountIn(t.Amount, t.Currency)}
+
+	keys, names, amounts := 0, utf8.RuneCountInString(total[0]), utf8.RuneCountInString(total[1])
+	for _, h := range header {
+		keys = max(keys, utf8.RuneCountInString(h[0]))
+	}
+	for _, l := range lines {
+		names = max(names, utf8.RuneCountInString(l[0]))
+		amounts = max(amounts, utf8.RuneCountInString(l[1]))
+	}
+
+	var b strings.Builder
+	width := names + 2 + amounts
+	for _, h := range header {
+		line := pad(h[0], keys+2) + h[1]
+		width = max(width, utf8.RuneCountInString(line))
+		fmt.Fprintln(&b, line)
+	}
+
+	rule := strings.Repeat("-", width)
+	row := func(l [2]string) {
+		fmt.Fprintln(&b, pad(l[0], width-amounts)+strings.Repeat(" ", amounts-utf8.RuneCountInString(l[1]))+l[1])
+	}
+
+	fmt.Fprintln(&b, rule)
+	if len(lines) > 0 {
+		for _, l := range lines {
+			row(l)
+		}
+		fmt.Fprintln(&b, rule)
+	}
+	row(total)
+
+	return b.String()
+}
+
+// pad fills the text with spaces up to the width (in runes)
+func pad(text string, width int) string {
+	if n := utf8.RuneCountInString(text); n < width {
+		return text + strings.Repeat(" ", width-n)
+	}
+
+	return text
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransactionReceipt(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-05-03")
+	trx := NewTransaction(date, -3050, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"),
+		map[Label]int64{NewLabel("Pâine", nil): 1050, NewLabel("Apă", nil): 2000}, "")
+
+	expected := `Date      Mon 03 May 2021
+Sender    Alexandru
+Receiver  Magazin
+Label     Alimente
+-------------------------
+Apă                 20.00
+Pâine               10.50
+-------------------------
+Total              -30.50
+`
+	if receipt := trx.Receipt(); receipt != expected {
+		t.Fatalf("Expected receipt\n%s\nbut got\n%s", expected, receipt)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MatchSpec defines how Reconcile identifies a transaction which is already
+// in registry, e.g. the same real-world transaction reported by another
+// source. Candidates always have the same amount and a date within Window
+type MatchSpec struct {
+	Window       time.Duration // tolerance of dates, both before and after
+	SameSender   bool          // candidates must have the same sender
+	SameReceiver bool          // candidates must have the same receiver
+}
+
+// query narrows down the transactions matching the given one, while
+// skipping the ones already claimed by other matches (see closest)
+func (m MatchSpec) query(db *gorm.DB, trx Transaction, claimed []string) *gorm.DB {
+	q := db.Model(&Transaction{}).Where("amount = ?", trx.Amount).
+		Where("date BETWEEN ? AND ?", trx.Date.Add(-m.Window), trx.Date.Add(m.Window))
+
+	if m.SameSender {
+		q = q.Where("sender_name = ?", actorName(trx.SenderName, trx.Sender))
+	}
+
+	if m.SameReceiver {
+		q = q.Where("receiver_name = ?", actorName(trx.ReceiverName, trx.Receiver))
+	}
+
+	if len(claimed) > 0 {
+		q = q.Where("uuid NOT IN ?", claimed)
+	}
+
+	return q
+}
+
+// closest returns the candidate whose date is the closest to the given
+// transaction's, or nil if there's none. Candidates equally close are told
+// apart by their UUID, so the same registry always gives the same match.
+// Dates are compared here rather than by the database, since each dialect
+// has its own date arithmetic (and the window keeps candidates few)
+func (m MatchSpec) closest(db *gorm.DB, trx Transaction, claimed []string) (*Transaction, error) {
+	var candidates []Transaction
+	if err := m.query(db, trx, claimed).Select("uuid", "date", "version").Order("uuid").Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	var best *Transaction
+	for i := range candidates {
+		if c := &candidates[i]; best == nil || distance(c.Date, trx.Date) < distance(best.Date, trx.Date) {
+			best = c
+		}
+	}
+
+	return best, nil
+}
+
+// distance is the absolute duration between two times
+func distance(a, b time.Time) time.Duration {
+	if d := a.Sub(b); d >= 0 {
+		return d
+	}
+
+	return b.Sub(a)
+}
+
+// actorName returns the name of an actor referenced either by name or by
+// the associated struct
+func actorName(name string, actor *Actor) string {
+	if name == "" && actor != nil {
+		return actor.Name
+	}
+
+	return name
+}
+
+// Reconcile pushes transactions from a source which may overlap with the
+// registry. Transactions without an UUID are matched against the registry
+// (see MatchSpec): matches update the existing records, and replace their
+// details if any are given, while the rest are inserted. Everything happens
+// in a single database transaction, so either all records are written or
+// none of them. With SkipInvalid set, invalid transactions are neither
+// matched nor pushed, and they're reported along with the rest
+func (t *Transactions) Reconcile(ctx PushContext, match MatchSpec) (PushResult, error) {
+	invalid := make(map[int]bool)
+	if ctx.SkipInvalid {
+		_, _, skipped := t.partition(ctx)
+		for _, skip := range skipped {
+			invalid[skip.Index] = true
+		}
+	}
+
+	// the keys and versions are given back if the database transaction is
+	// rolled back, since they'd refer to records which were never written
+	type key struct {
+		uuid    *string
+		version uint
+	}
+	keys := make([]key, len(*t))
+	for i, trx := range *t {
+		keys[i] = key{trx.UUID, trx.Version}
+	}
+
+	var result PushResult
+	err := ctx.Storage.Transaction(func(tx *gorm.DB) (err error) {
+		var claimed []string
+		for i := range *t {
+			trx := &(*t)[i]
+			if invalid[i] || trx.UUID != nil && *trx.UUID != "" {
+				continue
+			}
+
+			stored, err := match.closest(tx, *trx, claimed)
+			if err != nil {
+				return err
+			} else if stored == nil {
+				continue
+			}
+
+			if len(trx.Details) > 0 {
+				if err := tx.Where("transaction_uuid = ?", *stored.UUID).Delete(&Details{}).Error; err != nil {
+					return err
+				}
+			}
+
+			// the match updates the stored transaction, as of its version
+			trx.UUID, trx.Version = stored.UUID, stored.Version
+			claimed = append(claimed, *stored.UUID)
+		}
+
+		// a match always updates the stored transaction, whatever the mode
+		subctx := ctx
+		subctx.Storage = tx
+		subctx.JustAppend, subctx.OnConflict = false, ConflictUpdateAll
+		if result, err = t.PushWithResult(subctx); err != nil {
+			return err
+		}
+
+		result.Merged = len(claimed)
+		result.Pushed -= result.Merged
+
+		return nil
+	})
+	if err != nil {
+		for i, k := range keys {
+			(*t)[i].UUID, (*t)[i].Version = k.uuid, k.version
+		}
+
+		return PushResult{}, err
+	}
+
+	return result, nil
+}
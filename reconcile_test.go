@@ -0,0 +1,171 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func testReconcile(t *testing.T, db *gorm.DB) {
+	ctx := PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true}
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+
+	existing := Transactions{
+		NewTransaction(day("2021-05-01"), -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""),
+	}
+	if err := existing.Push(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ls := map[Label]int64{NewLabel("Pâine", nil): 1000, NewLabel("Lapte", nil): 2000}
+	incoming := Transactions{
+		NewTransaction(day("2021-05-02"), -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, ""),
+		NewTransaction(day("2021-05-02"), -4500, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""),
+	}
+
+	result, err := incoming.Reconcile(ctx, MatchSpec{Window: 24 * time.Hour, SameReceiver: true})
+	if err != nil {
+		t.Fatal(err)
+	} else if result.Merged != 1 || result.Pushed != 1 {
+		t.Fatalf("Expected one merged and one pushed transaction, got %+v", result)
+	}
+
+	if *incoming[0].UUID != *existing[0].UUID {
+		t.Fatalf("Expected near duplicate to be merged into %s, got %s", *existing[0].UUID, *incoming[0].UUID)
+	}
+
+	var got Transactions
+	if err := got.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 2 {
+		t.Fatalf("Expected 2 transactions after reconcile, got %v", got)
+	}
+
+	merged, err := got.Get(PullContext{Storage: db}, *existing[0].UUID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(merged.Details) != 2 {
+		t.Fatalf("Expected merged transaction to have the incoming details, got %v", merged.Details)
+	}
+
+	// out of the window of dates, nothing matches
+	late := Transactions{
+		NewTransaction(day("2021-05-05"), -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""),
+	}
+	if result, err := late.Reconcile(ctx, MatchSpec{Window: 24 * time.Hour}); err != nil {
+		t.Fatal(err)
+	} else if result.Merged != 0 || result.Pushed != 1 {
+		t.Fatalf("Expected transaction out of window to be pushed, got %+v", result)
+	}
+
+	// the closest candidate wins over the earliest one
+	candidates := Transactions{
+		NewTransaction(day("2021-06-01"), -700, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "early"),
+		NewTransaction(day("2021-06-03"), -700, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "same day"),
+	}
+	if err := candidates.Push(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stored version is carried over, whatever it is
+	if _, err := candidates.SetFlags(ctx, []string{*candidates[1].UUID}, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	duplicate := Transactions{
+		NewTransaction(day("2021-06-03"), -700, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""),
+	}
+	if _, err := duplicate.Reconcile(ctx, MatchSpec{Window: 72 * time.Hour}); err != nil {
+		t.Fatal(err)
+	} else if *duplicate[0].UUID != *candidates[1].UUID {
+		t.Fatalf("Expected the same day candidate %s to match, got %s", *candidates[1].UUID, *duplicate[0].UUID)
+	}
+
+	// a match updates the stored transaction, whatever the mode of conflicts
+	strict := ctx
+	strict.OnConflict = ConflictError
+	again := Transactions{
+		NewTransaction(day("2021-06-03"), -700, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""),
+	}
+	if result, err := again.Reconcile(strict, MatchSpec{Window: 24 * time.Hour}); err != nil {
+		t.Fatal(err)
+	} else if result.Merged != 1 || result.Pushed != 0 {
+		t.Fatalf("Expected the duplicate to be merged despite ConflictError, got %+v", result)
+	}
+
+	// a failed reconcile leaves the caller's transactions as they were
+	failing := Transactions{
+		NewTransaction(day("2021-06-03"), -700, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""),
+		NewTransaction(day("2021-07-01"), -900, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"),
+			map[Label]int64{NewLabel("Pâine", nil): 100}, ""),
+	}
+	if _, err := failing.Reconcile(ctx, MatchSpec{Window: 24 * time.Hour}); err == nil {
+		t.Fatal("Expected reconcile to fail because of mismatched details")
+	} else if failing[0].UUID != nil || failing[0].Version != 0 {
+		t.Fatalf("Expected the match to be given back on failure, got %v at version %d", *failing[0].UUID, failing[0].Version)
+	}
+
+	// skipped transactions don't roll back the valid ones
+	mismatch := map[Label]int64{NewLabel("Pâine", nil): 100}
+	messy := Transactions{
+		NewTransaction(day("2021-07-01"), -800, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""),
+		NewTransaction(day("2021-07-01"), -900, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), mismatch, ""),
+	}
+	skipctx := ctx
+	skipctx.SkipInvalid = true
+	if result, err := messy.Reconcile(skipctx, MatchSpec{Window: 24 * time.Hour}); err != nil {
+		t.Fatal(err)
+	} else if result.Pushed != 1 || len(result.Skipped) != 1 || result.Skipped[0].Index != 1 {
+		t.Fatalf("Expected one pushed and one skipped transaction, got %+v", result)
+	}
+
+	if ok, err := got.Exists(PullContext{Storage: db}, *messy[0].UUID); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("Expected the valid transaction to be written")
+	}
+}
+
+func TestReconcile_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testReconcile(t, db)
+}
+
+func TestReconcile_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testReconcile(t, db)
+}
+
+func TestReconcile_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testReconcile(t, db)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"time"
+)
+
+// Recurrence is the interval at which a recurring transaction repeats
+type Recurrence int
+
+const (
+	Daily Recurrence = iota
+	Weekly
+	Monthly
+	Yearly
+)
+
+// String representation of a recurrence interval
+func (r Recurrence) String() string {
+	switch r {
+	case Daily:
+		return "daily"
+	case Weekly:
+		return "weekly"
+	case Monthly:
+		return "monthly"
+	case Yearly:
+		return "yearly"
+	}
+
+	return fmt.Sprintf("Recurrence(%d)", int(r))
+}
+
+// next returns the n-th occurrence after start. Months and years are added
+// to the original date, so the day of month is kept whenever possible and
+// clamped to the end of shorter months (e.g. Jan 31 yields Feb 28, Mar 31)
+func (r Recurrence) next(start time.Time, n int) (time.Time, error) {
+	switch r {
+	case Daily:
+		return start.AddDate(0, 0, n), nil
+	case Weekly:
+		return start.AddDate(0, 0, 7*n), nil
+	case Monthly:
+		return addMonths(start, n), nil
+	case Yearly:
+		return addMonths(start, 12*n), nil
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported recurrence %v", r)
+}
+
+// addMonths is like time.AddDate(0, n, 0) except it doesn't overflow into
+// the next month when the day doesn't exist in the target month
+func addMonths(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+
+	return first.AddDate(0, 0, d-1)
+}
+
+// ExpandRecurring clones a template transaction at every occurrence between
+// start and end (both inclusive), each with a new UUID and its own copy of
+// the template's details. It doesn't touch the registry, so the result can
+// be reviewed before being pushed
+func ExpandRecurring(template Transaction, start, end time.Time, every Recurrence) (Transactions, error) {
+	if end.Before(start) {
+		return nil, fmt.Errorf("recurrence ends (%s) before it starts (%s)", end.Format(DateFormat), start.Format(DateFormat))
+	}
+
+	var trxs Transactions
+	for n := 0; ; n++ {
+		date, err := every.next(start, n)
+		if err != nil {
+			return nil, err
+		} else if date.After(end) {
+			break
+		}
+
+		trx := template
+		pk := UUIDFunc()
+		trx.UUID, trx.Date = &pk, date
+		trx.CreatedAt, trx.UpdatedAt = time.Time{}, time.Time{}
+
+		trx.Details = make([]*Details, 0, len(template.Details))
+		for _, d := range template.Details {
+			dd := *d
+			dd.UUID, dd.TransactionUUID, dd.Transaction = nil, "", nil
+			dd.CreatedAt, dd.UpdatedAt = time.Time{}, time.Time{}
+			trx.Details = append(trx.Details, &dd)
+		}
+
+		trxs = append(trxs, trx)
+	}
+
+	return trxs, nil
+}
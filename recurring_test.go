@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExpandRecurringMonthly(t *testing.T) {
+	start, _ := time.Parse("2006-01-02", "2021-01-05")
+	end, _ := time.Parse("2006-01-02", "2021-12-31")
+
+	rent := NewTransaction(start, -100000, NewLabel("Chirie", nil), NewActor("Alexandru"), NewActor("Proprietar"), map[Label]int64{NewLabel("Chirie", nil): 100000}, "")
+
+	trxs, err := ExpandRecurring(rent, start, end, Monthly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trxs) != 12 {
+		t.Fatalf("Expected 12 monthly transactions but got %d instead", len(trxs))
+	}
+
+	seen := make(map[string]bool)
+	for i, trx := range trxs {
+		if trx.Date.Month() != time.Month(i+1) || trx.Date.Day() != 5 {
+			t.Fatalf("Expected transaction #%d on the 5th of month %d but got %s", i, i+1, trx.Date.Format(DateFormat))
+		}
+
+		if trx.UUID == nil || seen[*trx.UUID] {
+			t.Fatalf("Expected transaction #%d to have a new UUID", i)
+		}
+		seen[*trx.UUID] = true
+
+		if len(trx.Details) != 1 || trx.Details[0] == rent.Details[0] {
+			t.Fatalf("Expected transaction #%d to have its own copy of details", i)
+		}
+	}
+}
+
+func TestExpandRecurringMonthEnd(t *testing.T) {
+	defer func(fn func() string) { UUIDFunc = fn }(UUIDFunc)
+
+	var seq int
+	UUIDFunc = func() string {
+		seq++
+		return fmt.Sprintf("00000000-0000-0000-0000-%012d", seq)
+	}
+
+	start, _ := time.Parse("2006-01-02", "2021-01-31")
+	end, _ := time.Parse("2006-01-02", "2021-04-30")
+
+	trxs, err := ExpandRecurring(Transaction{Amount: -100}, start, end, Monthly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"2021-01-31", "2021-02-28", "2021-03-31", "2021-04-30"}
+	if len(trxs) != len(expected) {
+		t.Fatalf("Expected %d transactions but got %d instead", len(expected), len(trxs))
+	}
+
+	for i, trx := range trxs {
+		if got := trx.Date.Format("2006-01-02"); got != expected[i] {
+			t.Fatalf("Expected transaction #%d on %s but got %s", i, expected[i], got)
+		}
+
+		if uuid := fmt.Sprintf("00000000-0000-0000-0000-%012d", i+1); *trx.UUID != uuid {
+			t.Fatalf("Expected transaction #%d UUID %s from UUIDFunc, got %s", i, uuid, *trx.UUID)
+		}
+	}
+
+	if _, err := ExpandRecurring(Transaction{}, end, start, Monthly); err == nil {
+		t.Fatal("Expected failure because recurrence ends before it starts")
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Entity is any of the registry key components that can be handled by the
+// generic Repository (see below)
+type Entity interface {
+	Actor | Label | Transaction
+}
+
+// Repository is a thin ergonomic layer on top of the registry collections
+// (Actors, Labels, Transactions) which spares the caller from the Push and
+// Pull ceremony. The underlying behaviour is the same as the collections'
+//
+//	repo := NewRepository[Transaction](db)
+//	trxs, err := repo.List(10, 0)
+type Repository[T Entity] struct {
+
+	// Storage is mainly Maria/MySQL with little support for SQLite
+	Storage *gorm.DB
+
+	// BatchSize is used on Create and defaults to 100 on NewRepository
+	BatchSize int
+}
+
+// NewRepository is an idiomatic constructor for the Repository of any of
+// the registry key components
+func NewRepository[T Entity](db *gorm.DB) *Repository[T] {
+	return &Repository[T]{Storage: db, BatchSize: 100}
+}
+
+// Create pushes the given items into registry (see Push on collections)
+func (r *Repository[T]) Create(items ...T) error {
+	return registryOf(&items).Push(PushContext{Storage: r.Storage, BatchSize: r.BatchSize})
+}
+
+// List pulls the items from registry (see Pull on collections)
+func (r *Repository[T]) List(limit, offset int) ([]T, error) {
+	var items []T
+	if err := registryOf(&items).Pull(PullContext{Storage: r.Storage, Limit: limit, Offset: offset}); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Get reads a single item from registry by its primary key (a name for
+// actors and labels, an UUID for transactions) or returns ErrNotFound
+func (r *Repository[T]) Get(key string) (*T, error) {
+	ctx := PullContext{Storage: r.Storage}
+
+	var item interface{}
+	var err error
+	switch any(new(T)).(type) {
+	case *Actor:
+		item, err = (&Actors{}).Get(ctx, key)
+	case *Label:
+		item, err = (&Labels{}).Get(ctx, key)
+	case *Transaction:
+		item, err = (&Transactions{}).Get(ctx, key)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return item.(*T), nil
+}
+
+// Delete removes a single item from registry by its primary key and, in
+// case of transactions, its details, tags and attachments as well. If
+// there's no such item, ErrNotFound is returned instead
+func (r *Repository[T]) Delete(key string) error {
+	entity, column := keyOf[T]()
+
+	return r.Storage.Transaction(func(tx *gorm.DB) error {
+		if _, ok := any(new(T)).(*Transaction); ok {
+			if err := tx.Where("transaction_uuid = ?", key).Delete(&Details{}).Error; err != nil {
+				return err
+			} else if err := tx.Where("transaction_uuid = ?", key).Delete(&TransactionTag{}).Error; err != nil {
+				return err
+			} else if err := tx.Where("transaction_uuid = ?", key).Delete(&Attachment{}).Error; err != nil {
+				return err
+			}
+		}
+
+		q := tx.Where(column+" = ?", key).Delete(new(T))
+		if q.Error != nil {
+			return q.Error
+		} else if q.RowsAffected == 0 {
+			return fmt.Errorf("%s %s: %w", entity, key, ErrNotFound)
+		}
+
+		return nil
+	})
+}
+
+// registryOf returns the registry collection backed by the given items
+func registryOf[T Entity](items *[]T) Registry {
+	switch v := any(items).(type) {
+	case *[]Actor:
+		return (*Actors)(v)
+	case *[]Label:
+		return (*Labels)(v)
+	case *[]Transaction:
+		return (*Transactions)(v)
+	}
+
+	panic("unsupported registry entity")
+}
+
+// keyOf returns the entity name and its primary key column
+func keyOf[T Entity]() (string, string) {
+	switch any(new(T)).(type) {
+	case *Actor:
+		return "actor", "name"
+	case *Label:
+		return "label", "name"
+	}
+
+	return "transaction", "uuid"
+}
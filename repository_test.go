@@ -0,0 +1,203 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func testActorsRepository(t *testing.T, db *gorm.DB) {
+	repo := NewRepository[Actor](db)
+
+	if err := repo.Create(NewActor("Alexandru"), NewActor("Magazin")); err != nil {
+		t.Fatal(err)
+	}
+
+	if actors, err := repo.List(10, 0); err != nil {
+		t.Fatal(err)
+	} else if len(actors) != 2 || actors[0].Name != "Alexandru" {
+		t.Fatalf("Expected 2 actors sorted by name but got %v", actors)
+	}
+
+	if a, err := repo.Get("Magazin"); err != nil || a.Name != "Magazin" {
+		t.Fatalf("Expected actor Magazin but got %v (%v)", a, err)
+	}
+
+	if err := repo.Delete("Magazin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.Get("Magazin"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected deleted actor to be absent but got %v", err)
+	}
+
+	if err := repo.Delete("Magazin"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected second delete to fail with ErrNotFound but got %v", err)
+	}
+}
+
+func testLabelsRepository(t *testing.T, db *gorm.DB) {
+	repo := NewRepository[Label](db)
+
+	if err := repo.Create(NewLabel("Pâine", &Label{Name: "Alimente"})); err != nil {
+		t.Fatal(err)
+	}
+
+	if labels, err := repo.List(10, 0); err != nil {
+		t.Fatal(err)
+	} else if len(labels) != 2 {
+		t.Fatalf("Expected 2 labels but got %v", labels)
+	}
+
+	if lb, err := repo.Get("Pâine"); err != nil || lb.Parent == nil || lb.Parent.Name != "Alimente" {
+		t.Fatalf("Expected label with parent Alimente but got %v (%v)", lb, err)
+	}
+
+	if err := repo.Delete("Pâine"); err != nil {
+		t.Fatal(err)
+	}
+
+	if labels, err := repo.List(10, 0); err != nil {
+		t.Fatal(err)
+	} else if len(labels) != 1 {
+		t.Fatalf("Expected 1 label after delete but got %v", labels)
+	}
+}
+
+func testTransactionsRepository(t *testing.T, db *gorm.DB) {
+	repo := NewRepository[Transaction](db)
+
+	date, _ := time.Parse("2006-01-02", "2021-04-22")
+	ls := map[Label]int64{NewLabel("Pâine", nil): 3000}
+	trx := NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "signature/0")
+	trx.Tags = []string{"vacanță"}
+
+	if err := repo.Create(trx); err != nil {
+		t.Fatal(err)
+	}
+
+	trxs, err := repo.List(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(trxs) != 1 || len(trxs[0].Details) != 1 {
+		t.Fatalf("Expected 1 transaction with details but got %v", trxs)
+	}
+
+	if tx, err := repo.Get(*trxs[0].UUID); err != nil || tx.Amount != -3000 {
+		t.Fatalf("Expected transaction but got %v (%v)", tx, err)
+	}
+
+	receipt := Attachments{{Filename: "bon.jpg", Mime: "image/jpeg"}}
+	if err := receipt.Attach(PushContext{Storage: db, BatchSize: 10}, *trxs[0].UUID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Delete(*trxs[0].UUID); err != nil {
+		t.Fatal(err)
+	}
+
+	var numDetails int64
+	if err := db.Model(&Details{}).Count(&numDetails).Error; err != nil {
+		t.Fatal(err)
+	} else if numDetails != 0 {
+		t.Fatalf("Expected details to be deleted with transaction but got %d", numDetails)
+	}
+
+	var numTags int64
+	if err := db.Model(&TransactionTag{}).Count(&numTags).Error; err != nil {
+		t.Fatal(err)
+	} else if numTags != 0 {
+		t.Fatalf("Expected tags to be deleted with transaction but got %d", numTags)
+	}
+
+	var numAttachments int64
+	if err := db.Model(&Attachment{}).Count(&numAttachments).Error; err != nil {
+		t.Fatal(err)
+	} else if numAttachments != 0 {
+		t.Fatalf("Expected attachments to be deleted with transaction but got %d", numAttachments)
+	}
+}
+
+func TestActorsRepository_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testActorsRepository(t, db)
+}
+
+func TestLabelsRepository_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testLabelsRepository(t, db)
+}
+
+func TestTransactionsRepository_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testTransactionsRepository(t, db)
+}
+
+func TestActorsRepository_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testActorsRepository(t, db)
+}
+
+func TestLabelsRepository_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testLabelsRepository(t, db)
+}
+
+func TestTransactionsRepository_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testTransactionsRepository(t, db)
+}
+
+func TestActorsRepository_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testActorsRepository(t, db)
+}
+
+func TestLabelsRepository_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testLabelsRepository(t, db)
+}
+
+func TestTransactionsRepository_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testTransactionsRepository(t, db)
+}
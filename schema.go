@@ -0,0 +1,139 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// JSONSchema returns the JSON Schema (draft-07) of the payload of a registry
+// (e.g. &Transactions{}), as accepted by FromJson and written by ToJson. It's
+// generated from the struct tags: every field without omitempty is required,
+// amounts are either numbers or decimal strings (see jsonAmount) and
+// references which may be missing, such as the parent of a label, are
+// nullable
+func JSONSchema(reg Registry) []byte {
+	schema := schemaOf(reflect.TypeOf(reg).Elem())
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+
+	out, _ := json.Marshal(schema) // a schema is always serializable
+	return out
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	nullStringType  = reflect.TypeOf(NullString{})
+	metaType        = reflect.TypeOf(datatypes.JSON{})
+	statusType      = reflect.TypeOf(Status(""))
+	transactionType = reflect.TypeOf(Transaction{})
+	detailsType     = reflect.TypeOf(Details{})
+)
+
+// amountSchema describes the amounts of transactions and details, which are
+// read either as numbers (minor units if integers) or as decimal strings (see
+// jsonAmount)
+var amountSchema = map[string]interface{}{
+	"oneOf": []map[string]interface{}{
+		{"type": "number"},
+		{"type": "string", "pattern": `^[+-]?[0-9]+(\.[0-9]+)?$`},
+	},
+}
+
+// schemaOf describes a Go type the way encoding/json serializes it
+func schemaOf(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case nullStringType:
+		return map[string]interface{}{"type": []string{"string", "null"}}
+	case metaType:
+		return map[string]interface{}{}
+	case statusType:
+		return map[string]interface{}{"type": "string", "enum": []Status{StatusPending, StatusCleared, StatusReconciled}}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return nullable(schemaOf(t.Elem()))
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return nullable(map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())})
+	case reflect.Struct:
+		return objectSchemaOf(t)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0, "maximum": uint64(1)<<t.Bits() - 1}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// objectSchemaOf describes the JSON fields of a struct
+func objectSchemaOf(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		if name == "amount" && (t == transactionType || t == detailsType) {
+			properties[name] = amountSchema
+		} else {
+			properties[name] = schemaOf(field.Type)
+		}
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
+
+// nullable makes a schema accept null as well
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	if kind, ok := schema["type"].(string); ok {
+		schema["type"] = []string{kind, "null"}
+	}
+
+	return schema
+}
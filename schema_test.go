@@ -0,0 +1,78 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+func TestJSONSchema_Json(t *testing.T) {
+	schema := gojsonschema.NewBytesLoader(JSONSchema(&Transactions{}))
+
+	date, _ := time.Parse("2006-01-02", "2021-04-24")
+	parent := NewLabel("Cheltuieli", nil)
+	trxs := Transactions{
+		NewTransaction(date, -3000, NewLabel("Alimente", &parent), NewActor("Alexandru"), NewActor("Magazin"),
+			map[Label]int64{NewLabel("Pâine", nil): 1000, NewLabel("Lapte", nil): 2000}, ""),
+		NewTransaction(date, -1500, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"), nil, ""),
+	}
+
+	payload, err := ToJson(&trxs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := gojsonschema.Validate(schema, gojsonschema.NewBytesLoader(payload)); err != nil {
+		t.Fatal(err)
+	} else if !result.Valid() {
+		t.Fatalf("Expected the payload to be valid but got %v", result.Errors())
+	}
+
+	invalid := []string{
+		`[{"date":"2021-04-24T00:00:00Z","amount":"-30.0.0","label":"Alimente","sender":"Alexandru","receiver":"Magazin","signature":"","flags":0,"headers":"","details":null}]`,
+		`[{"date":"2021-04-24T00:00:00Z","amount":-3000,"sender":"Alexandru","receiver":"Magazin","signature":"","flags":0,"headers":"","details":null}]`,
+		`[{"date":"2021-04-24T00:00:00Z","amount":-3000,"label":"Alimente","sender":"Alexandru","receiver":"Magazin","signature":"","flags":-1,"headers":"","details":null}]`,
+	}
+	decimal := `[{"date":"2021-04-24T00:00:00Z","amount":"-30.00","label":"Alimente","sender":"Alexandru","receiver":"Magazin","signature":"","flags":0,"headers":"","details":[{"label":"Alimente","amount":30.00,"flags":0,"headers":""}]}]`
+	if result, err := gojsonschema.Validate(schema, gojsonschema.NewStringLoader(decimal)); err != nil {
+		t.Fatal(err)
+	} else if !result.Valid() {
+		t.Fatalf("Expected decimals as amounts to be valid but got %v", result.Errors())
+	}
+
+	for _, payload := range invalid {
+		if result, err := gojsonschema.Validate(schema, gojsonschema.NewStringLoader(payload)); err != nil {
+			t.Fatal(err)
+		} else if result.Valid() {
+			t.Fatalf("Expected the payload to be invalid: %s", payload)
+		}
+	}
+
+	labels := gojsonschema.NewBytesLoader(JSONSchema(&Labels{}))
+	root := `[{"name":"Cheltuieli","parent":null,"flags":0,"headers":""},{"name":"Alimente","parent":"Cheltuieli","flags":0,"headers":""}]`
+	if result, err := gojsonschema.Validate(labels, gojsonschema.NewStringLoader(root)); err != nil {
+		t.Fatal(err)
+	} else if !result.Valid() {
+		t.Fatalf("Expected labels with a nullable parent to be valid but got %v", result.Errors())
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	// ErrNoLabels is returned when an amount is split across no labels
+	ErrNoLabels = errors.New("cannot split across no labels")
+
+	// ErrSplitPercent is returned when the percentages of a split don't
+	// add up to 100 or any of them is negative
+	ErrSplitPercent = errors.New("percentages must be positive and add up to 100")
+)
+
+// percentTolerance is how far from 100 the percentages of a split may add
+// up to, e.g. because of floating point errors
+const percentTolerance = 1e-6
+
+// SplitEvenly divides the absolute amount equally across the labels into
+// details which always add up to it. The remainder, if any, is distributed
+// one minor unit at a time starting with the first labels (e.g. 100 split
+// across three labels is 34, 33 and 33)
+func SplitEvenly(amount int64, labels []Label) ([]*Details, error) {
+	if len(labels) == 0 {
+		return nil, ErrNoLabels
+	}
+
+	total := abs(amount)
+	share, rest := total/int64(len(labels)), total%int64(len(labels))
+
+	details := make([]*Details, 0, len(labels))
+	for i, label := range labels {
+		label := label // each details must point to its own label
+		value := share
+		if int64(i) < rest {
+			value++
+		}
+		details = append(details, &Details{Label: &label, Amount: value})
+	}
+
+	return details, nil
+}
+
+// SplitPart is a label with its share (in percent) of a split amount
+type SplitPart struct {
+	Label   Label
+	Percent float64
+}
+
+// SplitByPercent divides the absolute amount across the parts by their
+// percentages (which must add up to 100) into details which always add up
+// to it. Each part is rounded down, so the rounding remainder goes to the
+// last part (e.g. 100 split 33.33/33.33/33.34 is 33, 33 and 34)
+func SplitByPercent(amount int64, parts []SplitPart) ([]*Details, error) {
+	if len(parts) == 0 {
+		return nil, ErrNoLabels
+	}
+
+	var sum float64
+	for _, part := range parts {
+		if part.Percent < 0 {
+			return nil, fmt.Errorf("%w, got %v for %s", ErrSplitPercent, part.Percent, part.Label.Name)
+		}
+		sum += part.Percent
+	}
+
+	if math.Abs(sum-100) > percentTolerance {
+		return nil, fmt.Errorf("%w, got %v", ErrSplitPercent, sum)
+	}
+
+	total, rest := abs(amount), abs(amount)
+	details := make([]*Details, 0, len(parts))
+	for i, part := range parts {
+		label := part.Label // each details must point to its own label
+		value := rest
+		if i < len(parts)-1 {
+			value = int64(math.Floor(float64(total)*part.Percent/100 + percentTolerance))
+		}
+		rest -= value
+		details = append(details, &Details{Label: &label, Amount: value})
+	}
+
+	return details, nil
+}
+
+// abs returns the absolute value of an amount
+func abs(amount int64) int64 {
+	if amount < 0 {
+		return -amount
+	}
+
+	return amount
+}
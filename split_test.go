@@ -0,0 +1,89 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// splitOf returns the amounts of details by label, in order
+func splitOf(details []*Details) string {
+	parts := make([]string, 0, len(details))
+	for _, d := range details {
+		parts = append(parts, fmt.Sprintf("%s=%d", d.Label.Name, d.Amount))
+	}
+
+	return fmt.Sprint(parts)
+}
+
+func TestSplitEvenly(t *testing.T) {
+	labels := []Label{NewLabel("Chirie", nil), NewLabel("Alimente", nil), NewLabel("Utilități", nil)}
+
+	details, err := SplitEvenly(-9000, labels)
+	if err != nil {
+		t.Fatal(err)
+	} else if got := splitOf(details); got != "[Chirie=3000 Alimente=3000 Utilități=3000]" {
+		t.Fatalf("Expected an even split but got %s instead", got)
+	}
+
+	details, err = SplitEvenly(100, labels)
+	if err != nil {
+		t.Fatal(err)
+	} else if got := splitOf(details); got != "[Chirie=34 Alimente=33 Utilități=33]" {
+		t.Fatalf("Expected the remainder to go to the first labels but got %s instead", got)
+	}
+
+	if _, err := SplitEvenly(100, nil); !errors.Is(err, ErrNoLabels) {
+		t.Fatalf("Expected split across no labels to fail but got %v", err)
+	}
+}
+
+func TestSplitByPercent(t *testing.T) {
+	details, err := SplitByPercent(-10000, []SplitPart{
+		{NewLabel("Alexandru", nil), 70},
+		{NewLabel("Ioana", nil), 30},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if got := splitOf(details); got != "[Alexandru=7000 Ioana=3000]" {
+		t.Fatalf("Expected a 70/30 split but got %s instead", got)
+	}
+
+	details, err = SplitByPercent(100, []SplitPart{
+		{NewLabel("Chirie", nil), 33.33},
+		{NewLabel("Alimente", nil), 33.33},
+		{NewLabel("Utilități", nil), 33.34},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if got := splitOf(details); got != "[Chirie=33 Alimente=33 Utilități=34]" {
+		t.Fatalf("Expected the remainder to go to the last part but got %s instead", got)
+	}
+
+	if _, err := SplitByPercent(100, []SplitPart{{NewLabel("Chirie", nil), 60}, {NewLabel("Alimente", nil), 30}}); !errors.Is(err, ErrSplitPercent) {
+		t.Fatalf("Expected split by 90 percent to fail but got %v", err)
+	}
+
+	if _, err := SplitByPercent(100, []SplitPart{{NewLabel("Chirie", nil), 120}, {NewLabel("Alimente", nil), -20}}); !errors.Is(err, ErrSplitPercent) {
+		t.Fatalf("Expected split by negative percent to fail but got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Status is the state of a transaction in the workflow of reconciliation
+// with a bank statement. New transactions are always pending
+type Status string
+
+const (
+	StatusPending    Status = "pending"    // not seen on a statement yet
+	StatusCleared    Status = "cleared"    // seen on a statement
+	StatusReconciled Status = "reconciled" // checked against a statement
+)
+
+// valid checks whether the status is any of the known ones
+func (s Status) valid() bool {
+	switch s {
+	case StatusPending, StatusCleared, StatusReconciled:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetStatus moves the transactions with the given UUIDs to a status of
+// reconciliation, with a single update. Every transaction updated makes a
+// new version of it (see Version). Unknown UUIDs are ignored, while pushing
+// a transaction again doesn't change its status
+func (t *Transactions) SetStatus(ctx PushContext, uuids []string, status Status) error {
+	if !status.valid() {
+		return fmt.Errorf("%w: %q", ErrInvalidStatus, status)
+	} else if len(uuids) == 0 {
+		return nil
+	}
+
+	db, err := withTableSuffix(ctx.Storage, ctx.TableSuffix)
+	if err != nil {
+		return err
+	}
+
+	return db.Model(&Transaction{}).Where("uuid IN ?", uuids).Updates(map[string]interface{}{
+		"status":  status,
+		"version": gorm.Expr("version + 1"),
+	}).Error
+}
+
+// statused narrows down transactions to the ones in any of the statuses
+func (ctx PullContext) statused(q *gorm.DB) *gorm.DB {
+	if len(ctx.Statuses) > 0 {
+		q = q.Where("status IN ?", ctx.Statuses)
+	}
+
+	return q
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func testStatus(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trxs := Transactions{
+		NewTransaction(date, -1000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""),
+		NewTransaction(date, -2000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""),
+		NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""),
+	}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	pull := func(statuses ...Status) string {
+		var pulled Transactions
+		if err := pulled.Pull(PullContext{Storage: db, Statuses: statuses}); err != nil {
+			t.Fatal(err)
+		}
+
+		var out []string
+		for _, trx := range pulled {
+			out = append(out, fmt.Sprintf("%d:%s", trx.Amount, trx.Status))
+		}
+		return fmt.Sprint(out)
+	}
+
+	if all := pull(); all != "[-1000:pending -2000:pending -3000:pending]" {
+		t.Fatalf("Expected new transactions to be pending but got %s", all)
+	}
+
+	if err := trxs.SetStatus(PushContext{Storage: db}, []string{*trxs[0].UUID, *trxs[1].UUID}, StatusCleared); err != nil {
+		t.Fatal(err)
+	} else if err := trxs.SetStatus(PushContext{Storage: db}, []string{*trxs[1].UUID}, StatusReconciled); err != nil {
+		t.Fatal(err)
+	}
+
+	if cleared := pull(StatusCleared); cleared != "[-1000:cleared]" {
+		t.Fatalf("Expected only the cleared transaction but got %s", cleared)
+	}
+
+	if settled := pull(StatusCleared, StatusReconciled); settled != "[-1000:cleared -2000:reconciled]" {
+		t.Fatalf("Expected the cleared and reconciled transactions but got %s", settled)
+	}
+
+	if err := trxs.SetStatus(PushContext{Storage: db}, []string{*trxs[2].UUID}, "lost"); !errors.Is(err, ErrInvalidStatus) {
+		t.Fatalf("Expected an invalid status to be rejected but got %v", err)
+	}
+
+	// pushing again keeps the status, as of the versions made by updates
+	if err := trxs.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	} else if settled := pull(StatusCleared, StatusReconciled); settled != "[-1000:cleared -2000:reconciled]" {
+		t.Fatalf("Expected statuses to be kept by a new push but got %s", settled)
+	}
+}
+
+func TestStatus_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testStatus(t, db)
+}
+
+func TestStatus_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testStatus(t, db)
+}
+
+func TestStatus_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testStatus(t, db)
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PullBatchSize is the number of transactions read at once by PullChan
+var PullBatchSize = 100
+
+// PullChan reads transactions just like Pull does, except they're read in
+// batches of PullBatchSize and sent one by one on the returned channel, for
+// pipelines. Limit (if set) caps the whole stream rather than each batch.
+// Both channels are closed once done, and the first error, if any, is sent
+// on the errors channel before that. The caller must either drain the
+// transactions channel or cancel the context of Storage (see
+// gorm.DB.WithContext) to let the reading finish
+func (t *Transactions) PullChan(ctx PullContext) (<-chan Transaction, <-chan error) {
+	out, errs := make(chan Transaction), make(chan error, 1)
+
+	done := context.Background()
+	if ctx.Storage != nil && ctx.Storage.Statement.Context != nil {
+		done = ctx.Storage.Statement.Context
+	}
+
+	go func() {
+		defer close(errs)
+		defer close(out)
+
+		for sent := 0; ctx.Limit == 0 || sent < ctx.Limit; {
+			batch := ctx
+			batch.Offset = ctx.Offset + sent
+			batch.Limit = PullBatchSize
+			if ctx.Limit > 0 && ctx.Limit-sent < PullBatchSize {
+				batch.Limit = ctx.Limit - sent
+			}
+
+			var trxs Transactions
+			if err := trxs.Pull(batch); err != nil {
+				errs <- err
+				return
+			}
+
+			for _, trx := range trxs {
+				select {
+				case out <- trx:
+				case <-done.Done():
+					errs <- done.Err()
+					return
+				}
+			}
+			sent += len(trxs)
+
+			if len(trxs) < batch.Limit {
+				return
+			}
+		}
+	}()
+
+	return out, errs
+}
+
+// ToNDJSON serializes transactions as newline-delimited JSON, i.e. one JSON
+// object per line instead of an array, for log-style ingestion
+func ToNDJSON(trxs Transactions, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for i := range trxs {
+		if err := enc.Encode(&trxs[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FromNDJSON is the inverse of ToNDJSON, which appends each transaction
+// read from the lines of a reader to the collection. Blank lines are
+// skipped, while a malformed one fails with its line number
+func FromNDJSON(r io.Reader, into *Transactions) error {
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var trx Transaction
+			if err := FromJson(trimmed, &trx); err != nil {
+				return fmt.Errorf("line %d: %w", n, err)
+			}
+			*into = append(*into, trx)
+		}
+
+		if err != nil { // i.e. io.EOF
+			return nil
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testPullChan(t *testing.T, db *gorm.DB) {
+	defer func(size int) { PullBatchSize = size }(PullBatchSize)
+	PullBatchSize = 4
+
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	var trxs Transactions
+	for i := 0; i < 10; i++ {
+		trxs = append(trxs, NewTransaction(date.AddDate(0, 0, i), int64(-100*(i+1)), NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""))
+	}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	for limit, expected := range map[int]int{0: 10, 6: 6, 8: 8} {
+		out, errs := (&Transactions{}).PullChan(PullContext{Storage: db, Limit: limit})
+
+		received := 0
+		last := date.AddDate(1, 0, 0)
+		for trx := range out {
+			if !trx.Date.Before(last) {
+				t.Fatalf("Expected transactions in descending order of dates, got %s after %s", trx.Date.Format(DateFormat), last.Format(DateFormat))
+			}
+			last = trx.Date
+			received++
+		}
+
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		} else if received != expected {
+			t.Fatalf("Expected %d transactions with limit %d, got %d", expected, limit, received)
+		}
+	}
+
+	// transactions of the same date and amount are neither repeated nor
+	// skipped across batches
+	var ties Transactions
+	for i := 0; i < 10; i++ {
+		ties = append(ties, NewTransaction(date, -1, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, ""))
+	}
+	if err := ties.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	out, errs := (&Transactions{}).PullChan(PullContext{Storage: db})
+	for trx := range out {
+		seen[*trx.UUID] = true
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	} else if len(seen) != 20 {
+		t.Fatalf("Expected 20 distinct transactions, got %d", len(seen))
+	}
+
+	// a consumer which stops reading cancels the context instead
+	c, cancel := context.WithCancel(context.Background())
+	out, errs = (&Transactions{}).PullChan(PullContext{Storage: db.WithContext(c)})
+	<-out
+	cancel()
+
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the stream to be canceled, got %v", err)
+	}
+}
+
+func testPullChanError(t *testing.T, db *gorm.DB) {
+	if err := db.Migrator().DropTable(&Details{}, &Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+	defer Install(db)
+
+	out, errs := (&Transactions{}).PullChan(PullContext{Storage: db})
+	for range out {
+		t.Fatal("Expected no transactions without a table")
+	}
+
+	if err := <-errs; err == nil {
+		t.Fatal("Expected an error on the errors channel")
+	}
+}
+
+func TestNDJSON_Json(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trxs := Transactions{
+		NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"),
+			map[Label]int64{NewLabel("Pâine", nil): 1000, NewLabel("Apă", nil): 2000}, ""),
+		NewTransaction(date.AddDate(0, 0, 1), -1500, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"), nil, ""),
+		NewTransaction(date.AddDate(0, 0, 2), 10000, NewLabel("Salariu", nil), NewActor("Angajator"), NewActor("Alexandru"), nil, ""),
+	}
+	for i := range trxs {
+		trxs[i].LabelName, trxs[i].SenderName, trxs[i].ReceiverName = trxs[i].Label.Name, trxs[i].Sender.Name, trxs[i].Receiver.Name
+	}
+
+	var buf bytes.Buffer
+	if err := ToNDJSON(trxs, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"); len(lines) != len(trxs) {
+		t.Fatalf("Expected one line per transaction, got %q", buf.String())
+	}
+
+	var back Transactions
+	if err := FromNDJSON(strings.NewReader(buf.String()+"\n"), &back); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, _ := ToJson(&trxs)
+	if got, _ := ToJson(&back); string(got) != string(expected) {
+		t.Fatalf("Expected transactions %s after round-trip, got %s", expected, got)
+	}
+
+	malformed := strings.NewReader(buf.String() + `{"amount": "x"}` + "\n")
+	if err := FromNDJSON(malformed, &back); !errors.Is(err, ErrInvalidAmount) || !strings.Contains(err.Error(), "line 4") {
+		t.Fatalf("Expected malformed line 4 to fail with ErrInvalidAmount, got %v", err)
+	}
+}
+
+func TestPullChan_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testPullChan(t, db)
+}
+
+func TestPullChanError_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testPullChanError(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestPullChan_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testPullChan(t, db)
+}
+
+func TestPullChanError_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testPullChanError(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestPullChan_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testPullChan(t, db)
+}
+
+func TestPullChanError_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testPullChanError(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
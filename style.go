@@ -0,0 +1,266 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// KeyStyle is the naming style of JSON keys. The keys are tagged in snake
+// case (e.g. created_at), while other styles are converted from it
+type KeyStyle int
+
+const (
+	SnakeCase KeyStyle = iota // e.g. created_at, which is the default
+	CamelCase                 // e.g. createdAt, mostly for frontends
+)
+
+// ToJsonStyle works just like ToJson except the keys are written in the
+// given naming style
+func ToJsonStyle(src interface{}, style KeyStyle) ([]byte, error) {
+	out, err := ToJson(src)
+	if err != nil || style == SnakeCase {
+		return out, err
+	}
+
+	return restyle(out, camelCase)
+}
+
+// FromJsonStyle works just like FromJson except it accepts keys in any of
+// the naming styles (e.g. both createdAt and created_at)
+func FromJsonStyle(src []byte, into interface{}) error {
+	normalized, err := restyle(src, snakeCase)
+	if err != nil {
+		return amountError(err)
+	}
+
+	return FromJson(normalized, into)
+}
+
+// ToJsonCompact works just like ToJson except the keys without a value,
+// i.e. null or an empty array or object (e.g. the details of a transaction
+// which isn't itemized), are left out for smaller payloads. The meta of
+// transactions is owned by the user, so it's written as it is
+func ToJsonCompact(src interface{}) ([]byte, error) {
+	out, err := ToJson(src)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.UseNumber()
+
+	var compact bytes.Buffer
+	if _, err := compactValue(dec, &compact, false); err != nil {
+		return nil, err
+	}
+
+	return compact.Bytes(), nil
+}
+
+// compactValue copies the next value of a JSON payload without the keys
+// which have no value, while keeping the order of keys. It reports whether
+// the value itself is empty, so the key holding it can be left out as well.
+// A raw value (see rawKeys) is copied as it is, unless it's null
+func compactValue(dec *json.Decoder, out *bytes.Buffer, raw bool) (empty bool, err error) {
+	if raw {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return false, err
+		}
+
+		return string(value) == "null", json.Compact(out, value)
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return false, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		b, err := json.Marshal(tok)
+		out.Write(b)
+		return tok == nil, err
+	}
+
+	out.WriteRune(rune(delim))
+	n := 0
+	for dec.More() {
+		raw := false
+		var value bytes.Buffer
+		if delim == '{' {
+			key, err := dec.Token()
+			if err != nil {
+				return false, err
+			}
+			b, _ := json.Marshal(key)
+			value.Write(b)
+			value.WriteByte(':')
+			raw = rawKeys[key.(string)]
+		}
+
+		if empty, err := compactValue(dec, &value, raw); err != nil {
+			return false, err
+		} else if empty && delim == '{' {
+			continue
+		}
+
+		if n > 0 {
+			out.WriteByte(',')
+		}
+		out.Write(value.Bytes())
+		n++
+	}
+
+	closing, err := dec.Token()
+	if err != nil {
+		return false, err
+	}
+	out.WriteRune(rune(closing.(json.Delim)))
+
+	return n == 0, nil
+}
+
+// camelCase converts a key from snake case (e.g. created_at → createdAt)
+func camelCase(key string) string {
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+
+	return strings.Join(parts, "")
+}
+
+// snakeCase converts a key to snake case (e.g. createdAt → created_at)
+func snakeCase(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// rawKeys are the keys of values which are raw JSON owned by the user
+// (e.g. the meta of a transaction), so they're written exactly as they are
+var rawKeys = map[string]bool{"meta": true, "result": true}
+
+// restyle rewrites every key of a JSON payload with the given function,
+// while keeping the order of keys and the values as they are. The values
+// of raw keys are left untouched, keys included (see rawKeys)
+func restyle(src []byte, key func(string) string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+
+	type container struct {
+		object bool
+		n      int // tokens written so far, keys and values alike
+	}
+
+	var out bytes.Buffer
+	var stack []container
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			out.WriteRune(rune(delim))
+			if len(stack) > 0 {
+				stack[len(stack)-1].n++
+			}
+			continue
+		}
+
+		isKey := false
+		if len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			switch {
+			case top.object && top.n%2 == 1:
+				out.WriteByte(':')
+			case top.n > 0:
+				out.WriteByte(',')
+				isKey = top.object
+			default:
+				isKey = top.object
+			}
+		}
+
+		switch v := tok.(type) {
+		case json.Delim:
+			out.WriteRune(rune(v))
+			stack = append(stack, container{object: v == '{'})
+			continue
+		case string:
+			if isKey && rawKeys[key(v)] {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return nil, err
+				}
+
+				b, _ := json.Marshal(key(v))
+				out.Write(b)
+				out.WriteByte(':')
+				if err := json.Compact(&out, raw); err != nil {
+					return nil, err
+				}
+
+				stack[len(stack)-1].n += 2
+				continue
+			} else if isKey {
+				v = key(v)
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(b)
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(b)
+		}
+
+		if len(stack) > 0 {
+			stack[len(stack)-1].n++
+		}
+	}
+
+	return out.Bytes(), nil
+}
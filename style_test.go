@@ -0,0 +1,142 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyStyle_Json(t *testing.T) {
+	issues := []IntegrityIssue{{UUID: "00000000-0000-0000-0000-000000000001", Amount: -3000, DetailsSum: 3999}}
+
+	out, err := ToJsonStyle(issues, CamelCase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedJson := `[{"uuid":"00000000-0000-0000-0000-000000000001","amount":-3000,"detailsSum":3999}]`
+	if string(out) != expectedJson {
+		t.Fatalf("Expected camel case JSON %s but got %s instead", expectedJson, out)
+	}
+
+	var back []IntegrityIssue
+	if err := FromJsonStyle(out, &back); err != nil {
+		t.Fatal(err)
+	} else if len(back) != 1 || back[0] != issues[0] {
+		t.Fatalf("Expected round-trip of %v but got %v instead", issues, back)
+	}
+
+	// snake case is accepted as well
+	if err := FromJsonStyle([]byte(`[{"uuid":"?","amount":-1,"details_sum":2}]`), &back); err != nil {
+		t.Fatal(err)
+	} else if back[0].DetailsSum != 2 {
+		t.Fatalf("Expected snake case keys to be accepted, got %v", back)
+	}
+}
+
+func TestKeyStyleTransactions_Json(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-04-24")
+	trxs := Transactions{NewTransaction(date, -100, NewLabel("?", nil), NewActor("?"), NewActor("?"),
+		map[Label]int64{NewLabel("?", nil): 100}, "?")}
+
+	snake, err := ToJson(&trxs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	camel, err := ToJsonStyle(&trxs, CamelCase)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(camel) != string(snake) {
+		t.Fatalf("Expected single word keys to be the same in camel case, got %s and %s", camel, snake)
+	}
+
+	var back Transactions
+	if err := FromJsonStyle(camel, &back); err != nil {
+		t.Fatal(err)
+	} else if len(back) != 1 || back[0].Amount != -100 || len(back[0].Details) != 1 {
+		t.Fatalf("Expected round-trip of transactions, got %v", back)
+	}
+}
+
+func TestKeyStyleMeta_Json(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-04-24")
+	trx := NewTransaction(date, -100, NewLabel("?", nil), NewActor("?"), NewActor("?"), nil, "?")
+	trx.Meta = []byte(`{"external_id":"a-1","sourceSystem":{"batch_no":7}}`)
+	trxs := Transactions{trx}
+
+	// the meta of transactions is owned by the user, so it's never restyled
+	camel, err := ToJsonStyle(&trxs, CamelCase)
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(camel), `"meta":{"external_id":"a-1","sourceSystem":{"batch_no":7}}`) {
+		t.Fatalf("Expected meta to be written as it is, got %s", camel)
+	}
+
+	var back Transactions
+	if err := FromJsonStyle(camel, &back); err != nil {
+		t.Fatal(err)
+	} else if string(back[0].Meta) != string(trx.Meta) {
+		t.Fatalf("Expected meta to be read as it is, got %s", back[0].Meta)
+	}
+}
+
+func TestCompact_Json(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	trxs := Transactions{
+		NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"),
+			map[Label]int64{NewLabel("Pâine", nil): 3000}, ""),
+		NewTransaction(date, -1500, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"), nil, ""),
+	}
+
+	out, err := ToJson(&trxs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := ToJsonCompact(&trxs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(out), `"details":null`) {
+		t.Fatalf("Expected default JSON to keep empty details, got %s", out)
+	} else if strings.Contains(string(compact), `"details":null`) {
+		t.Fatalf("Expected compact JSON to omit empty details, got %s", compact)
+	} else if strings.Count(string(compact), `"details":[`) != 1 {
+		t.Fatalf("Expected compact JSON to keep the details of the itemized transaction, got %s", compact)
+	}
+
+	trxs[1].Meta = []byte(`{"empty":{},"none":null}`)
+	if compact, err := ToJsonCompact(&trxs); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(compact), `"meta":{"empty":{},"none":null}`) {
+		t.Fatalf("Expected compact JSON to keep meta as it is, got %s", compact)
+	}
+
+	var back Transactions
+	if err := FromJson(compact, &back); err != nil {
+		t.Fatal(err)
+	}
+	if len(back) != 2 || len(back[0].Details) != 1 || back[1].Details != nil || back[1].Amount != -1500 {
+		t.Fatalf("Expected compact JSON to deserialize back, got %v", back)
+	}
+}
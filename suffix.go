@@ -0,0 +1,112 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// suffixed caches the database handles used for suffixed transactions
+// tables, since each of them has its own cache of parsed models
+var suffixed sync.Map
+
+// suffixKey identifies a suffixed handle by the underlying connections
+// and the (possibly prefixed) table name of transactions
+type suffixKey struct {
+	conn  gorm.ConnPool
+	table string
+}
+
+// suffixNamer names the transactions and the details tables with a suffix
+// (e.g. transactions_2021) and leaves any other name to the wrapped namer
+type suffixNamer struct {
+	schema.Namer
+	suffix string
+}
+
+// TableName appends the suffix to the tables of transactions and details
+func (n suffixNamer) TableName(table string) string {
+	name := n.Namer.TableName(table)
+	if table == "Transaction" || table == "Details" {
+		name += n.suffix
+	}
+
+	return name
+}
+
+// InstallWithSuffix is a helper function to create and migrate a suffixed
+// set of transactions and details tables, e.g. one per year for archival.
+// The actors and labels tables are shared, so they're migrated as usual
+func InstallWithSuffix(db *gorm.DB, suffix string) error {
+	tx, err := withTableSuffix(db, suffix)
+	if err != nil {
+		return err
+	}
+
+	return Install(tx)
+}
+
+// UninstallWithSuffix is a helper function to delete a suffixed set of
+// transactions and details tables, leaving the shared tables untouched
+func UninstallWithSuffix(db *gorm.DB, suffix string) error {
+	tx, err := withTableSuffix(db, suffix)
+	if err != nil {
+		return err
+	}
+
+	return tx.Migrator().DropTable(&Details{}, &Transaction{})
+}
+
+// withTableSuffix returns a session of db where the transactions and the
+// details tables have the given suffix. The session keeps the logger, the
+// context and the connection (e.g. a database transaction) of db
+func withTableSuffix(db *gorm.DB, suffix string) (*gorm.DB, error) {
+	if suffix == "" {
+		return db, nil
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	key := suffixKey{sqlDB, db.NamingStrategy.TableName("Transaction") + suffix}
+	v, ok := suffixed.Load(key)
+	if !ok {
+		tx, err := reopen(db, suffixNamer{db.NamingStrategy, suffix})
+		if err != nil {
+			return nil, err
+		}
+		v, _ = suffixed.LoadOrStore(key, tx)
+	}
+
+	tx := v.(*gorm.DB).Session(&gorm.Session{
+		NewDB:   true,
+		DryRun:  db.DryRun,
+		Logger:  db.Logger,
+		Context: db.Statement.Context,
+	})
+	tx.Statement.ConnPool = db.Statement.ConnPool
+
+	return tx, nil
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func testTableSuffix(t *testing.T, db *gorm.DB) {
+	years := map[string]string{"_2021": "2021-05-01", "_2022": "2022-05-01"}
+
+	for suffix, day := range years {
+		if err := InstallWithSuffix(db, suffix); err != nil {
+			t.Fatal(err)
+		}
+		defer UninstallWithSuffix(db, suffix)
+
+		date, _ := time.Parse("2006-01-02", day)
+		ls := map[Label]int64{NewLabel("Pâine", nil): 3000}
+		trx := Transactions{NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), ls, "")}
+		if err := trx.Push(PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true, TableSuffix: suffix}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for suffix, day := range years {
+		if !db.Migrator().HasTable("transactions"+suffix) || !db.Migrator().HasTable("details"+suffix) {
+			t.Fatalf("Expected suffixed tables for %s", suffix)
+		}
+
+		var got Transactions
+		if err := got.Pull(PullContext{Storage: db, TableSuffix: suffix}); err != nil {
+			t.Fatal(err)
+		} else if len(got) != 1 || len(got[0].Details) != 1 {
+			t.Fatalf("Expected one transaction with one detail in %s, got %v", suffix, got)
+		} else if date := got[0].Date.Format("2006-01-02"); date != day {
+			t.Fatalf("Expected transaction of %s in %s, got %s", day, suffix, date)
+		}
+
+		ctx := PullContext{Storage: db, TableSuffix: suffix}
+		if used, err := got.UsedLabels(ctx); err != nil {
+			t.Fatal(err)
+		} else if fmt.Sprint(used) != "[Alimente Pâine]" {
+			t.Fatalf("Expected the labels used in %s, got %v", suffix, used)
+		}
+
+		if totals, err := got.SumByDetailLabel(ctx); err != nil {
+			t.Fatal(err)
+		} else if len(totals) != 1 || totals[0].Amount != 3000 {
+			t.Fatalf("Expected the details of %s to be summed, got %v", suffix, totals)
+		}
+
+		if ok, err := got.Exists(ctx, *got[0].UUID); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatalf("Expected the transaction to exist in %s", suffix)
+		}
+
+		details := []*Details{{LabelName: "Pâine", Amount: 1000}, {LabelName: "Lapte", Amount: 2000}}
+		pushctx := PushContext{Storage: db, BatchSize: 10, AutoCreateLabels: true, TableSuffix: suffix}
+		if err := got.ReplaceDetails(pushctx, *got[0].UUID, details); err != nil {
+			t.Fatal(err)
+		} else if replaced, err := got.Get(ctx, *got[0].UUID); err != nil {
+			t.Fatal(err)
+		} else if len(replaced.Details) != 2 {
+			t.Fatalf("Expected the details to be replaced in %s, got %v", suffix, replaced.Details)
+		}
+	}
+
+	var shared Transactions
+	if err := shared.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(shared) != 0 {
+		t.Fatalf("Expected no transactions in unsuffixed tables, got %v", shared)
+	}
+}
+
+func TestTableSuffix_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testTableSuffix(t, db)
+}
+
+func TestTableSuffix_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testTableSuffix(t, db)
+}
+
+func TestTableSuffix_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testTableSuffix(t, db)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tag is a free-form classification of transactions (e.g. "business" or
+// "reimbursable"). Unlike labels, a transaction can have any number of tags
+// and tags have no hierarchy
+type Tag struct {
+	Name      string    `json:"name" gorm:"type: varchar(100); primaryKey"`
+	CreatedAt time.Time `json:"-" gorm:"autoCreateTime"`
+}
+
+// TransactionTag joins transactions and their tags
+type TransactionTag struct {
+	TransactionUUID string `gorm:"type: varchar(36); primaryKey"`
+	TagName         string `gorm:"type: varchar(100); primaryKey; index"`
+}
+
+// AfterCreate hook from GORM to create the tags of the transaction (if any)
+// and to join them, within the same database transaction. Tags are only
+// ever added, so pushing a transaction again doesn't remove any of them
+func (t *Transaction) AfterCreate(tx *gorm.DB) (err error) {
+	if len(t.Tags) == 0 {
+		return nil
+	}
+
+	tags := make([]Tag, 0, len(t.Tags))
+	joins := make([]TransactionTag, 0, len(t.Tags))
+	for _, name := range t.Tags {
+		if name == "" {
+			return fmt.Errorf("tag %w", ErrEmptyName)
+		}
+		tags = append(tags, Tag{Name: name})
+		joins = append(joins, TransactionTag{TransactionUUID: *t.UUID, TagName: name})
+	}
+
+	appendOnly := func() *gorm.DB {
+		return tx.Session(&gorm.Session{NewDB: true}).Clauses(clause.OnConflict{DoNothing: true})
+	}
+
+	if err := appendOnly().Create(&tags).Error; err != nil {
+		return err
+	}
+
+	return appendOnly().Create(&joins).Error
+}
+
+// tagged narrows down transactions to the ones having all the tags
+func (ctx PullContext) tagged(q *gorm.DB) *gorm.DB {
+	if len(ctx.HasTags) == 0 {
+		return q
+	}
+
+	distinct := make(map[string]bool, len(ctx.HasTags))
+	for _, name := range ctx.HasTags {
+		distinct[name] = true
+	}
+
+	uuids := q.Session(&gorm.Session{NewDB: true}).Model(&TransactionTag{}).
+		Select("transaction_uuid").Where("tag_name IN ?", ctx.HasTags).
+		Group("transaction_uuid").Having("COUNT(*) = ?", len(distinct))
+
+	return q.Where("uuid IN (?)", uuids)
+}
+
+// tagsOf reads the tags of the given transactions with a single query, in
+// alphabetical order
+func tagsOf(db *gorm.DB, trxs Transactions) error {
+	if len(trxs) == 0 {
+		return nil
+	}
+
+	index := make(map[string]*Transaction, len(trxs))
+	uuids := make([]string, 0, len(trxs))
+	for i := range trxs {
+		if trxs[i].UUID != nil {
+			index[*trxs[i].UUID] = &trxs[i]
+			uuids = append(uuids, *trxs[i].UUID)
+		}
+	}
+
+	var joins []TransactionTag
+	err := db.Session(&gorm.Session{NewDB: true}).Where("transaction_uuid IN ?", uuids).Order("tag_name").Find(&joins).Error
+	if err != nil {
+		return err
+	}
+
+	for _, join := range joins {
+		trx := index[join.TransactionUUID]
+		trx.Tags = append(trx.Tags, join.TagName)
+	}
+
+	return nil
+}
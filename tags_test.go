@@ -0,0 +1,104 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func testTags(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	tagged := func(amount int64, tags ...string) Transaction {
+		trx := NewTransaction(date, amount, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"), nil, "")
+		trx.Tags = tags
+		return trx
+	}
+
+	trxs := Transactions{
+		tagged(-1000, "business", "reimbursable"),
+		tagged(-2000, "business"),
+		tagged(-3000, "reimbursable", "travel"),
+		tagged(-4000),
+	}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	pull := func(tags ...string) string {
+		var pulled Transactions
+		if err := pulled.Pull(PullContext{Storage: db, HasTags: tags}); err != nil {
+			t.Fatal(err)
+		}
+
+		var out []string
+		for _, trx := range pulled {
+			out = append(out, fmt.Sprintf("%d%v", trx.Amount, trx.Tags))
+		}
+		return fmt.Sprint(out)
+	}
+
+	if all := pull(); all != "[-1000[business reimbursable] -2000[business] -3000[reimbursable travel] -4000[]]" {
+		t.Fatalf("Expected every transaction with its tags but got %s", all)
+	}
+
+	if business := pull("business"); business != "[-1000[business reimbursable] -2000[business]]" {
+		t.Fatalf("Expected the business transactions but got %s", business)
+	}
+
+	if both := pull("business", "reimbursable"); both != "[-1000[business reimbursable]]" {
+		t.Fatalf("Expected the intersection of tags but got %s", both)
+	}
+
+	if none := pull("business", "travel"); none != "[]" {
+		t.Fatalf("Expected no transaction with both tags but got %s", none)
+	}
+
+	var tags []Tag
+	if err := db.Order("name").Find(&tags).Error; err != nil {
+		t.Fatal(err)
+	} else if len(tags) != 3 {
+		t.Fatalf("Expected 3 distinct tags but got %v", tags)
+	}
+}
+
+func TestTags_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testTags(t, db)
+}
+
+func TestTags_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testTags(t, db)
+}
+
+func TestTags_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testTags(t, db)
+}
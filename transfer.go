@@ -0,0 +1,97 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Transfer copies the whole registry from src to dst (e.g. backup, restore
+// or moving from SQLite to MySQL), in batches of batchSize records. Actors
+// go first, then labels (along with their parents) and then transactions
+// with their details and attachments, each entity type within a single
+// database transaction. Records are appended as they are (see
+// PushContext.JustAppend), so the UUIDs are kept and records already in dst
+// are left untouched. Both databases must be installed already (see Install)
+func Transfer(src, dst *gorm.DB, batchSize int) error {
+	if err := dst.Transaction(func(tx *gorm.DB) error {
+		return transferPages(src, tx, batchSize, func() Registry { return &Actors{} })
+	}); err != nil {
+		return err
+	}
+
+	if err := dst.Transaction(func(tx *gorm.DB) error {
+		return transferPages(src, tx, batchSize, func() Registry { return &Labels{} })
+	}); err != nil {
+		return err
+	}
+
+	return dst.Transaction(func(tx *gorm.DB) error {
+		for offset := 0; ; offset += batchSize {
+			// transactions are paged by their UUID, since the order of Pull
+			// isn't stable across pages for transactions of the same date
+			var uuids []string
+			q := src.Model(&Transaction{}).Order("uuid").Limit(batchSize).Offset(offset)
+			if err := q.Pluck("uuid", &uuids).Error; err != nil {
+				return err
+			} else if len(uuids) == 0 {
+				return nil
+			}
+
+			var trxs Transactions
+			if err := trxs.PullByUUIDs(PullContext{Storage: src}, uuids); err != nil {
+				return err
+			}
+
+			if err := trxs.Push(PushContext{Storage: tx, BatchSize: batchSize, JustAppend: true}); err != nil {
+				return err
+			}
+
+			var attachments Attachments
+			if err := src.Where("transaction_uuid IN ?", uuids).Order("uuid").Find(&attachments).Error; err != nil {
+				return err
+			} else if len(attachments) == 0 {
+				continue
+			}
+
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&attachments, batchSize).Error; err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// transferPages copies actors or labels (sorted by their unique name, so the
+// pages are stable) from src to dst
+func transferPages(src, dst *gorm.DB, batchSize int, newRegistry func() Registry) error {
+	for offset := 0; ; offset += batchSize {
+		reg := newRegistry()
+		if err := reg.Pull(PullContext{Storage: src, Limit: batchSize, Offset: offset}); err != nil {
+			return err
+		} else if count(reg) == 0 {
+			return nil
+		}
+
+		if err := reg.Push(PushContext{Storage: dst, BatchSize: batchSize, JustAppend: true}); err != nil {
+			return err
+		}
+	}
+}
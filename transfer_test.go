@@ -0,0 +1,99 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func testTransfer(t *testing.T, src *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+	parent := NewLabel("Cheltuieli", nil)
+	food := NewLabel("Alimente", &parent)
+	trxs := Transactions{
+		NewTransaction(date, -3000, food, NewActor("Alexandru"), NewActor("Magazin"),
+			map[Label]int64{NewLabel("Pâine", &food): 1000, NewLabel("Lapte", &food): 2000}, ""),
+		NewTransaction(date, -3000, food, NewActor("Alexandru"), NewActor("Piață"), nil, ""),
+		NewTransaction(date.AddDate(0, 0, 1), 10000, NewLabel("Salariu", nil), NewActor("Angajator"), NewActor("Alexandru"), nil, ""),
+	}
+	if err := trxs.Push(PushContext{Storage: src, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	receipt := Attachments{{Filename: "bon.jpg", Mime: "image/jpeg", Data: []byte{0xff, 0xd8}}}
+	if err := receipt.Attach(PushContext{Storage: src, BatchSize: 10}, *trxs[0].UUID); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := begin(sqlite.Open("file:transfer?mode=memory&cache=shared"))
+	defer end(dst)
+
+	if err := Transfer(src, dst, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, model := range []interface{}{&Actor{}, &Label{}, &Transaction{}, &Details{}, &Attachment{}} {
+		var want, got int64
+		if err := src.Model(model).Count(&want).Error; err != nil {
+			t.Fatal(err)
+		} else if err := dst.Model(model).Count(&got).Error; err != nil {
+			t.Fatal(err)
+		} else if want != got {
+			t.Fatalf("Expected %d records of %T but got %d instead", want, model, got)
+		}
+	}
+
+	var labels Labels
+	if err := labels.Pull(PullContext{Storage: dst}); err != nil {
+		t.Fatal(err)
+	}
+	for _, lb := range labels {
+		if lb.Name == "Pâine" && (lb.Parent == nil || lb.Parent.Name != "Alimente") {
+			t.Fatalf("Expected the parent of %s to be kept but got %v", lb.Name, lb.Parent)
+		}
+	}
+
+	var want, got Transactions
+	if err := want.Pull(PullContext{Storage: src}); err != nil {
+		t.Fatal(err)
+	} else if err := got.Pull(PullContext{Storage: dst}); err != nil {
+		t.Fatal(err)
+	}
+	details := make(map[string]int, len(got))
+	for _, trx := range got {
+		details[*trx.UUID] = len(trx.Details)
+	}
+	for _, trx := range want {
+		if n, ok := details[*trx.UUID]; !ok || n != len(trx.Details) {
+			t.Fatalf("Expected transaction %v with %d details but got %d instead", *trx.UUID, len(trx.Details), n)
+		}
+	}
+}
+
+func TestTransfer_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testTransfer(t, db)
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LabelNode is a label with its children in the hierarchy of labels
+type LabelNode struct {
+	Label
+	Children []*LabelNode `json:"children"`
+}
+
+// Tree pulls every label and returns the whole hierarchy as a forest, with
+// roots and children ordered by name. Labels with a missing parent are kept
+// as roots, while labels caught in a cycle make it fail with ErrLabelCycle
+func (l *Labels) Tree(ctx PullContext) ([]*LabelNode, error) {
+	ctx.Limit, ctx.Offset = 0, 0
+	if err := l.Pull(ctx); err != nil {
+		return nil, err
+	}
+
+	return treeOf(*l)
+}
+
+// treeOf assembles the parent/child links of labels in memory
+func treeOf(labels Labels) ([]*LabelNode, error) {
+	nodes := make(map[string]*LabelNode, len(labels))
+	for _, lb := range labels {
+		lb.Parent = nil // the links are between nodes instead
+		nodes[lb.Name] = &LabelNode{Label: lb}
+	}
+
+	var roots []*LabelNode
+	for _, lb := range labels {
+		node := nodes[lb.Name]
+		if parent, ok := nodes[lb.ParentName.String]; lb.ParentName.Valid && ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	// labels caught in a cycle can't be reached from any root
+	reached := make(map[string]bool, len(nodes))
+	var walk func([]*LabelNode)
+	walk = func(level []*LabelNode) {
+		sort.Slice(level, func(i, j int) bool { return level[i].Name < level[j].Name })
+		for _, node := range level {
+			reached[node.Name] = true
+			walk(node.Children)
+		}
+	}
+	walk(roots)
+
+	var cycle []string
+	for _, lb := range labels {
+		if !reached[lb.Name] {
+			cycle = append(cycle, lb.Name)
+		}
+	}
+
+	if len(cycle) > 0 {
+		return nil, fmt.Errorf("labels %v: %w", cycle, ErrLabelCycle)
+	}
+
+	return roots, nil
+}
+
+// CheckTreeIntegrity returns the names of labels whose parent isn't in the
+// registry (e.g. after partial imports or manual deletes), sorted by name.
+// Such labels are dangling, since the tree of labels is no longer connected
+func (l *Labels) CheckTreeIntegrity(ctx PullContext) ([]string, error) {
+	var names []string
+	err := dangling(ctx.reader()).Pluck("name", &names).Error
+
+	return names, err
+}
+
+// RepairDanglingParents attaches the dangling labels (see CheckTreeIntegrity)
+// to the fallback root, or makes them roots when there's no fallback, in a
+// single database transaction. If the fallback isn't in the registry,
+// ErrNotFound is returned instead. Upon success it returns the number of
+// labels repaired
+func (l *Labels) RepairDanglingParents(ctx PushContext, fallbackRoot string) (int64, error) {
+	parent := NullString{sql.NullString{String: fallbackRoot, Valid: fallbackRoot != ""}}
+
+	var repaired int64
+	err := ctx.Storage.Transaction(func(tx *gorm.DB) error {
+		if parent.Valid {
+			if err := tx.Where("name = ?", fallbackRoot).First(&Label{}).Error; err != nil {
+				return notFound(err, "label", fallbackRoot)
+			}
+		}
+
+		var names []string
+		if err := dangling(tx).Pluck("name", &names).Error; err != nil {
+			return err
+		} else if len(names) == 0 {
+			return nil
+		}
+
+		q := tx.Model(&Label{}).Where("name IN ?", names).Update("parent_name", parent)
+		repaired = q.RowsAffected
+
+		return q.Error
+	})
+
+	return repaired, err
+}
+
+// Merge reclassifies everything labelled with any of the dropped labels as
+// the kept one, in a single database transaction: transactions and details
+// are relabelled, the children of dropped labels are attached to the kept
+// one and then the dropped labels are deleted. If the kept label was itself
+// under a dropped one, it takes the place of its closest ancestor which is
+// not dropped. If any of these labels isn't in the registry, ErrNotFound is
+// returned instead
+func (l *Labels) Merge(ctx PushContext, keep string, drop ...string) error {
+	dropped := make(map[string]bool, len(drop))
+	var names []string
+	for _, name := range drop {
+		if name != keep && !dropped[name] {
+			dropped[name] = true
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	db, err := withTableSuffix(ctx.Storage, ctx.TableSuffix)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		labels := make(map[string]Label, len(names)+1)
+		for _, name := range append([]string{keep}, names...) {
+			var lb Label
+			if err := tx.Where("name = ?", name).First(&lb).Error; err != nil {
+				return notFound(err, "label", name)
+			}
+			labels[name] = lb
+		}
+
+		parent := labels[keep].ParentName
+		for seen := 0; parent.Valid && dropped[parent.String] && seen < len(names); seen++ {
+			parent = labels[parent.String].ParentName
+		}
+		if parent.Valid && dropped[parent.String] {
+			return fmt.Errorf("labels %v: %w", names, ErrLabelCycle)
+		}
+
+		if err := tx.Model(&Label{}).Where("name = ?", keep).Update("parent_name", parent).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(&Transaction{}).Where("label_name IN ?", names).Updates(map[string]interface{}{
+			"label_name": keep,
+			"version":    gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Details{}).Where("label_name IN ?", names).Update("label_name", keep).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Label{}).Where("parent_name IN ?", names).Update("parent_name", keep).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("name IN ?", names).Delete(&Label{}).Error
+	})
+}
+
+// dangling selects the labels whose parent doesn't exist
+func dangling(db *gorm.DB) *gorm.DB {
+	labels := tableOf(db, &Label{})
+	parentName := clause.Column{Table: labels, Name: "parent_name"}
+
+	return db.Model(&Label{}).
+		Select("?", clause.Column{Table: labels, Name: "name"}).
+		Joins("LEFT JOIN ? ON ? = ?", clause.Table{Name: labels, Alias: "parents"}, clause.Column{Table: "parents", Name: "name"}, parentName).
+		Where("? IS NOT NULL AND ? IS NULL", parentName, clause.Column{Table: "parents", Name: "name"}).
+		Order(clause.OrderByColumn{Column: clause.Column{Table: labels, Name: "name"}})
+}
+
+// ToJsonTree serializes labels as a nested JSON forest (see Tree) instead
+// of the flat form where each label references its parent by name
+func ToJsonTree(labels Labels) ([]byte, error) {
+	roots, err := treeOf(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	return ToJson(roots)
+}
+
+// FromJsonTree deserializes a nested JSON forest of labels back into the
+// flat form, with parents always before their children (ready to push)
+func FromJsonTree(src []byte) (Labels, error) {
+	var roots []*LabelNode
+	if err := FromJson(src, &roots); err != nil {
+		return nil, err
+	}
+
+	var labels Labels
+	var flatten func(parent *LabelNode, level []*LabelNode)
+	flatten = func(parent *LabelNode, level []*LabelNode) {
+		for _, node := range level {
+			lb := node.Label
+			if parent != nil {
+				lb.ParentName = NullString{sql.NullString{String: parent.Name, Valid: true}}
+			}
+			labels = append(labels, lb)
+			flatten(node, node.Children)
+		}
+	}
+	flatten(nil, roots)
+
+	return labels, nil
+}
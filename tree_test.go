@@ -0,0 +1,349 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testLabelsTree(t *testing.T, db *gorm.DB) {
+	chain := &Label{Name: "0"}
+	for _, name := range []string{"1", "2", "3", "4", "5", "6", "7", "8", "9"} {
+		chain = &Label{Name: name, Parent: chain}
+	}
+
+	labels := Labels{*chain, Label{Name: "10"}}
+	if err := labels.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	roots, err := (&Labels{}).Tree(PullContext{Storage: db, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 2 || roots[0].Name != "0" || roots[1].Name != "10" {
+		t.Fatalf("Expected roots 0 and 10, got %v", roots)
+	}
+
+	node := roots[0]
+	for _, name := range []string{"1", "2", "3", "4", "5", "6", "7", "8", "9"} {
+		if len(node.Children) != 1 || node.Children[0].Name != name {
+			t.Fatalf("Expected label %s to be the only child of %s, got %v", name, node.Name, node.Children)
+		}
+		node = node.Children[0]
+	}
+
+	if len(node.Children) != 0 || len(roots[1].Children) != 0 {
+		t.Fatalf("Expected leaves 9 and 10 to have no children")
+	}
+}
+
+// dropParentKey drops the foreign key of label parents, so labels can be left
+// dangling by a manual delete (SQLite doesn't enforce foreign keys anyway)
+func dropParentKey(t *testing.T, db *gorm.DB) {
+	if db.Dialector.Name() == "sqlite" {
+		return
+	}
+
+	if err := db.Migrator().DropConstraint(&Label{}, "Parent"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testCheckTreeIntegrity(t *testing.T, db *gorm.DB) {
+	food := NewLabel("Alimente", nil)
+	labels := Labels{NewLabel("Pâine", &food), NewLabel("Transport", nil)}
+	if err := labels.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if dangling, err := labels.CheckTreeIntegrity(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(dangling) != 0 {
+		t.Fatalf("Expected no dangling labels but got %v", dangling)
+	}
+
+	// a manual delete which bypasses the foreign key
+	dropParentKey(t, db)
+	if err := db.Exec("DELETE FROM labels WHERE name = ?", "Alimente").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if dangling, err := labels.CheckTreeIntegrity(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if fmt.Sprint(dangling) != "[Pâine]" {
+		t.Fatalf("Expected the label with a missing parent to be dangling but got %v", dangling)
+	}
+}
+
+func testRepairDanglingParents(t *testing.T, db *gorm.DB) {
+	food, transport := NewLabel("Alimente", nil), NewLabel("Transport", nil)
+	labels := Labels{NewLabel("Pâine", &food), NewLabel("Taxi", &transport), NewLabel("Diverse", nil)}
+	if err := labels.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	// manual deletes which bypass the foreign key
+	dropParentKey(t, db)
+	if err := db.Exec("DELETE FROM labels WHERE name IN ?", []string{"Alimente", "Transport"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := labels.RepairDanglingParents(PushContext{Storage: db}, "Necunoscut"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected an unknown fallback to fail but got %v", err)
+	}
+
+	if n, err := labels.RepairDanglingParents(PushContext{Storage: db}, ""); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatalf("Expected 2 labels to be repaired but got %d", n)
+	}
+
+	if dangling, err := labels.CheckTreeIntegrity(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	} else if len(dangling) != 0 {
+		t.Fatalf("Expected no dangling labels after repair but got %v", dangling)
+	}
+
+	roots, err := labels.Tree(PullContext{Storage: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, root := range roots {
+		names = append(names, root.Name)
+	}
+	if fmt.Sprint(names) != "[Diverse Pâine Taxi]" {
+		t.Fatalf("Expected the repaired labels to be roots but got %v", names)
+	}
+}
+
+func testLabelsMerge(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+
+	root := NewLabel("Cheltuieli", nil)
+	food, groceries := NewLabel("Alimente", &root), NewLabel("Mâncare", &root)
+	fruits, vegetables := NewLabel("Fructe", &groceries), NewLabel("Legume", &food)
+
+	trxs := Transactions{
+		NewTransaction(date, -3000, groceries, NewActor("Alexandru"), NewActor("Piață"),
+			map[Label]int64{fruits: 1000, groceries: 2000}, ""),
+		NewTransaction(date, -1500, food, NewActor("Alexandru"), NewActor("Magazin"),
+			map[Label]int64{vegetables: 500, groceries: 1000}, ""),
+	}
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&Labels{}).Merge(PushContext{Storage: db}, "Alimente", "Mâncare", "Bănuți"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected merge of a missing label to fail with ErrNotFound, got %v", err)
+	}
+
+	if err := (&Labels{}).Merge(PushContext{Storage: db}, "Alimente", "Mâncare"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := (&Labels{}).Exists(PullContext{Storage: db}, "Mâncare"); err != nil || ok {
+		t.Fatalf("Expected merged label to be deleted, got %v (%v)", ok, err)
+	}
+
+	var labels Labels
+	if err := labels.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	}
+	parents := make(map[string]string)
+	for _, lb := range labels {
+		parents[lb.Name] = lb.ParentName.String
+	}
+	expected := map[string]string{"Alimente": "Cheltuieli", "Cheltuieli": "", "Fructe": "Alimente", "Legume": "Alimente"}
+	if fmt.Sprint(parents) != fmt.Sprint(expected) {
+		t.Fatalf("Expected labels %v after merge, got %v", expected, parents)
+	}
+
+	var pulled Transactions
+	if err := pulled.Pull(PullContext{Storage: db}); err != nil {
+		t.Fatal(err)
+	}
+	for _, trx := range pulled {
+		if trx.LabelName != "Alimente" {
+			t.Fatalf("Expected transaction relabelled as Alimente, got %s", trx.LabelName)
+		}
+		for _, d := range trx.Details {
+			if d.LabelName == "Mâncare" {
+				t.Fatalf("Expected details relabelled as Alimente, got %v", d)
+			}
+		}
+	}
+}
+
+func TestLabelsTreeOrphansAndCycles(t *testing.T) {
+	orphan := NewLabel("Orfan", nil)
+	orphan.ParentName = NullString{sql.NullString{String: "Lipsă", Valid: true}}
+
+	roots, err := treeOf(Labels{NewLabel("Rădăcină", nil), orphan})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 2 || roots[0].Name != "Orfan" || roots[1].Name != "Rădăcină" {
+		t.Fatalf("Expected orphan to be kept as root, got %v", roots)
+	}
+
+	a, b := NewLabel("A", nil), NewLabel("B", nil)
+	a.ParentName = NullString{sql.NullString{String: "B", Valid: true}}
+	b.ParentName = NullString{sql.NullString{String: "A", Valid: true}}
+	if _, err := treeOf(Labels{NewLabel("Rădăcină", nil), a, b}); !errors.Is(err, ErrLabelCycle) {
+		t.Fatalf("Expected cycle to be detected, got %v", err)
+	}
+}
+
+func TestLabelsTree_Json(t *testing.T) {
+	labels := Labels{
+		Label{Name: "Pâine", ParentName: NullString{sql.NullString{String: "Alimente", Valid: true}}},
+		Label{Name: "Alimente", ParentName: NullString{sql.NullString{String: "Cheltuieli", Valid: true}}},
+		Label{Name: "Cheltuieli"},
+		Label{Name: "Venituri"},
+	}
+
+	out, err := ToJsonTree(labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedJson := `[{"name":"Cheltuieli","parent":null,"flags":0,"headers":"","children":[` +
+		`{"name":"Alimente","parent":"Cheltuieli","flags":0,"headers":"","children":[` +
+		`{"name":"Pâine","parent":"Alimente","flags":0,"headers":"","children":null}]}]},` +
+		`{"name":"Venituri","parent":null,"flags":0,"headers":"","children":null}]`
+	if string(out) != expectedJson {
+		t.Fatalf("Expected nested JSON %s but got %s instead", expectedJson, out)
+	}
+
+	back, err := FromJsonTree(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parents := make(map[string]string)
+	for _, lb := range back {
+		parents[lb.Name] = lb.ParentName.String
+	}
+
+	expected := map[string]string{"Cheltuieli": "", "Alimente": "Cheltuieli", "Pâine": "Alimente", "Venituri": ""}
+	if len(back) != len(expected) || back[0].Name != "Cheltuieli" {
+		t.Fatalf("Expected parents first after round-trip, got %v", back)
+	}
+	for name, parent := range expected {
+		if parents[name] != parent {
+			t.Fatalf("Expected %s to have parent %q after round-trip, got %q", name, parent, parents[name])
+		}
+	}
+}
+
+func TestLabelsTree_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testLabelsTree(t, db)
+}
+
+func TestCheckTreeIntegrity_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testCheckTreeIntegrity(t, db)
+}
+
+func TestRepairDanglingParents_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testRepairDanglingParents(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestLabelsMerge_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	// silent intentionally errors
+	testLabelsMerge(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestLabelsTree_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testLabelsTree(t, db)
+}
+
+func TestCheckTreeIntegrity_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testCheckTreeIntegrity(t, db)
+}
+
+func TestRepairDanglingParents_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testRepairDanglingParents(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestLabelsMerge_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	// silent intentionally errors
+	testLabelsMerge(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestLabelsTree_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testLabelsTree(t, db)
+}
+
+func TestCheckTreeIntegrity_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testCheckTreeIntegrity(t, db)
+}
+
+func TestRepairDanglingParents_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testRepairDanglingParents(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
+
+func TestLabelsMerge_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	// silent intentionally errors
+	testLabelsMerge(t, db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)}))
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+// UsedLabels returns the names of the labels actually used by transactions
+// or by their details, ordered by name, where transactions are filtered just
+// like a pull does (e.g. the window of dates). Unlike pulling labels, this
+// excludes any label that's no longer in use
+func (t *Transactions) UsedLabels(ctx PullContext) ([]string, error) {
+	var err error
+	if ctx.Storage, err = withTableSuffix(ctx.reader(), ctx.TableSuffix); err != nil {
+		return nil, err
+	}
+
+	uuids := ctx.filtered(ctx.Storage.Model(&Transaction{})).Select("uuid")
+	trxLabels := ctx.filtered(ctx.Storage.Model(&Transaction{})).Distinct("label_name")
+	detailsLabels := ctx.Storage.Model(&Details{}).Distinct("label_name").Where("transaction_uuid IN (?)", uuids)
+
+	var names []string
+	err = ctx.Storage.Model(&Label{}).
+		Where("name IN (?) OR name IN (?)", trxLabels, detailsLabels).
+		Order("name").Pluck("name", &names).Error
+
+	return names, err
+}
+
+// UsedActors returns the names of the actors who appear as sender or as
+// receiver of transactions filtered just like a pull does, ordered by name.
+// Unlike pulling actors, this excludes any stale actor
+func (t *Transactions) UsedActors(ctx PullContext) ([]string, error) {
+	var err error
+	if ctx.Storage, err = withTableSuffix(ctx.reader(), ctx.TableSuffix); err != nil {
+		return nil, err
+	}
+
+	senders := ctx.filtered(ctx.Storage.Model(&Transaction{})).Distinct("sender_name")
+	receivers := ctx.filtered(ctx.Storage.Model(&Transaction{})).Distinct("receiver_name")
+
+	var names []string
+	err = ctx.Storage.Model(&Actor{}).
+		Where("name IN (?) OR name IN (?)", senders, receivers).
+		Order("name").Pluck("name", &names).Error
+
+	return names, err
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// seedUsage pushes a few transactions between a handful of actors and labels,
+// leaving an unused actor (Bancă) and an unused label (Neutilizat) behind
+func seedUsage(t *testing.T, db *gorm.DB) {
+	date, _ := time.Parse("2006-01-02", "2021-05-01")
+
+	trxs := Transactions{
+		NewTransaction(date, -3000, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Magazin"),
+			map[Label]int64{NewLabel("Pâine", nil): 1000, NewLabel("Apă", nil): 2000}, ""),
+		NewTransaction(date.AddDate(0, 0, 1), -1500, NewLabel("Alimente", nil), NewActor("Alexandru"), NewActor("Piață"), nil, ""),
+		NewTransaction(date.AddDate(0, 1, 0), 5000, NewLabel("Salariu", nil), NewActor("Angajator"), NewActor("Alexandru"), nil, ""),
+	}
+
+	if err := trxs.Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&Actors{NewActor("Bancă")}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&Labels{NewLabel("Neutilizat", nil)}).Push(PushContext{Storage: db, BatchSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testUsedLabels(t *testing.T, db *gorm.DB) {
+	seedUsage(t, db)
+
+	names, err := (&Transactions{}).UsedLabels(PullContext{Storage: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"Alimente", "Apă", "Pâine", "Salariu"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Fatalf("Expected used labels %v but got %v instead", expected, names)
+	}
+
+	from, _ := time.Parse("2006-01-02", "2021-05-02")
+	names, err = (&Transactions{}).UsedLabels(PullContext{Storage: db, From: from})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{"Alimente", "Salariu"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Fatalf("Expected used labels %v since %s but got %v instead", expected, from.Format(DateFormat), names)
+	}
+
+	names, err = (&Transactions{}).UsedLabels(PullContext{Storage: db, OnlyWithDetails: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{"Alimente", "Apă", "Pâine"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Fatalf("Expected used labels %v of itemized transactions but got %v instead", expected, names)
+	}
+}
+
+func testUsedActors(t *testing.T, db *gorm.DB) {
+	seedUsage(t, db)
+
+	names, err := (&Transactions{}).UsedActors(PullContext{Storage: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"Alexandru", "Angajator", "Magazin", "Piață"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Fatalf("Expected used actors %v but got %v instead", expected, names)
+	}
+
+	to, _ := time.Parse("2006-01-02", "2021-05-01")
+	names, err = (&Transactions{}).UsedActors(PullContext{Storage: db, To: to})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{"Alexandru", "Magazin"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Fatalf("Expected used actors %v until %s but got %v instead", expected, to.Format(DateFormat), names)
+	}
+
+	names, err = (&Transactions{}).UsedActors(PullContext{Storage: db, OnlyWithoutDetails: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{"Alexandru", "Angajator", "Piață"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Fatalf("Expected used actors %v of transactions which aren't itemized but got %v instead", expected, names)
+	}
+}
+
+func TestUsedLabels_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testUsedLabels(t, db)
+}
+
+func TestUsedActors_Postgres(t *testing.T) {
+	db := begin(_Postgres)
+	defer end(db)
+
+	testUsedActors(t, db)
+}
+
+func TestUsedLabels_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testUsedLabels(t, db)
+}
+
+func TestUsedActors_MySQL(t *testing.T) {
+	db := begin(_MySQL)
+	defer end(db)
+
+	testUsedActors(t, db)
+}
+
+func TestUsedLabels_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testUsedLabels(t, db)
+}
+
+func TestUsedActors_SQLite(t *testing.T) {
+	db := begin(_SQLite)
+	defer end(db)
+
+	testUsedActors(t, db)
+}
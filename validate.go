@@ -0,0 +1,182 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationErrors is a collection of every problem found while validating
+// a registry in memory, so that all issues can be reported at once rather
+// than just the first one (e.g. to be displayed by an UI)
+type ValidationErrors []error
+
+// Error representation of all problems found, one after another
+func (ve ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(ve))
+	for _, err := range ve {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap enables errors.Is and errors.As to look into each problem found
+func (ve ValidationErrors) Unwrap() []error {
+	return ve
+}
+
+// orNil returns nil if no problems were found since a non-nil empty slice
+// would still be interpreted as a failure by callers
+func (ve ValidationErrors) orNil() error {
+	if len(ve) == 0 {
+		return nil
+	}
+
+	return ve
+}
+
+// Validate runs the same checks the actors would go through before being
+// pushed into registry, without the need of a persistence layer
+func (a *Actors) Validate() error {
+	var errs ValidationErrors
+	for i := range *a {
+		if err := (*a)[i].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("actor #%d: %w", i, err))
+		}
+	}
+
+	return errs.orNil()
+}
+
+// Validate runs the same checks the labels would go through before being
+// pushed into registry, without the need of a persistence layer. Besides
+// the fields check, the labels tree is walked to detect parent cycles
+func (l *Labels) Validate() error {
+	var errs ValidationErrors
+
+	parents := make(map[string]string)
+	for i := range *l {
+		lb := &(*l)[i]
+		if err := lb.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("label #%d: %w", i, err))
+		}
+
+		seen := make(map[*Label]bool)
+		for child := lb; child != nil && !seen[child]; child = child.Parent {
+			seen[child] = true
+			if child.Parent != nil {
+				parents[child.Name] = child.Parent.Name
+			} else if child.ParentName.Valid {
+				parents[child.Name] = child.ParentName.String
+			}
+		}
+	}
+
+	for i, lb := range *l {
+		seen := map[string]bool{lb.Name: true}
+		for name, ok := parents[lb.Name]; ok; name, ok = parents[name] {
+			if seen[name] {
+				errs = append(errs, fmt.Errorf("label #%d: %w through %s", i, ErrLabelCycle, name))
+				break
+			}
+			seen[name] = true
+		}
+	}
+
+	return errs.orNil()
+}
+
+// Validate runs the same checks the transactions and their details would
+// go through before being pushed into registry, without the need of a
+// persistence layer
+func (t *Transactions) Validate() error {
+	var errs ValidationErrors
+	for i := range *t {
+		trx := &(*t)[i]
+		if err := trx.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("transaction #%d: %w", i, err))
+		}
+
+		for j, d := range trx.Details {
+			if err := d.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("transaction #%d details #%d: %w", i, j, err))
+			}
+		}
+	}
+
+	return errs.orNil()
+}
+
+// SkipError is the reason why a transaction was skipped on push
+type SkipError struct {
+	Index       int // position in the collection before the push
+	Transaction Transaction
+	Err         error
+}
+
+// Error representation of the skipped transaction's problem
+func (e SkipError) Error() string {
+	return fmt.Sprintf("transaction #%d skipped: %v", e.Index, e.Err)
+}
+
+// Unwrap enables errors.Is and errors.As to look into the problem
+func (e SkipError) Unwrap() error {
+	return e.Err
+}
+
+// PushResult reports the outcome of a push (see PushWithResult), with the
+// number of records actually pushed and the ones skipped, if any
+type PushResult struct {
+	Pushed  int
+	Merged  int // records merged into existing ones (see Reconcile)
+	Skipped []SkipError
+}
+
+// partition splits the transactions into copies of the valid ones, in the
+// same order and along with their indexes, and skipped ones with the first
+// problem found for each of them. Besides the fields, the transactions are
+// checked against the options of the push (e.g. MaxDetails)
+func (t *Transactions) partition(ctx PushContext) (Transactions, []int, []SkipError) {
+	var valid Transactions
+	var indexes []int
+	var skipped []SkipError
+	for i := range *t {
+		trx := (*t)[i]
+
+		err := trx.check(ctx)
+		if err == nil {
+			err = trx.validate()
+		}
+		for j := 0; err == nil && j < len(trx.Details); j++ {
+			err = trx.Details[j].validate()
+		}
+
+		if err != nil {
+			skipped = append(skipped, SkipError{Index: i, Transaction: trx, Err: err})
+		} else {
+			valid = append(valid, trx)
+			indexes = append(indexes, i)
+		}
+	}
+
+	return valid, indexes, skipped
+}
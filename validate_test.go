@@ -0,0 +1,132 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestValidateActors(t *testing.T) {
+	actors := Actors{NewActor("Alexandru"), NewActor(""), NewActor("")}
+
+	err := actors.Validate()
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Expected 2 problems for actors with empty names but got %v", err)
+	}
+
+	if err := (&Actors{NewActor("Alexandru")}).Validate(); err != nil {
+		t.Fatalf("Expected no problems but got %v", err)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	loop := Label{Name: "A", ParentName: NullString{sql.NullString{String: "B", Valid: true}}}
+
+	labels := Labels{
+		NewLabel("", nil),
+		loop,
+		NewLabel("B", &Label{Name: "A"}),
+		NewLabel("C", &Label{Name: "D"}),
+	}
+
+	err := labels.Validate()
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 3 {
+		t.Fatalf("Expected 1 empty name and 2 cycles but got %v", err)
+	}
+
+	if !errors.Is(err, ErrLabelCycle) || !errors.Is(err, ErrEmptyName) {
+		t.Fatalf("Expected ErrLabelCycle and ErrEmptyName among problems but got %v", err)
+	}
+}
+
+func TestValidateTransactions(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-04-22")
+
+	transactions := Transactions{
+		Transaction{
+			Date:   date,
+			Amount: -100,
+			Details: []*Details{
+				{LabelName: "?", Amount: 150},
+				{LabelName: "?", Amount: -50},
+			},
+		},
+		Transaction{
+			Date:    date,
+			Amount:  100,
+			Details: []*Details{{LabelName: "?", Amount: 50}},
+		},
+		Transaction{
+			Date:    date,
+			Amount:  -100,
+			Details: []*Details{{LabelName: "?", Amount: 100}},
+		},
+	}
+
+	err := transactions.Validate()
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Expected 1 negative details and 1 mismatched sum but got %v", err)
+	}
+}
+
+func TestValidateTransactionsOverflow(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-04-22")
+
+	// the details wrap around to exactly the amount
+	transactions := Transactions{
+		Transaction{
+			Date:   date,
+			Amount: 0,
+			Details: []*Details{
+				{LabelName: "?", Amount: math.MaxInt64},
+				{LabelName: "?", Amount: math.MaxInt64},
+				{LabelName: "?", Amount: 2},
+			},
+		},
+		Transaction{
+			Date:    date,
+			Amount:  math.MinInt64,
+			Details: []*Details{{LabelName: "?", Amount: math.MaxInt64}},
+		},
+	}
+
+	err := transactions.Validate()
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Expected 2 overflowing transactions but got %v", err)
+	}
+
+	for _, err := range errs {
+		if !errors.Is(err, ErrAmountOverflow) {
+			t.Fatalf("Expected ErrAmountOverflow but got %v", err)
+		}
+	}
+}
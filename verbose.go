@@ -0,0 +1,116 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import "time"
+
+// timestamps are the record keeping times of an entity, which are hidden
+// from the JSON representation unless it's verbose
+type timestamps struct {
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// stamp formats the record keeping times as RFC3339
+func stamp(createdAt, updatedAt time.Time) timestamps {
+	return timestamps{createdAt.Format(time.RFC3339), updatedAt.Format(time.RFC3339)}
+}
+
+type verboseActor struct {
+	Actor
+	timestamps
+}
+
+type verboseLabel struct {
+	Label
+	timestamps
+}
+
+type verboseDetails struct {
+	Details
+	timestamps
+}
+
+type verboseTransaction struct {
+	Transaction
+	Details []*verboseDetails `json:"details"`
+	timestamps
+}
+
+// ToJsonVerbose works just like ToJson except the record keeping times
+// (created_at and updated_at) are included, e.g. for sync clients
+func ToJsonVerbose(src interface{}) ([]byte, error) {
+	return ToJson(verbose(src))
+}
+
+// verbose wraps the supported registry key components (and collections of
+// them) to include their timestamps, while leaving anything else as it is
+func verbose(src interface{}) interface{} {
+	switch v := src.(type) {
+	case *Actors:
+		return verbose(*v)
+	case *Labels:
+		return verbose(*v)
+	case *Transactions:
+		return verbose(*v)
+	case *Actor:
+		return verbose(*v)
+	case *Label:
+		return verbose(*v)
+	case *Transaction:
+		return verbose(*v)
+	case Actors:
+		out := make([]verboseActor, 0, len(v))
+		for _, a := range v {
+			out = append(out, verboseActor{a, stamp(a.CreatedAt, a.UpdatedAt)})
+		}
+		return out
+	case Labels:
+		out := make([]verboseLabel, 0, len(v))
+		for _, lb := range v {
+			out = append(out, verboseLabel{lb, stamp(lb.CreatedAt, lb.UpdatedAt)})
+		}
+		return out
+	case Transactions:
+		out := make([]verboseTransaction, 0, len(v))
+		for _, t := range v {
+			out = append(out, verbose(t).(verboseTransaction))
+		}
+		return out
+	case Actor:
+		return verboseActor{v, stamp(v.CreatedAt, v.UpdatedAt)}
+	case Label:
+		return verboseLabel{v, stamp(v.CreatedAt, v.UpdatedAt)}
+	case Transaction:
+		// missing details (e.g. decoded from null) are written as null
+		var details []*verboseDetails
+		if v.Details != nil {
+			details = make([]*verboseDetails, len(v.Details))
+			for i, d := range v.Details {
+				if d != nil {
+					details[i] = &verboseDetails{*d, stamp(d.CreatedAt, d.UpdatedAt)}
+				}
+			}
+		}
+		return verboseTransaction{v, details, stamp(v.CreatedAt, v.UpdatedAt)}
+	default:
+		return src
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2021 Alexandru Catrina
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package expenses
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToJsonVerbose_Json(t *testing.T) {
+	date, _ := time.Parse("2006-01-02", "2021-04-24")
+	stamp, _ := time.Parse(time.RFC3339, "2021-04-25T10:30:00Z")
+
+	trx := Transaction{
+		Date:         date,
+		Amount:       -100,
+		LabelName:    "?",
+		SenderName:   "?",
+		ReceiverName: "?",
+		Signature:    "?",
+		Details:      []*Details{{LabelName: "?", Amount: 100, CreatedAt: stamp, UpdatedAt: stamp}},
+		CreatedAt:    stamp,
+		UpdatedAt:    stamp.Add(time.Hour),
+	}
+
+	out, err := ToJsonVerbose(&Transactions{trx})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedJson := `[{"date":"2021-04-24T00:00:00Z","amount":-100,"label":"?","sender":"?","receiver":"?",` +
+		`"signature":"?","flags":0,"headers":"","details":[{"label":"?","amount":100,"flags":0,"headers":"",` +
+		`"created_at":"2021-04-25T10:30:00Z","updated_at":"2021-04-25T10:30:00Z"}],` +
+		`"created_at":"2021-04-25T10:30:00Z","updated_at":"2021-04-25T11:30:00Z"}]`
+	if string(out) != expectedJson {
+		t.Fatalf("Expected verbose JSON %s but got %s instead", expectedJson, out)
+	}
+
+	// the default representation keeps hiding the timestamps
+	if out, err := ToJson(&Transactions{trx}); err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(string(out), "created_at") || strings.Contains(string(out), "updated_at") {
+		t.Fatalf("Expected no timestamps in JSON but got %s", out)
+	}
+}
+
+func TestToJsonVerboseNullDetails_Json(t *testing.T) {
+	var trxs Transactions
+	if err := FromJson([]byte(`[{"amount": -100, "details": [null]}]`), &trxs); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := ToJsonVerbose(&trxs); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(out), `"details":[null]`) {
+		t.Fatalf("Expected null details to be written as null but got %s", out)
+	}
+}
+
+func TestToJsonVerboseActorsAndLabels_Json(t *testing.T) {
+	stamp, _ := time.Parse(time.RFC3339, "2021-04-25T10:30:00Z")
+
+	actors := Actors{Actor{Name: "Alexandru", CreatedAt: stamp, UpdatedAt: stamp}}
+	if out, err := ToJsonVerbose(actors); err != nil {
+		t.Fatal(err)
+	} else if expectedJson := `[{"name":"Alexandru","flags":0,"headers":"","created_at":"2021-04-25T10:30:00Z","updated_at":"2021-04-25T10:30:00Z"}]`; string(out) != expectedJson {
+		t.Fatalf("Expected verbose JSON %s but got %s instead", expectedJson, out)
+	}
+
+	label := Label{Name: "Alimente", CreatedAt: stamp, UpdatedAt: stamp}
+	if out, err := ToJsonVerbose(&label); err != nil {
+		t.Fatal(err)
+	} else if expectedJson := `{"name":"Alimente","parent":null,"flags":0,"headers":"","created_at":"2021-04-25T10:30:00Z","updated_at":"2021-04-25T10:30:00Z"}`; string(out) != expectedJson {
+		t.Fatalf("Expected verbose JSON %s but got %s instead", expectedJson, out)
+	}
+}